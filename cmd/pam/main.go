@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"runtime"
 
 	"github.com/alecthomas/kong"
 	"google.golang.org/grpc"
@@ -28,12 +30,20 @@ func main() {
 		}
 	}
 
-	tlsCredentials, err := certs.LoadTLSCredentials()
+	tlsCredentials, err := certs.LoadTLSCredentials(state.ClientCert, state.ClientKey)
+	if err != nil && state.ClientCert != "" {
+		// let the user fix or clear a broken certificate with the cert command
+		fmt.Printf("Can't load the client certificate: %s\n", err)
+		tlsCredentials, err = certs.LoadTLSCredentials("", "")
+	}
 	if err != nil {
 		panic(err)
 	}
 
-	conn, err := grpc.NewClient(state.ServerAddr, grpc.WithTransportCredentials(tlsCredentials))
+	conn, err := grpc.NewClient(state.ServerAddr,
+		grpc.WithTransportCredentials(tlsCredentials),
+		grpc.WithUserAgent(fmt.Sprintf("pam-cli (%s/%s)", runtime.GOOS, runtime.GOARCH)),
+	)
 	if err != nil {
 		panic(err)
 	}
@@ -7,55 +7,169 @@ import (
 	"net"
 	"time"
 
+	"github.com/alecthomas/kong"
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/smakimka/pam/internal/server/certs"
 	"github.com/smakimka/pam/internal/server/config"
+	"github.com/smakimka/pam/internal/server/interceptors"
+	"github.com/smakimka/pam/internal/server/jobs"
 	"github.com/smakimka/pam/internal/server/service"
 	"github.com/smakimka/pam/internal/server/storage"
+	"github.com/smakimka/pam/internal/server/tokenhash"
 )
 
+var cli struct {
+	Serve   serveCmd   `cmd:"" default:"1" help:"Run the server, new migrations are applied first"`
+	Migrate migrateCmd `cmd:"" help:"Manage database schema migrations"`
+}
+
+type migrateCmd struct {
+	Status migrateStatusCmd `cmd:"" help:"List migrations and whether they are applied"`
+	Up     migrateUpCmd     `cmd:"" help:"Apply new migrations"`
+}
+
 func main() {
 	ctx := context.Background()
 
+	kctx := kong.Parse(&cli, kong.Name("server"), kong.BindTo(ctx, (*context.Context)(nil)))
+
 	cfg, err := config.New()
+	kctx.FatalIfErrorf(err)
+
+	err = kctx.Run(ctx, cfg)
+	kctx.FatalIfErrorf(err)
+}
+
+type serveCmd struct{}
+
+func (c *serveCmd) Run(ctx context.Context, cfg *config.Config) error {
+	s, err := openStorage(ctx, cfg)
 	if err != nil {
-		panic(err)
+		return err
 	}
-
-	pool, err := pgxpool.New(ctx, cfg.DBUrl)
+	err = s.Init(ctx)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	if err = waitForPostgres(ctx, pool); err != nil {
-		panic(err)
+	if cfg.TokenHashKey == "" {
+		fmt.Println("TOKEN_HASH_KEY is not set, auth tokens are hashed without a key")
 	}
+	hasher := tokenhash.New([]byte(cfg.TokenHashKey))
 
-	s, err := storage.NewPGStorage(pool)
+	migrated, err := s.MigrateTokens(ctx, hasher.Hash)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	err = s.Init(ctx)
-	if err != nil {
-		panic(err)
+	if migrated > 0 {
+		fmt.Printf("hashed %d auth tokens stored in plaintext\n", migrated)
 	}
 
 	listen, err := net.Listen("tcp", cfg.Addr)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	tlsCredentials, err := certs.LoadTLSCredentials()
+	tlsCredentials, err := certs.LoadTLSCredentials(cfg.ClientCertMode, cfg.ClientCAFile)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	server := service.NewServer(s, tlsCredentials, cfg.AuthTokenExpiryTimeSec)
+	server := service.NewServer(s, tlsCredentials, hasher, cfg.AuthTokenExpiryTimeSec, interceptors.RateLimitConfig{
+		RequestsPerMinute: cfg.AuthRequestsPerMinute,
+		MaxAttempts:       cfg.LoginMaxAttempts,
+		Lockout:           time.Duration(cfg.LoginLockoutSec) * time.Second,
+		MaxLockout:        time.Duration(cfg.LoginMaxLockoutSec) * time.Second,
+		Window:            time.Duration(cfg.LoginFailureWindowSec) * time.Second,
+	})
+
+	jobs.NewRunner(s, jobs.CleanupJobs(s, jobs.CleanupConfig{
+		TokensInterval:        time.Duration(cfg.TokenCleanupIntervalSec) * time.Second,
+		LoginAttemptsInterval: time.Duration(cfg.LoginAttemptsCleanupIntervalSec) * time.Second,
+		LoginFailureWindow:    time.Duration(cfg.LoginFailureWindowSec) * time.Second,
+	})...).Start(ctx)
 
 	fmt.Printf("started server on %s\n", cfg.Addr)
-	if err := server.Serve(listen); err != nil {
-		panic(err)
+	return server.Serve(listen)
+}
+
+type migrateStatusCmd struct{}
+
+func (c *migrateStatusCmd) Run(ctx context.Context, cfg *config.Config) error {
+	m, err := openMigrator(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	migrations, err := m.Migrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range migrations {
+		if migration.AppliedAt.IsZero() {
+			fmt.Printf("%d. %s, pending\n", migration.Version, migration.Name)
+			continue
+		}
+		fmt.Printf("%d. %s, applied at %s\n", migration.Version, migration.Name, migration.AppliedAt.Local().Format("2006-01-02 15:04:05"))
+	}
+
+	return nil
+}
+
+type migrateUpCmd struct{}
+
+func (c *migrateUpCmd) Run(ctx context.Context, cfg *config.Config) error {
+	m, err := openMigrator(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	applied, err := m.Migrate(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("applied %d migrations\n", applied)
+	return nil
+}
+
+// openMigrator подключается к базе, выбранной в cfg, для работы с миграциями
+func openMigrator(ctx context.Context, cfg *config.Config) (storage.Migrator, error) {
+	s, err := openStorage(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := s.(storage.Migrator)
+	if !ok {
+		return nil, fmt.Errorf("%s storage has no migrations", cfg.DB)
 	}
+
+	return m, nil
+}
+
+// openStorage подключается к базе, выбранной в cfg
+func openStorage(ctx context.Context, cfg *config.Config) (storage.Storage, error) {
+	if cfg.DB == config.DBSQLite {
+		db, err := storage.OpenSQLite(cfg.DBUrl)
+		if err != nil {
+			return nil, err
+		}
+
+		return storage.NewSQLiteStorage(db)
+	}
+
+	pool, err := pgxpool.New(ctx, cfg.DBUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = waitForPostgres(ctx, pool); err != nil {
+		return nil, err
+	}
+
+	return storage.NewPGStorage(pool)
 }
 
 func waitForPostgres(ctx context.Context, p *pgxpool.Pool) error {
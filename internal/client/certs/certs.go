@@ -9,7 +9,8 @@ import (
 	"google.golang.org/grpc/credentials"
 )
 
-func LoadTLSCredentials() (credentials.TransportCredentials, error) {
+// LoadTLSCredentials загружает CA сервера и, если заданы certFile и keyFile, клиентский сертификат
+func LoadTLSCredentials(certFile string, keyFile string) (credentials.TransportCredentials, error) {
 	// Load certificate of the CA who signed server's certificate
 	pemServerCA, err := os.ReadFile("certs/ca-cert.pem")
 	if err != nil {
@@ -26,5 +27,14 @@ func LoadTLSCredentials() (credentials.TransportCredentials, error) {
 		RootCAs: certPool,
 	}
 
+	if certFile != "" && keyFile != "" {
+		// Load client's certificate and private key
+		clientCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{clientCert}
+	}
+
 	return credentials.NewTLS(config), nil
 }
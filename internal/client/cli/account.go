@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/smakimka/pam/internal/client/pamclient"
+	"github.com/smakimka/pam/internal/client/state"
+)
+
+type AccountCmd struct {
+	Delete AccountDeleteCmd `cmd:"" help:"Delete the account with all its data on the server and on this machine"`
+}
+
+type AccountDeleteCmd struct {
+	Yes bool `short:"y" help:"Don't ask for confirmation"`
+}
+
+func (c *AccountDeleteCmd) Run(ctx context.Context, s *state.State) error {
+	if !c.Yes {
+		answer, err := readLine("Delete the account and all its data? This can't be undone [y/N]: ")
+		if err != nil {
+			return err
+		}
+
+		if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+			fmt.Println("Cancelled")
+			return nil
+		}
+	}
+
+	err := s.DeleteAccount(ctx)
+	if err != nil {
+		if errors.Is(err, pamclient.ErrUnauthenticated) {
+			fmt.Println("Please authenticate using the auth command, your token probably expired")
+			return nil
+		}
+
+		if errors.Is(err, pamclient.ErrWrongPassword) {
+			fmt.Println("Wrong password")
+			return nil
+		}
+
+		var tooMany *pamclient.TooManyAttemptsError
+		if errors.As(err, &tooMany) {
+			printTooManyAttempts(tooMany)
+			return nil
+		}
+
+		if errors.Is(err, pamclient.ErrUnavailable) {
+			fmt.Println("The server is unreachable, try again later")
+			return nil
+		}
+
+		return err
+	}
+
+	fmt.Println("Ok, the account was deleted")
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/smakimka/pam/internal/client/pamclient"
 	"github.com/smakimka/pam/internal/client/state"
@@ -18,8 +19,30 @@ func (c *AuthCmd) Run(ctx context.Context, state *state.State) error {
 			fmt.Println("\nWrong username or password")
 			return nil
 		}
+
+		if errors.Is(err, pamclient.ErrWrongSecondFactor) {
+			fmt.Println("Wrong or already used two-factor code")
+			return nil
+		}
+
+		var tooMany *pamclient.TooManyAttemptsError
+		if errors.As(err, &tooMany) {
+			printTooManyAttempts(tooMany)
+			return nil
+		}
+
+		return err
 	}
 
 	fmt.Println("\nOk")
 	return nil
 }
+
+func printTooManyAttempts(err *pamclient.TooManyAttemptsError) {
+	if err.RetryAfter <= 0 {
+		fmt.Println("\nToo many attempts, try again later")
+		return
+	}
+
+	fmt.Printf("\nToo many attempts, try again in %s\n", err.RetryAfter.Round(time.Second))
+}
@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/smakimka/pam/internal/client/state"
+)
+
+type CertCmd struct {
+	Show  CertShowCmd  `cmd:"" default:"1" help:"Show the client certificate of this profile"`
+	Set   CertSetCmd   `cmd:"" help:"Authenticate with a client certificate instead of a token"`
+	Clear CertClearCmd `cmd:"" help:"Stop using the client certificate"`
+}
+
+type CertShowCmd struct{}
+
+func (c *CertShowCmd) Run(ctx context.Context, s *state.State) error {
+	if s.ClientCert == "" {
+		fmt.Println("No client certificate is set")
+		return nil
+	}
+
+	fmt.Printf("Certificate: %s\nKey: %s\n", s.ClientCert, s.ClientKey)
+	return nil
+}
+
+type CertSetCmd struct {
+	Cert string `arg:"" type:"existingfile" help:"PEM encoded client certificate"`
+	Key  string `arg:"" type:"existingfile" help:"PEM encoded private key of the certificate"`
+}
+
+func (c *CertSetCmd) Run(ctx context.Context, s *state.State) error {
+	if err := s.SetClientCert(c.Cert, c.Key); err != nil {
+		fmt.Printf("Can't load the certificate: %s\n", err)
+		return nil
+	}
+
+	fmt.Println("Ok, the certificate will be used from the next command on")
+	return nil
+}
+
+type CertClearCmd struct{}
+
+func (c *CertClearCmd) Run(ctx context.Context, s *state.State) error {
+	if err := s.SetClientCert("", ""); err != nil {
+		return err
+	}
+
+	fmt.Println("Ok")
+	return nil
+}
@@ -1,9 +1,21 @@
 package cli
 
 var CLI struct {
-	Reg  RegCmd  `cmd:"" help:"Registration"`
-	Auth AuthCmd `cmd:"" help:"Authorization"`
-	Rem  RemCmd  `cmd:"" help:"Remember data"`
-	Get  GetCmd  `cmd:"" help:"Get data previously remembered"`
-	List ListCmd `cmd:"" help:"List all data"`
+	Reg      RegCmd       `cmd:"" help:"Registration"`
+	Auth     AuthCmd      `cmd:"" help:"Authorization"`
+	Logout   LogoutCmd    `cmd:"" help:"Revoke the current token and forget it"`
+	Passwd   PasswdCmd    `cmd:"" help:"Change the account password"`
+	Account  AccountCmd   `cmd:"" help:"Manage the account"`
+	Sessions SessionsCmd  `cmd:"" help:"List and revoke active sessions"`
+	Token    TokenCmd     `cmd:"" help:"Manage API tokens for automation"`
+	TwoFA    TwoFactorCmd `cmd:"" name:"2fa" help:"Manage two-factor authentication"`
+	Cert     CertCmd      `cmd:"" help:"Manage the client certificate used instead of a token"`
+	Rem      RemCmd       `cmd:"" help:"Remember data"`
+	Get      GetCmd       `cmd:"" help:"Get data previously remembered"`
+	List     ListCmd      `cmd:"" help:"List all data"`
+	Rm       RmCmd        `cmd:"" help:"Delete data"`
+	Otp      OtpCmd       `cmd:"" help:"Show the current one-time code of a TOTP secret"`
+	History  HistoryCmd   `cmd:"" help:"List previous versions of data"`
+	Restore  RestoreCmd   `cmd:"" help:"Restore a previous version of data"`
+	Sync     SyncCmd      `cmd:"" help:"Upload changes made offline and update the local copy"`
 }
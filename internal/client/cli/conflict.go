@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/smakimka/pam/internal/client/pamclient"
+	"github.com/smakimka/pam/internal/client/state"
+	"github.com/smakimka/pam/internal/datatypes"
+)
+
+type conflictChoice int
+
+const (
+	choiceCancel conflictChoice = iota
+	choiceOverwrite
+	choiceMerge
+)
+
+// mergeData объединяет новые данные с сохраненными, если для этого типа данных это поддерживается
+func mergeData(kind int, current *pamclient.GetResponse, incoming []byte) ([]byte, bool, error) {
+	if current.Kind != kind {
+		return nil, false, nil
+	}
+
+	switch kind {
+	case datatypes.Text:
+		return datatypes.MergeText(current.Data, incoming), true, nil
+	case datatypes.Login:
+		currentLogin, err := datatypes.UnmarshalLogin(current.Data)
+		if err != nil {
+			return nil, false, err
+		}
+
+		login, err := datatypes.UnmarshalLogin(incoming)
+		if err != nil {
+			return nil, false, err
+		}
+
+		login.Merge(currentLogin)
+
+		merged, err := login.Marshal()
+		if err != nil {
+			return nil, false, err
+		}
+
+		return merged, true, nil
+	default:
+		return nil, false, nil
+	}
+}
+
+// resolveConflict показывает данные, сохраненные на сервере, и спрашивает, что с ними делать
+func resolveConflict(name string, expected int, current *pamclient.GetResponse, canMerge bool) (conflictChoice, error) {
+	if expected == 0 {
+		fmt.Printf("Data with this name already exists (revision %d), ", current.Revision)
+	} else {
+		fmt.Printf("The data was changed by someone else (revision %d, expected %d), ", current.Revision, expected)
+	}
+
+	fmt.Print("currently saved ")
+	if err := displayData(name, current, false); err != nil {
+		return choiceCancel, err
+	}
+
+	prompt := "[o]verwrite, [c]ancel: "
+	if canMerge {
+		prompt = "[o]verwrite, [m]erge, [c]ancel: "
+	}
+
+	answer, err := readLine(prompt)
+	if err != nil {
+		return choiceCancel, err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "o":
+		return choiceOverwrite, nil
+	case "m":
+		if canMerge {
+			return choiceMerge, nil
+		}
+	}
+
+	return choiceCancel, nil
+}
+
+// uploadResolvingConflicts сохраняет данные, ожидая ревизию revision, и при конфликте предлагает перезаписать
+// или объединить данные. Если папка и теги не заданы, при перезаписи остаются текущие.
+// Возвращает false, если пользователь отказался сохранять
+func uploadResolvingConflicts(ctx context.Context, s *state.State, name string, kind int, data []byte, meta pamclient.Meta, revision int) (bool, error) {
+	for {
+		_, err := s.Upload(ctx, name, kind, data, meta, revision)
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, pamclient.ErrRevisionConflict) {
+			return false, err
+		}
+
+		current, err := s.Get(ctx, name)
+		if errors.Is(err, pamclient.ErrDataDoesNotExist) {
+			// deleted in the meantime
+			revision = 0
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+
+		merged, canMerge, err := mergeData(kind, current, data)
+		if err != nil {
+			return false, err
+		}
+
+		choice, err := resolveConflict(name, revision, current, canMerge)
+		if err != nil {
+			return false, err
+		}
+
+		switch choice {
+		case choiceOverwrite:
+			revision = current.Revision
+		case choiceMerge:
+			data = merged
+			revision = current.Revision
+		default:
+			return false, nil
+		}
+
+		meta = inheritMeta(meta, current.Meta)
+	}
+}
+
+// inheritMeta оставляет папку и теги сохраненных данных, если новые не заданы
+func inheritMeta(meta pamclient.Meta, current pamclient.Meta) pamclient.Meta {
+	if meta.Folder == "" && len(meta.Tags) == 0 {
+		return current
+	}
+
+	return meta
+}
@@ -4,6 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/smakimka/pam/internal/client/pamclient"
 	"github.com/smakimka/pam/internal/client/state"
@@ -11,7 +15,9 @@ import (
 )
 
 type GetCmd struct {
-	Name string `arg:"" help:"Name of the data to get"`
+	Name   string `arg:"" help:"Name of the data to get"`
+	Reveal bool   `help:"Show full card number, CVV and PIN instead of masking them"`
+	Out    string `help:"Where to save a file, a directory keeps the original filename"`
 }
 
 func (c *GetCmd) Run(ctx context.Context, s *state.State) error {
@@ -30,9 +36,26 @@ func (c *GetCmd) Run(ctx context.Context, s *state.State) error {
 		return err
 	}
 
+	if data.Kind == datatypes.File {
+		return c.saveFile(ctx, s, data)
+	}
+
+	return displayData(c.Name, data, c.Reveal)
+}
+
+func displayData(name string, data *pamclient.GetResponse, reveal bool) error {
 	switch data.Kind {
 	case datatypes.Text:
-		return displayText(c.Name, data)
+		return displayText(name, data)
+	case datatypes.Login:
+		return displayLogin(name, data)
+	case datatypes.Card:
+		return displayCard(name, data, reveal)
+	case datatypes.File:
+		_, err := displayFile(name, data)
+		return err
+	case datatypes.TOTP:
+		return displayTOTP(name, data)
 	default:
 		fmt.Println("Unknown data type")
 	}
@@ -47,3 +70,137 @@ func displayText(name string, data *pamclient.GetResponse) error {
 
 	return nil
 }
+
+func displayLogin(name string, data *pamclient.GetResponse) error {
+	login, err := datatypes.UnmarshalLogin(data.Data)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s:\n", name)
+
+	fmt.Printf("Username: %s\n", login.Username)
+	fmt.Printf("Password: %s\n", login.Password)
+	if len(login.URLs) != 0 {
+		fmt.Printf("URLs: %s\n", strings.Join(login.URLs, ", "))
+	}
+	if login.Notes != "" {
+		fmt.Printf("Notes: %s\n", login.Notes)
+	}
+
+	return nil
+}
+
+func displayCard(name string, data *pamclient.GetResponse, reveal bool) error {
+	card, err := datatypes.UnmarshalCard(data.Data)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s:\n", name)
+
+	if reveal {
+		fmt.Printf("Number: %s\n", card.FormattedNumber())
+	} else {
+		fmt.Printf("Number: %s\n", card.MaskedNumber())
+	}
+	fmt.Printf("Holder: %s\n", card.Holder)
+	fmt.Printf("Expiry: %s\n", card.Expiry)
+	if reveal {
+		fmt.Printf("CVV: %s\n", card.CVV)
+		if card.PIN != "" {
+			fmt.Printf("PIN: %s\n", card.PIN)
+		}
+	} else {
+		fmt.Println("CVV: ***")
+		if card.PIN != "" {
+			fmt.Println("PIN: ****")
+		}
+		fmt.Println("Use --reveal to show the full card details")
+	}
+
+	return nil
+}
+
+func displayFile(name string, data *pamclient.GetResponse) (*datatypes.FileData, error) {
+	info, err := datatypes.UnmarshalFile(data.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("%s:\n", name)
+	fmt.Printf("File: %s (%d bytes, mode %s)\n", info.Filename, info.Size, os.FileMode(info.Mode))
+
+	return info, nil
+}
+
+func (c *GetCmd) saveFile(ctx context.Context, s *state.State, data *pamclient.GetResponse) error {
+	info, err := displayFile(c.Name, data)
+	if err != nil {
+		return err
+	}
+
+	if c.Out == "" {
+		fmt.Println("Use --out <path> to save the file")
+		return nil
+	}
+
+	out := c.Out
+	if stat, err := os.Stat(out); err == nil && stat.IsDir() {
+		out = filepath.Join(out, filepath.Base(info.Filename))
+	}
+
+	// downloaded next to the destination first, a failed download never leaves a partial file behind
+	file, err := os.CreateTemp(filepath.Dir(out), "."+filepath.Base(out)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if err = s.DownloadFile(ctx, c.Name, file); err != nil {
+		if errors.Is(err, pamclient.ErrUnavailable) {
+			fmt.Println("The server is unreachable, file contents are not kept offline")
+			return nil
+		}
+		return err
+	}
+
+	if err = file.Chmod(os.FileMode(info.Mode)); err != nil {
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(file.Name(), out); err != nil {
+		return err
+	}
+
+	fmt.Printf("Saved to %s\n", out)
+	return nil
+}
+
+func displayTOTP(name string, data *pamclient.GetResponse) error {
+	totp, err := datatypes.UnmarshalTOTP(data.Data)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s:\n", name)
+
+	if totp.Issuer != "" {
+		fmt.Printf("Issuer: %s\n", totp.Issuer)
+	}
+	if totp.Account != "" {
+		fmt.Printf("Account: %s\n", totp.Account)
+	}
+
+	now := time.Now()
+	code, err := totp.Code(now)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Code: %s (expires in %ds)\n", code, int(totp.Remaining(now).Seconds()))
+
+	return nil
+}
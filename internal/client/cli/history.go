@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/smakimka/pam/internal/client/pamclient"
+	"github.com/smakimka/pam/internal/client/state"
+	"github.com/smakimka/pam/internal/datatypes"
+)
+
+type HistoryCmd struct {
+	Name    string `arg:"" help:"Name of the data"`
+	Version int    `help:"Show the data of this version instead of listing versions"`
+	Reveal  bool   `help:"Show full card number, CVV and PIN instead of masking them"`
+}
+
+func (c *HistoryCmd) Run(ctx context.Context, s *state.State) error {
+	if c.Version != 0 {
+		return c.showVersion(ctx, s)
+	}
+
+	versions, err := s.ListVersions(ctx, c.Name)
+	if err != nil {
+		if errors.Is(err, pamclient.ErrUnauthenticated) {
+			fmt.Println("Please authenticate using the auth command, your token probably expired")
+			return nil
+		}
+
+		if errors.Is(err, pamclient.ErrDataDoesNotExist) {
+			fmt.Println("This data doesn't exist")
+			return nil
+		}
+
+		return err
+	}
+
+	fmt.Printf("Versions of %s:\n", c.Name)
+	for _, v := range versions {
+		if v.Current {
+			fmt.Printf("%d. %s (current)\n", v.Version, kindName(v.Kind))
+			continue
+		}
+
+		fmt.Printf("%d. %s, replaced at %s\n", v.Version, kindName(v.Kind), v.ReplacedAt.Local().Format("2006-01-02 15:04:05"))
+	}
+
+	return nil
+}
+
+func (c *HistoryCmd) showVersion(ctx context.Context, s *state.State) error {
+	data, err := s.GetVersion(ctx, c.Name, c.Version)
+	if err != nil {
+		if errors.Is(err, pamclient.ErrUnauthenticated) {
+			fmt.Println("Please authenticate using the auth command, your token probably expired")
+			return nil
+		}
+
+		if errors.Is(err, pamclient.ErrVersionDoesNotExist) {
+			fmt.Println("This version doesn't exist")
+			return nil
+		}
+
+		return err
+	}
+
+	fmt.Printf("Version %d of ", c.Version)
+	if err = displayData(c.Name, data, c.Reveal); err != nil {
+		return err
+	}
+
+	if data.Kind == datatypes.File {
+		fmt.Println("Restore this version to download the file")
+	}
+
+	return nil
+}
+
+type RestoreCmd struct {
+	Name    string `arg:"" help:"Name of the data"`
+	Version int    `required:"" help:"Version to restore, see the history command"`
+}
+
+func (c *RestoreCmd) Run(ctx context.Context, s *state.State) error {
+	version, err := s.Restore(ctx, c.Name, c.Version)
+	if err != nil {
+		if errors.Is(err, pamclient.ErrUnauthenticated) {
+			fmt.Println("Please authenticate using the auth command, your token probably expired")
+			return nil
+		}
+
+		if errors.Is(err, pamclient.ErrDataDoesNotExist) {
+			fmt.Println("This data doesn't exist")
+			return nil
+		}
+
+		if errors.Is(err, pamclient.ErrVersionDoesNotExist) {
+			fmt.Println("This version doesn't exist")
+			return nil
+		}
+
+		return err
+	}
+
+	fmt.Printf("Ok, restored as version %d\n", version)
+	return nil
+}
+
+func kindName(kind int) string {
+	switch kind {
+	case datatypes.Text:
+		return "text"
+	case datatypes.Login:
+		return "login"
+	case datatypes.Card:
+		return "card"
+	case datatypes.File:
+		return "file"
+	case datatypes.TOTP:
+		return "totp"
+	default:
+		return "unknown"
+	}
+}
+
+func kindByName(name string) (int, bool) {
+	for _, kind := range []int{datatypes.Text, datatypes.Login, datatypes.Card, datatypes.File, datatypes.TOTP} {
+		if kindName(kind) == name {
+			return kind, true
+		}
+	}
+
+	return 0, false
+}
@@ -4,21 +4,68 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/smakimka/pam/internal/client/pamclient"
 	"github.com/smakimka/pam/internal/client/state"
 )
 
-type ListCmd struct{}
+// listPageSize размер страницы, которыми список загружается, если лимит не задан
+const listPageSize = 500
+
+type ListCmd struct {
+	Long     bool `short:"l" help:"Show type, folder, tags and last update time"`
+	ByFolder bool `help:"Group data by folder"`
+
+	Prefix string `help:"Show only data with names starting with the prefix"`
+	Type   string `help:"Show only data of this type (text, login, card, file, totp)"`
+	Tag    string `help:"Show only data with this tag"`
+	Sort   string `enum:"folder,name,created,updated" default:"folder" help:"Sort by folder, name, created or updated time, newest first"`
+	Limit  int    `help:"Show at most this many entries, 0 shows everything"`
+	Cursor string `help:"Cursor of the next page, printed when the output is limited"`
+}
 
 func (c *ListCmd) Run(ctx context.Context, s *state.State) error {
-	names, err := s.List(ctx)
+	opts := pamclient.ListOptions{
+		Prefix: c.Prefix,
+		Tag:    c.Tag,
+		Sort:   c.Sort,
+		Limit:  c.Limit,
+		Cursor: c.Cursor,
+	}
+
+	if c.Type != "" {
+		kind, ok := kindByName(c.Type)
+		if !ok {
+			fmt.Println("no such data type, available are: text, login, card, file, totp")
+			return nil
+		}
+		opts.Kind = &kind
+	}
+
+	if c.ByFolder && c.Sort != "folder" {
+		fmt.Println("--by-folder can only be used with the default folder sort")
+		return nil
+	}
+
+	if c.Limit < 0 {
+		fmt.Println("--limit can't be negative")
+		return nil
+	}
+
+	infos, next, err := c.list(ctx, s, opts)
 	if err != nil {
 		if errors.Is(err, pamclient.ErrUnauthenticated) {
 			fmt.Println("Please authenticate using the auth command, your token probably expired")
 			return nil
 		}
 
+		if errors.Is(err, pamclient.ErrInvalidCursor) {
+			fmt.Println("Invalid cursor, it must come from a list with the same sort")
+			return nil
+		}
+
 		if errors.Is(err, pamclient.ErrDataDoesNotExist) {
 			fmt.Println("This data doesn't exist")
 			return nil
@@ -28,9 +75,75 @@ func (c *ListCmd) Run(ctx context.Context, s *state.State) error {
 	}
 
 	fmt.Println("Your data names:")
-	for i, name := range names {
-		fmt.Printf("%d. %s\n", i+1, name)
+	if !c.ByFolder {
+		for i, info := range infos {
+			c.printInfo(i+1, info)
+		}
+		c.printNext(next)
+		return nil
+	}
+
+	// the server returns data ordered by folder, so groups are contiguous
+	folder := ""
+	for i, info := range infos {
+		if i == 0 || info.Folder != folder {
+			folder = info.Folder
+			if folder == "" {
+				fmt.Println("(no folder):")
+			} else {
+				fmt.Printf("%s:\n", folder)
+			}
+		}
+		fmt.Print("  ")
+		c.printInfo(i+1, info)
 	}
+	c.printNext(next)
 
 	return nil
 }
+
+// list загружает одну страницу, если задан лимит, иначе все страницы подряд
+func (c *ListCmd) list(ctx context.Context, s *state.State, opts pamclient.ListOptions) ([]pamclient.DataInfo, string, error) {
+	if opts.Limit > 0 {
+		return s.List(ctx, opts)
+	}
+
+	infos := []pamclient.DataInfo{}
+	opts.Limit = listPageSize
+	for {
+		page, next, err := s.List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+
+		infos = append(infos, page...)
+		if next == "" {
+			return infos, "", nil
+		}
+		opts.Cursor = next
+	}
+}
+
+func (c *ListCmd) printNext(next string) {
+	if next != "" {
+		fmt.Printf("There is more, add --cursor %s to see the next page\n", next)
+	}
+}
+
+func (c *ListCmd) printInfo(n int, info pamclient.DataInfo) {
+	if !c.Long {
+		fmt.Printf("%d. %s\n", n, info.Name)
+		return
+	}
+
+	var extra []string
+	if info.Folder != "" && !c.ByFolder {
+		extra = append(extra, "folder: "+info.Folder)
+	}
+	if len(info.Tags) > 0 {
+		extra = append(extra, "tags: "+strings.Join(info.Tags, ", "))
+	}
+	extra = append(extra, "updated "+info.UpdatedAt.Local().Format(time.DateTime))
+
+	fmt.Printf("%d. %s [%s] (%s)\n", n, info.Name, kindName(info.Kind), strings.Join(extra, "; "))
+}
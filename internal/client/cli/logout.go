@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/smakimka/pam/internal/client/pamclient"
+	"github.com/smakimka/pam/internal/client/state"
+)
+
+type LogoutCmd struct{}
+
+func (c *LogoutCmd) Run(ctx context.Context, s *state.State) error {
+	err := s.Logout(ctx)
+	if err != nil {
+		if errors.Is(err, pamclient.ErrUnauthenticated) {
+			fmt.Println("You are not logged in")
+			return nil
+		}
+
+		if errors.Is(err, pamclient.ErrUnavailable) {
+			fmt.Println("The server is unreachable, the token can't be revoked, try again later")
+			return nil
+		}
+
+		return err
+	}
+
+	fmt.Println("Ok")
+	return nil
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/smakimka/pam/internal/client/pamclient"
+	"github.com/smakimka/pam/internal/client/state"
+	"github.com/smakimka/pam/internal/datatypes"
+)
+
+type OtpCmd struct {
+	Name  string `arg:"" help:"Name of the TOTP secret"`
+	Watch bool   `help:"Keep showing new codes until interrupted, without it a terminal shows the code until it expires"`
+}
+
+func (c *OtpCmd) Run(ctx context.Context, s *state.State) error {
+	data, err := s.Get(ctx, c.Name)
+	if err != nil {
+		if errors.Is(err, pamclient.ErrUnauthenticated) {
+			fmt.Println("Please authenticate using the auth command, your token probably expired")
+			return nil
+		}
+
+		if errors.Is(err, pamclient.ErrDataDoesNotExist) {
+			fmt.Println("This data doesn't exist")
+			return nil
+		}
+
+		return err
+	}
+
+	if data.Kind != datatypes.TOTP {
+		fmt.Println("This data is not a TOTP secret")
+		return nil
+	}
+
+	totp, err := datatypes.UnmarshalTOTP(data.Data)
+	if err != nil {
+		return err
+	}
+
+	// a pipe or a file gets plain lines, the countdown is redrawn only on a terminal
+	interactive := term.IsTerminal(syscall.Stdout)
+
+	now := time.Now()
+	code, err := totp.Code(now)
+	if err != nil {
+		return err
+	}
+
+	if !interactive {
+		fmt.Printf("%s expires in %ds\n", code, int(totp.Remaining(now).Seconds()))
+		if !c.Watch {
+			return nil
+		}
+	}
+
+	// Ctrl+C ends the countdown cleanly, it is caught only here so that prompts elsewhere can still be interrupted
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		current, err := totp.Code(now)
+		if err != nil {
+			return err
+		}
+
+		if current != code {
+			if !c.Watch {
+				fmt.Println()
+				return nil
+			}
+
+			code = current
+			if interactive {
+				fmt.Println()
+			} else {
+				fmt.Printf("%s expires in %ds\n", code, int(totp.Remaining(now).Seconds()))
+			}
+		}
+
+		if interactive {
+			fmt.Printf("\r%s expires in %2ds", code, int(totp.Remaining(now).Seconds()))
+		}
+
+		select {
+		case <-ctx.Done():
+			if interactive {
+				fmt.Println()
+			}
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/smakimka/pam/internal/client/pamclient"
+	"github.com/smakimka/pam/internal/client/state"
+)
+
+type PasswdCmd struct{}
+
+func (c *PasswdCmd) Run(ctx context.Context, s *state.State) error {
+	err := s.ChangePassword(ctx)
+	if err != nil {
+		if errors.Is(err, pamclient.ErrUnauthenticated) {
+			fmt.Println("Please authenticate using the auth command, your token probably expired")
+			return nil
+		}
+
+		if errors.Is(err, state.ErrPwdMismatch) {
+			fmt.Println("Passwords don't match")
+			return nil
+		}
+
+		if errors.Is(err, pamclient.ErrWrongPassword) {
+			fmt.Println("Wrong password")
+			return nil
+		}
+
+		var tooMany *pamclient.TooManyAttemptsError
+		if errors.As(err, &tooMany) {
+			printTooManyAttempts(tooMany)
+			return nil
+		}
+
+		if errors.Is(err, pamclient.ErrUnavailable) {
+			fmt.Println("The server is unreachable, try again later")
+			return nil
+		}
+
+		return err
+	}
+
+	fmt.Println("Ok, all other sessions were revoked. The master password stays the same")
+	return nil
+}
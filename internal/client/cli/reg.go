@@ -18,6 +18,12 @@ func (c *RegCmd) Run(ctx context.Context, state *state.State) error {
 			fmt.Println("\nThis username is taken")
 			return nil
 		}
+
+		var tooMany *pamclient.TooManyAttemptsError
+		if errors.As(err, &tooMany) {
+			printTooManyAttempts(tooMany)
+			return nil
+		}
 		return err
 	}
 
@@ -4,6 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/smakimka/pam/internal/client/pamclient"
 	"github.com/smakimka/pam/internal/client/state"
@@ -11,42 +16,346 @@ import (
 )
 
 type RemCmd struct {
-	DataType string `arg:"" help:"what type of data to remember.Options (text)"`
+	DataType string `arg:"" help:"what type of data to remember.Options (text, login, card, file, totp)"`
+	Path     string `arg:"" optional:"" type:"existingfile" help:"Path to the file to remember (file)"`
+
+	Name     string   `help:"Name of the data, asked interactively if not set"`
+	Username string   `help:"Username (login)"`
+	Password string   `help:"Password (login), asked interactively if not set"`
+	URL      []string `name:"url" help:"URL where the login is used, can be repeated (login)"`
+	Notes    string   `help:"Notes (login)"`
+
+	Number string `help:"Card number (card)"`
+	Holder string `help:"Card holder name (card)"`
+	Expiry string `help:"Card expiry date as MM/YY (card)"`
+	CVV    string `name:"cvv" help:"Card CVV, asked interactively if not set (card)"`
+	PIN    string `name:"pin" help:"Card PIN (card)"`
+
+	Secret string `help:"Base32 TOTP secret or otpauth:// URI, asked interactively if not set (totp)"`
+
+	Folder string   `help:"Folder to put the data in"`
+	Tag    []string `help:"Tag to mark the data with, can be repeated"`
+
+	Force bool `help:"Overwrite existing data with the same name without asking"`
 }
 
 func (c *RemCmd) Run(ctx context.Context, s *state.State) error {
 	switch c.DataType {
 	case "text":
-		return rememberText(ctx, s)
+		return c.rememberText(ctx, s)
+	case "login":
+		return c.rememberLogin(ctx, s)
+	case "card":
+		return c.rememberCard(ctx, s)
+	case "file":
+		return c.rememberFile(ctx, s)
+	case "totp":
+		return c.rememberTOTP(ctx, s)
 	default:
-		fmt.Println("no such data type, available are: text")
+		fmt.Println("no such data type, available are: text, login, card, file, totp")
+	}
+	return nil
+}
+
+func (c *RemCmd) readName() (string, error) {
+	if c.Name != "" {
+		return c.Name, nil
+	}
+
+	name, err := readLine("Enter name: ")
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return "", errors.New("name can't be empty")
+	}
+
+	return name, nil
+}
+
+func (c *RemCmd) rememberText(ctx context.Context, s *state.State) error {
+	name, err := c.readName()
+	if err != nil {
+		return err
+	}
+
+	text, err := readLine("Enter text: ")
+	if err != nil {
+		return err
+	}
+
+	return c.upload(ctx, s, name, datatypes.Text, []byte(text))
+}
+
+func (c *RemCmd) rememberLogin(ctx context.Context, s *state.State) error {
+	name, err := c.readName()
+	if err != nil {
+		return err
+	}
+
+	login := &datatypes.LoginData{
+		Username: c.Username,
+		Password: c.Password,
+		URLs:     c.URL,
+		Notes:    c.Notes,
+	}
+
+	// When the username comes from flags, only a missing password is asked for
+	interactive := c.Username == ""
+
+	if login.Username == "" {
+		if login.Username, err = readLine("Enter username: "); err != nil {
+			return err
+		}
+	}
+
+	if login.Password == "" {
+		if login.Password, err = readSecret("Enter password: "); err != nil {
+			return err
+		}
+	}
+
+	if interactive && len(login.URLs) == 0 {
+		urls, err := readLine("Enter URLs (comma separated, may be empty): ")
+		if err != nil {
+			return err
+		}
+
+		for _, url := range strings.Split(urls, ",") {
+			if url = strings.TrimSpace(url); url != "" {
+				login.URLs = append(login.URLs, url)
+			}
+		}
+	}
+
+	if interactive && login.Notes == "" {
+		if login.Notes, err = readLine("Enter notes (may be empty): "); err != nil {
+			return err
+		}
+	}
+
+	data, err := login.Marshal()
+	if err != nil {
+		return err
+	}
+
+	return c.upload(ctx, s, name, datatypes.Login, data)
+}
+
+func (c *RemCmd) rememberCard(ctx context.Context, s *state.State) error {
+	name, err := c.readName()
+	if err != nil {
+		return err
+	}
+
+	card := &datatypes.CardData{
+		Number: c.Number,
+		Holder: c.Holder,
+		Expiry: c.Expiry,
+		CVV:    c.CVV,
+		PIN:    c.PIN,
+	}
+
+	// PIN is optional, so it is only asked for when the card isn't given by flags
+	interactive := c.Number == ""
+
+	if card.Number == "" {
+		if card.Number, err = readLine("Enter card number: "); err != nil {
+			return err
+		}
+	}
+
+	if card.Holder == "" {
+		if card.Holder, err = readLine("Enter card holder: "); err != nil {
+			return err
+		}
+	}
+
+	if card.Expiry == "" {
+		if card.Expiry, err = readLine("Enter expiry date (MM/YY): "); err != nil {
+			return err
+		}
+	}
+
+	if card.CVV == "" {
+		if card.CVV, err = readSecret("Enter CVV: "); err != nil {
+			return err
+		}
+	}
+
+	if interactive && card.PIN == "" {
+		if card.PIN, err = readSecret("Enter PIN (may be empty): "); err != nil {
+			return err
+		}
+	}
+
+	card.Normalize()
+	if err = card.Validate(time.Now()); err != nil {
+		fmt.Printf("Invalid card: %s\n", err)
+		return nil
+	}
+
+	data, err := card.Marshal()
+	if err != nil {
+		return err
+	}
+
+	return c.upload(ctx, s, name, datatypes.Card, data)
+}
+
+func (c *RemCmd) rememberFile(ctx context.Context, s *state.State) error {
+	if c.Path == "" {
+		fmt.Println("Please specify the path to the file: pam rem file <path>")
+		return nil
+	}
+
+	file, err := os.Open(c.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if !stat.Mode().IsRegular() {
+		fmt.Println("Only regular files can be remembered")
+		return nil
+	}
+
+	name, err := c.readName()
+	if err != nil {
+		return err
+	}
+
+	info := &datatypes.FileData{
+		Filename: filepath.Base(c.Path),
+		Mode:     uint32(stat.Mode().Perm()),
+		Size:     stat.Size(),
+	}
+
+	data, err := info.Marshal()
+	if err != nil {
+		return err
+	}
+
+	revision := c.revision()
+	meta := c.meta()
+	for {
+		_, err = s.UploadFile(ctx, name, data, meta, revision, file)
+		if !errors.Is(err, pamclient.ErrRevisionConflict) {
+			break
+		}
+
+		current, err := s.Get(ctx, name)
+		if errors.Is(err, pamclient.ErrDataDoesNotExist) {
+			revision = 0
+		} else if err != nil {
+			return err
+		} else {
+			choice, err := resolveConflict(name, revision, current, false)
+			if err != nil {
+				return err
+			}
+			if choice != choiceOverwrite {
+				fmt.Println("Cancelled")
+				return nil
+			}
+
+			revision = current.Revision
+			meta = inheritMeta(meta, current.Meta)
+		}
+
+		if _, err = file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		if errors.Is(err, pamclient.ErrUnauthenticated) {
+			fmt.Println("Please authenticate using the auth command, your token probably expired")
+			return nil
+		}
+
+		if errors.Is(err, pamclient.ErrUnavailable) {
+			fmt.Println("The server is unreachable, files can only be remembered online")
+			return nil
+		}
+		return err
 	}
+
+	fmt.Println("Ok")
 	return nil
 }
 
-func rememberText(ctx context.Context, s *state.State) error {
-	var name string
-	fmt.Print("Enter name: ")
-	_, err := fmt.Scanln(&name)
+func (c *RemCmd) rememberTOTP(ctx context.Context, s *state.State) error {
+	name, err := c.readName()
 	if err != nil {
 		return err
 	}
 
-	var text string
-	fmt.Print("Enter text: ")
-	_, err = fmt.Scanln(&text)
+	secret := c.Secret
+	if secret == "" {
+		if secret, err = readSecret("Enter secret or otpauth:// URI: "); err != nil {
+			return err
+		}
+	}
+
+	var totp *datatypes.TOTPData
+	if strings.HasPrefix(secret, "otpauth://") {
+		totp, err = datatypes.ParseOTPAuthURI(secret)
+	} else {
+		totp = datatypes.NewTOTP(secret)
+		err = totp.Validate()
+	}
+	if err != nil {
+		fmt.Printf("Invalid TOTP secret: %s\n", err)
+		return nil
+	}
+
+	data, err := totp.Marshal()
 	if err != nil {
 		return err
 	}
 
-	if err = s.Upload(ctx, name, datatypes.Text, []byte(text)); err != nil {
+	return c.upload(ctx, s, name, datatypes.TOTP, data)
+}
+
+// revision возвращает ревизию, которую ожидаем при сохранении: новые данные не должны перезаписывать
+// существующие без спроса
+func (c *RemCmd) revision() int {
+	if c.Force {
+		return pamclient.AnyRevision
+	}
+
+	return 0
+}
+
+// meta возвращает папку и теги, заданные флагами
+func (c *RemCmd) meta() pamclient.Meta {
+	return pamclient.Meta{Folder: c.Folder, Tags: c.Tag}
+}
+
+func (c *RemCmd) upload(ctx context.Context, s *state.State, name string, kind int, data []byte) error {
+	saved, err := uploadResolvingConflicts(ctx, s, name, kind, data, c.meta(), c.revision())
+	if err != nil {
 		if errors.Is(err, pamclient.ErrUnauthenticated) {
 			fmt.Println("Please authenticate using the auth command, your token probably expired")
 			return nil
 		}
+
+		if errors.Is(err, state.ErrQueued) {
+			fmt.Println("The server is unreachable, the data is saved locally and will be uploaded on the next sync")
+			return nil
+		}
 		return err
 	}
 
+	if !saved {
+		fmt.Println("Cancelled")
+		return nil
+	}
+
 	fmt.Println("Ok")
 	return nil
 }
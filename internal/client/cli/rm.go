@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/smakimka/pam/internal/client/pamclient"
+	"github.com/smakimka/pam/internal/client/state"
+)
+
+type RmCmd struct {
+	Name string `arg:"" help:"Name of the data to delete"`
+	Yes  bool   `short:"y" help:"Don't ask for confirmation"`
+}
+
+func (c *RmCmd) Run(ctx context.Context, s *state.State) error {
+	if !c.Yes {
+		answer, err := readLine(fmt.Sprintf("Delete %s? This can't be undone [y/N]: ", c.Name))
+		if err != nil {
+			return err
+		}
+
+		if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+			fmt.Println("Cancelled")
+			return nil
+		}
+	}
+
+	err := s.Delete(ctx, c.Name)
+	if err != nil {
+		if errors.Is(err, pamclient.ErrUnauthenticated) {
+			fmt.Println("Please authenticate using the auth command, your token probably expired")
+			return nil
+		}
+
+		if errors.Is(err, pamclient.ErrDataDoesNotExist) {
+			fmt.Println("This data doesn't exist")
+			return nil
+		}
+
+		if errors.Is(err, state.ErrQueued) {
+			fmt.Println("The server is unreachable, the data will be deleted on the next sync")
+			return nil
+		}
+
+		return err
+	}
+
+	fmt.Println("Ok")
+	return nil
+}
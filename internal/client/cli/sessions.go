@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/smakimka/pam/internal/client/pamclient"
+	"github.com/smakimka/pam/internal/client/state"
+)
+
+type SessionsCmd struct {
+	List   SessionsListCmd   `cmd:"" default:"1" help:"List active sessions"`
+	Revoke SessionsRevokeCmd `cmd:"" help:"Revoke a session, for example of a lost device"`
+}
+
+type SessionsListCmd struct{}
+
+func (c *SessionsListCmd) Run(ctx context.Context, s *state.State) error {
+	sessions, err := s.ListSessions(ctx)
+	if err != nil {
+		if errors.Is(err, pamclient.ErrUnauthenticated) {
+			fmt.Println("Please authenticate using the auth command, your token probably expired")
+			return nil
+		}
+
+		return err
+	}
+
+	fmt.Println("Active sessions:")
+	for _, session := range sessions {
+		current := ""
+		if session.Current {
+			current = " (this session)"
+		}
+
+		ip := session.IP
+		if ip == "" {
+			ip = "unknown address"
+		}
+
+		fmt.Printf("%d. %s, %s%s\n", session.ID, ip, session.UserAgent, current)
+		fmt.Printf("   created %s, last used %s, expires %s\n",
+			session.CreatedAt.Local().Format(time.DateTime),
+			session.LastUsedAt.Local().Format(time.DateTime),
+			session.ExpiresAt.Local().Format(time.DateTime))
+	}
+
+	return nil
+}
+
+type SessionsRevokeCmd struct {
+	ID int `arg:"" help:"Id of the session from the sessions list"`
+}
+
+func (c *SessionsRevokeCmd) Run(ctx context.Context, s *state.State) error {
+	err := s.RevokeSession(ctx, c.ID)
+	if err != nil {
+		if errors.Is(err, pamclient.ErrUnauthenticated) {
+			fmt.Println("Please authenticate using the auth command, your token probably expired")
+			return nil
+		}
+
+		if errors.Is(err, pamclient.ErrTokenDoesNotExist) {
+			fmt.Println("This session doesn't exist or is already revoked")
+			return nil
+		}
+
+		return err
+	}
+
+	fmt.Println("Ok")
+	return nil
+}
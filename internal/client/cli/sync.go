@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/smakimka/pam/internal/client/pamclient"
+	"github.com/smakimka/pam/internal/client/state"
+)
+
+type SyncCmd struct {
+	Overwrite bool `xor:"conflicts" help:"Overwrite data changed by someone else with your offline changes"`
+	Discard   bool `xor:"conflicts" help:"Drop offline changes that conflict with data changed by someone else"`
+}
+
+func (c *SyncCmd) Run(ctx context.Context, s *state.State) error {
+	policy := state.KeepConflicts
+	switch {
+	case c.Overwrite:
+		policy = state.OverwriteConflicts
+	case c.Discard:
+		policy = state.DiscardConflicts
+	}
+
+	res, err := s.Sync(ctx, policy)
+	if err != nil {
+		if errors.Is(err, pamclient.ErrUnauthenticated) {
+			fmt.Println("Please authenticate using the auth command, your token probably expired")
+			return nil
+		}
+
+		if errors.Is(err, pamclient.ErrUnavailable) {
+			fmt.Println("The server is unreachable, try again later")
+			return nil
+		}
+
+		return err
+	}
+
+	fmt.Printf("Uploaded %d, received %d changes\n", res.Pushed, res.Pulled)
+	if len(res.Conflicts) > 0 {
+		fmt.Printf("These offline changes conflict with data changed by someone else: %s\n", strings.Join(res.Conflicts, ", "))
+		fmt.Println("Use --overwrite to upload them anyway or --discard to drop them")
+	}
+
+	return nil
+}
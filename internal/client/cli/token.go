@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/smakimka/pam/internal/client/pamclient"
+	"github.com/smakimka/pam/internal/client/state"
+)
+
+type TokenCmd struct {
+	Create TokenCreateCmd `cmd:"" help:"Create an API token with limited access, for example for CI"`
+	List   TokenListCmd   `cmd:"" default:"1" help:"List API tokens"`
+	Revoke TokenRevokeCmd `cmd:"" help:"Revoke an API token"`
+}
+
+type TokenCreateCmd struct {
+	Description string        `short:"d" help:"What the token is for"`
+	Write       bool          `help:"Allow changing and deleting data, the token is read-only by default"`
+	Prefix      []string      `help:"Allow only data with names starting with the prefix, can be repeated"`
+	Expires     time.Duration `help:"Revoke the token automatically after this time, for example 720h, never by default"`
+}
+
+func (c *TokenCreateCmd) Run(ctx context.Context, s *state.State) error {
+	opts := pamclient.ApiTokenOptions{
+		Description: c.Description,
+		Write:       c.Write,
+		Prefixes:    c.Prefix,
+	}
+	if c.Expires > 0 {
+		opts.ExpiresAt = time.Now().Add(c.Expires)
+	}
+
+	id, token, err := s.CreateApiToken(ctx, opts)
+	if err != nil {
+		if errors.Is(err, pamclient.ErrUnauthenticated) {
+			fmt.Println("Please authenticate using the auth command, your token probably expired")
+			return nil
+		}
+
+		if errors.Is(err, pamclient.ErrNotAllowed) {
+			fmt.Println("API tokens can't create other tokens, authenticate using the auth command")
+			return nil
+		}
+
+		return err
+	}
+
+	fmt.Printf("Created token %d, it is shown only once:\n%s\n", id, token)
+	fmt.Printf("Pass it in the %s environment variable\n", state.TokenEnv)
+	return nil
+}
+
+type TokenListCmd struct{}
+
+func (c *TokenListCmd) Run(ctx context.Context, s *state.State) error {
+	tokens, err := s.ListApiTokens(ctx)
+	if err != nil {
+		if errors.Is(err, pamclient.ErrUnauthenticated) {
+			fmt.Println("Please authenticate using the auth command, your token probably expired")
+			return nil
+		}
+
+		if errors.Is(err, pamclient.ErrNotAllowed) {
+			fmt.Println("API tokens can't list tokens, authenticate using the auth command")
+			return nil
+		}
+
+		return err
+	}
+
+	if len(tokens) == 0 {
+		fmt.Println("No API tokens")
+		return nil
+	}
+
+	fmt.Println("API tokens:")
+	for _, token := range tokens {
+		access := "read-only"
+		if token.Write {
+			access = "read-write"
+		}
+
+		names := "all data"
+		if len(token.Prefixes) > 0 {
+			names = "data starting with " + strings.Join(token.Prefixes, ", ")
+		}
+
+		description := token.Description
+		if description == "" {
+			description = "no description"
+		}
+
+		expires := "never"
+		if !token.ExpiresAt.IsZero() {
+			expires = token.ExpiresAt.Local().Format(time.DateTime)
+		}
+
+		lastUsed := "never"
+		if !token.LastUsedAt.IsZero() {
+			lastUsed = token.LastUsedAt.Local().Format(time.DateTime)
+		}
+
+		fmt.Printf("%d. %s: %s, %s\n", token.ID, description, access, names)
+		fmt.Printf("   created %s, last used %s, expires %s\n",
+			token.CreatedAt.Local().Format(time.DateTime), lastUsed, expires)
+	}
+
+	return nil
+}
+
+type TokenRevokeCmd struct {
+	ID int `arg:"" help:"Id of the token from the token list"`
+}
+
+func (c *TokenRevokeCmd) Run(ctx context.Context, s *state.State) error {
+	err := s.RevokeSession(ctx, c.ID)
+	if err != nil {
+		if errors.Is(err, pamclient.ErrUnauthenticated) {
+			fmt.Println("Please authenticate using the auth command, your token probably expired")
+			return nil
+		}
+
+		if errors.Is(err, pamclient.ErrTokenDoesNotExist) {
+			fmt.Println("This token doesn't exist or is already revoked")
+			return nil
+		}
+
+		return err
+	}
+
+	fmt.Println("Ok")
+	return nil
+}
@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/smakimka/pam/internal/client/pamclient"
+	"github.com/smakimka/pam/internal/client/state"
+)
+
+type TwoFactorCmd struct {
+	Enable        TwoFactorEnableCmd        `cmd:"" help:"Enable two-factor authentication with an authenticator app"`
+	Disable       TwoFactorDisableCmd       `cmd:"" help:"Disable two-factor authentication"`
+	RecoveryCodes TwoFactorRecoveryCodesCmd `cmd:"" name:"recovery-codes" help:"Replace all recovery codes with new ones"`
+}
+
+type TwoFactorEnableCmd struct{}
+
+func (c *TwoFactorEnableCmd) Run(ctx context.Context, s *state.State) error {
+	secret, uri, err := s.EnableTwoFactor(ctx)
+	if err != nil {
+		if errors.Is(err, pamclient.ErrTwoFactorEnabled) {
+			fmt.Println("Two-factor authentication is already enabled")
+			return nil
+		}
+
+		return printTwoFactorError(err)
+	}
+
+	fmt.Println("Add this secret to your authenticator app:")
+	fmt.Println(secret)
+	fmt.Println("or, if it supports otpauth:// links:")
+	fmt.Println(uri)
+
+	for {
+		code, err := readLine("Enter the code from the app to confirm: ")
+		if err != nil {
+			return err
+		}
+
+		recoveryCodes, err := s.ConfirmTwoFactor(ctx, code)
+		if errors.Is(err, pamclient.ErrWrongCode) {
+			fmt.Println("Wrong code, try again")
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Two-factor authentication is enabled. Save these recovery codes somewhere safe,")
+		fmt.Println("each can be used once instead of a code if you lose the app:")
+		for _, code := range recoveryCodes {
+			fmt.Println(code)
+		}
+
+		return nil
+	}
+}
+
+type TwoFactorDisableCmd struct{}
+
+func (c *TwoFactorDisableCmd) Run(ctx context.Context, s *state.State) error {
+	if err := s.DisableTwoFactor(ctx); err != nil {
+		return printTwoFactorError(err)
+	}
+
+	fmt.Println("Two-factor authentication is disabled")
+	return nil
+}
+
+type TwoFactorRecoveryCodesCmd struct{}
+
+func (c *TwoFactorRecoveryCodesCmd) Run(ctx context.Context, s *state.State) error {
+	recoveryCodes, err := s.RegenerateRecoveryCodes(ctx)
+	if err != nil {
+		return printTwoFactorError(err)
+	}
+
+	fmt.Println("The old recovery codes no longer work. Save these new ones somewhere safe:")
+	for _, code := range recoveryCodes {
+		fmt.Println(code)
+	}
+
+	return nil
+}
+
+// printTwoFactorError печатает понятное сообщение для ошибок изменения настроек 2FA,
+// остальные ошибки возвращает
+func printTwoFactorError(err error) error {
+	if errors.Is(err, pamclient.ErrUnauthenticated) {
+		fmt.Println("Please authenticate using the auth command, your token probably expired")
+		return nil
+	}
+
+	if errors.Is(err, pamclient.ErrWrongPassword) {
+		fmt.Println("Wrong password")
+		return nil
+	}
+
+	if errors.Is(err, pamclient.ErrWrongSecondFactor) {
+		fmt.Println("Wrong or already used two-factor code")
+		return nil
+	}
+
+	if errors.Is(err, pamclient.ErrTwoFactorDisabled) {
+		fmt.Println("Two-factor authentication is not enabled")
+		return nil
+	}
+
+	var tooMany *pamclient.TooManyAttemptsError
+	if errors.As(err, &tooMany) {
+		printTooManyAttempts(tooMany)
+		return nil
+	}
+
+	if errors.Is(err, pamclient.ErrUnavailable) {
+		fmt.Println("The server is unreachable, try again later")
+		return nil
+	}
+
+	return err
+}
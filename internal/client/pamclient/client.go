@@ -1,11 +1,43 @@
 package pamclient
 
-import "context"
+import (
+	"context"
+	"io"
+)
 
 type PamClient interface {
 	Register(ctx context.Context, username string, pwd string) (string, error)
-	Auth(ctx context.Context, username string, pwd string) (string, error)
+	Auth(ctx context.Context, username string, pwd string, otp string) (string, error)
 	Get(ctx context.Context, authToken string, name string) (*GetResponse, error)
-	List(ctx context.Context, authToken string) ([]string, error)
-	Upload(ctx context.Context, authToken string, name string, kind int, data []byte) error
+	List(ctx context.Context, authToken string, opts ListOptions) ([]DataInfo, string, error)
+	Upload(ctx context.Context, authToken string, name string, kind int, data []byte, meta Meta, revision int) (int, error)
+	Delete(ctx context.Context, authToken string, name string, revision int) error
+	ListVersions(ctx context.Context, authToken string, name string) ([]Version, error)
+	GetVersion(ctx context.Context, authToken string, name string, version int) (*GetResponse, error)
+	Restore(ctx context.Context, authToken string, name string, version int) (int, error)
+	UploadFile(ctx context.Context, authToken string, name string, info []byte, meta Meta, revision int, r io.Reader) (int, error)
+	DownloadFile(ctx context.Context, authToken string, name string, w io.Writer) error
+	GetVaultParams(ctx context.Context, authToken string) ([]byte, error)
+	SetVaultParams(ctx context.Context, authToken string, params []byte) error
+	Sync(ctx context.Context, authToken string, since int64) (*SyncResponse, error)
+	Logout(ctx context.Context, authToken string) error
+	RevokeToken(ctx context.Context, authToken string, token string) error
+	RevokeSession(ctx context.Context, authToken string, id int) error
+	ListSessions(ctx context.Context, authToken string) ([]Session, error)
+	// EnableTwoFactor проверяет пароль и возвращает новый секрет TOTP и otpauth:// URI для него
+	EnableTwoFactor(ctx context.Context, authToken string, pwd string) (string, string, error)
+	// ConfirmTwoFactor включает 2FA и возвращает коды восстановления
+	ConfirmTwoFactor(ctx context.Context, authToken string, code string) ([]string, error)
+	// DisableTwoFactor выключает 2FA, нужны пароль и одноразовый код или код восстановления
+	DisableTwoFactor(ctx context.Context, authToken string, pwd string, code string) error
+	// RegenerateRecoveryCodes заменяет коды восстановления новыми и возвращает их,
+	// нужны пароль и одноразовый код или код восстановления
+	RegenerateRecoveryCodes(ctx context.Context, authToken string, pwd string, code string) ([]string, error)
+	// ChangePassword меняет пароль, остальные токены пользователя отзываются
+	ChangePassword(ctx context.Context, authToken string, currentPwd string, newPwd string) error
+	// DeleteAccount удаляет аккаунт вместе со всеми данными на сервере
+	DeleteAccount(ctx context.Context, authToken string, pwd string) error
+	// CreateApiToken создает API токен и возвращает его id и сам токен
+	CreateApiToken(ctx context.Context, authToken string, opts ApiTokenOptions) (int, string, error)
+	ListApiTokens(ctx context.Context, authToken string) ([]ApiToken, error)
 }
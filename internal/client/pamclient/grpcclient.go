@@ -3,19 +3,168 @@ package pamclient
 import (
 	"context"
 	"errors"
+	"io"
+	"strings"
+	"time"
 
 	"github.com/smakimka/pam/internal/protobuf/pamserver"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 var ErrUnauthenticated = errors.New("unauthenticated")
 var ErrWrongCredentials = errors.New("wromg credentials")
 var ErrUsernameIsTaken = errors.New("this username is taken")
 var ErrDataDoesNotExist = errors.New("this data doesn't exist'")
+var ErrNotAFile = errors.New("this data is not a file")
+var ErrVersionDoesNotExist = errors.New("this version doesn't exist")
+var ErrRevisionConflict = errors.New("data was changed by someone else")
+var ErrVaultNotInitialized = errors.New("vault is not initialized")
+var ErrVaultAlreadyInitialized = errors.New("vault is already initialized")
+var ErrInvalidCursor = errors.New("invalid cursor")
+var ErrUnavailable = errors.New("server is unreachable")
+var ErrTokenDoesNotExist = errors.New("this token doesn't exist")
+var ErrSecondFactorRequired = errors.New("second factor required")
+var ErrWrongSecondFactor = errors.New("wrong second factor code")
+var ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+var ErrTwoFactorDisabled = errors.New("two-factor authentication is not enabled")
+var ErrWrongCode = errors.New("wrong code")
+var ErrWrongPassword = errors.New("wrong password")
+var ErrNotAllowed = errors.New("the token doesn't allow this")
+var ErrTooManyAttempts = errors.New("too many attempts, try again later")
+
+// TooManyAttemptsError сервер временно не принимает попытки входа с этого адреса или для этого пользователя,
+// RetryAfter - через сколько можно попробовать снова, 0 если сервер не сообщил
+type TooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TooManyAttemptsError) Error() string {
+	return ErrTooManyAttempts.Error()
+}
+
+func (e *TooManyAttemptsError) Is(target error) bool {
+	return target == ErrTooManyAttempts
+}
+
+func tooManyAttempts(err error) error {
+	tooMany := &TooManyAttemptsError{}
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			tooMany.RetryAfter = info.RetryDelay.AsDuration()
+		}
+	}
+
+	return tooMany
+}
+
+// notAllowed сервер отказал, потому что API токен не дает прав на этот запрос или на эти данные
+func notAllowed(err error) bool {
+	return status.Code(err) == codes.PermissionDenied && strings.HasPrefix(status.Convert(err).Message(), "token scope does not allow this")
+}
+
+// FileChunkSize размер чанка, которыми файлы передаются на сервер
+const FileChunkSize = 64 * 1024
+
+// AnyRevision передается вместо ожидаемой ревизии, чтобы перезаписать данные без проверки,
+// ревизия 0 означает, что данных с таким именем еще нет
+const AnyRevision = -1
+
+// Meta метаданные данных, которые задает пользователь, хранятся на сервере в открытом виде
+type Meta struct {
+	Folder string
+	Tags   []string
+}
 
 type GetResponse struct {
-	Kind int
-	Data []byte
+	Kind     int
+	Data     []byte
+	Revision int
+	Meta
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type DataInfo struct {
+	Name     string
+	Kind     int
+	Revision int
+	Meta
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// ListOptions фильтры, сортировка и пагинация списка данных, нулевое значение - все данные
+type ListOptions struct {
+	Prefix string
+	// Kind если не nil, возвращаются только данные этого типа
+	Kind *int
+	Tag  string
+	// Sort folder (по умолчанию), name, created или updated
+	Sort  string
+	Limit int
+	// Cursor курсор следующей страницы из предыдущего ответа
+	Cursor string
+}
+
+// Change последнее изменение данных на сервере, для удаленных данных заполнены только Name, Revision и Deleted
+type Change struct {
+	Name     string
+	Revision int64
+	Deleted  bool
+	Kind     int
+	Data     []byte
+	// Version ревизия самих данных, которую ожидает Upload
+	Version int
+	Meta
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type SyncResponse struct {
+	Changes []Change
+	// Revision ревизия синхронизации, с которой нужно запрашивать следующие изменения
+	Revision int64
+	More     bool
+}
+
+type Session struct {
+	ID         int
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	IP         string
+	UserAgent  string
+	Current    bool
+}
+
+// ApiTokenOptions права и срок нового API токена, нулевой ExpiresAt - бессрочный
+type ApiTokenOptions struct {
+	Description string
+	Write       bool
+	Prefixes    []string
+	ExpiresAt   time.Time
+}
+
+// ApiToken API токен, нулевые ExpiresAt и LastUsedAt - бессрочный и еще не использованный
+type ApiToken struct {
+	ID          int
+	Description string
+	Write       bool
+	Prefixes    []string
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	LastUsedAt  time.Time
+}
+
+type Version struct {
+	Version    int
+	Kind       int
+	ReplacedAt time.Time
+	Current    bool
 }
 
 type PamGRPCClient struct {
@@ -30,6 +179,9 @@ func (c *PamGRPCClient) Register(ctx context.Context, username string, pwd strin
 	resp, err := c.client.Register(ctx, &pamserver.AuthData{Username: username, Pwd: pwd})
 
 	if err != nil {
+		if status.Code(err) == codes.ResourceExhausted {
+			return "", tooManyAttempts(err)
+		}
 		return "", err
 	}
 
@@ -40,66 +192,799 @@ func (c *PamGRPCClient) Register(ctx context.Context, username string, pwd strin
 	return resp.Token, err
 }
 
-func (c *PamGRPCClient) Auth(ctx context.Context, username string, pwd string) (string, error) {
-	resp, err := c.client.Authenticate(ctx, &pamserver.AuthData{Username: username, Pwd: pwd})
+func (c *PamGRPCClient) Auth(ctx context.Context, username string, pwd string, otp string) (string, error) {
+	resp, err := c.client.Authenticate(ctx, &pamserver.AuthData{Username: username, Pwd: pwd, Otp: otp})
 
 	if err != nil {
 		if err.Error() == "rpc error: code = NotFound desc = wrong username or password" {
 			return "", ErrWrongCredentials
 		}
+
+		if err.Error() == "rpc error: code = Unauthenticated desc = second factor required" {
+			return "", ErrSecondFactorRequired
+		}
+
+		if err.Error() == "rpc error: code = PermissionDenied desc = wrong second factor code" {
+			return "", ErrWrongSecondFactor
+		}
+
+		if status.Code(err) == codes.ResourceExhausted {
+			return "", tooManyAttempts(err)
+		}
 		return "", err
 	}
 
 	return resp.Token, err
 }
 
-func (c *PamGRPCClient) Upload(ctx context.Context, authToken string, name string, kind int, data []byte) error {
+func expectedRevision(revision int) *int32 {
+	if revision == AnyRevision {
+		return nil
+	}
+
+	r := int32(revision)
+	return &r
+}
+
+func (c *PamGRPCClient) Upload(ctx context.Context, authToken string, name string, kind int, data []byte, meta Meta, revision int) (int, error) {
+	md := metadata.New(map[string]string{"auth-token": authToken})
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	resp, err := c.client.Upload(ctx, &pamserver.UploadData{
+		Name:             name,
+		Type:             int32(kind),
+		Data:             data,
+		ExpectedRevision: expectedRevision(revision),
+		Folder:           meta.Folder,
+		Tags:             meta.Tags,
+	})
+
+	if err != nil {
+		if status.Code(err) == codes.Unavailable {
+			return 0, ErrUnavailable
+		}
+
+		if err.Error() == "rpc error: code = Internal desc = unauthenticated" {
+			return 0, ErrUnauthenticated
+		}
+
+		if notAllowed(err) {
+			return 0, ErrNotAllowed
+		}
+
+		if err.Error() == "rpc error: code = Aborted desc = revision conflict" {
+			return 0, ErrRevisionConflict
+		}
+		return 0, err
+	}
+
+	return int(resp.Revision), nil
+}
+
+func (c *PamGRPCClient) Get(ctx context.Context, authToken string, name string) (*GetResponse, error) {
+	md := metadata.New(map[string]string{"auth-token": authToken})
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	data, err := c.client.Get(ctx, &pamserver.GetData{Name: name})
+	if err != nil {
+		if status.Code(err) == codes.Unavailable {
+			return nil, ErrUnavailable
+		}
+
+		if err.Error() == "rpc error: code = Internal desc = unauthenticated" {
+			return nil, ErrUnauthenticated
+		}
+
+		if notAllowed(err) {
+			return nil, ErrNotAllowed
+		}
+
+		if err.Error() == "rpc error: code = NotFound desc = this data does not exist" {
+			return nil, ErrDataDoesNotExist
+		}
+		return nil, err
+	}
+
+	return &GetResponse{
+		Kind:      int(data.Kind),
+		Data:      data.Data,
+		Revision:  int(data.Revision),
+		Meta:      Meta{Folder: data.Folder, Tags: data.Tags},
+		CreatedAt: data.CreatedAt.AsTime(),
+		UpdatedAt: data.UpdatedAt.AsTime(),
+	}, nil
+}
+
+func (c *PamGRPCClient) List(ctx context.Context, authToken string, opts ListOptions) ([]DataInfo, string, error) {
 	md := metadata.New(map[string]string{"auth-token": authToken})
 	ctx = metadata.NewOutgoingContext(ctx, md)
 
-	_, err := c.client.Upload(ctx, &pamserver.UploadData{Name: name, Type: int32(kind), Data: data})
+	in := &pamserver.GetDataNames{
+		Prefix: opts.Prefix,
+		Tag:    opts.Tag,
+		Sort:   opts.Sort,
+		Limit:  int32(opts.Limit),
+		Cursor: opts.Cursor,
+	}
+	if opts.Kind != nil {
+		kind := int32(*opts.Kind)
+		in.Type = &kind
+	}
+
+	names, err := c.client.GetNames(ctx, in)
+	if err != nil {
+		if status.Code(err) == codes.Unavailable {
+			return nil, "", ErrUnavailable
+		}
+
+		if err.Error() == "rpc error: code = Internal desc = unauthenticated" {
+			return nil, "", ErrUnauthenticated
+		}
+
+		if notAllowed(err) {
+			return nil, "", ErrNotAllowed
+		}
+
+		if err.Error() == "rpc error: code = InvalidArgument desc = invalid cursor" {
+			return nil, "", ErrInvalidCursor
+		}
+
+		return nil, "", err
+	}
+
+	infos := make([]DataInfo, 0, len(names.Items))
+	for _, item := range names.Items {
+		infos = append(infos, DataInfo{
+			Name:      item.Name,
+			Kind:      int(item.Kind),
+			Revision:  int(item.Revision),
+			Meta:      Meta{Folder: item.Folder, Tags: item.Tags},
+			CreatedAt: item.CreatedAt.AsTime(),
+			UpdatedAt: item.UpdatedAt.AsTime(),
+		})
+	}
+
+	return infos, names.NextCursor, nil
+}
 
+func (c *PamGRPCClient) Delete(ctx context.Context, authToken string, name string, revision int) error {
+	md := metadata.New(map[string]string{"auth-token": authToken})
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	_, err := c.client.Delete(ctx, &pamserver.DeleteData{Name: name, ExpectedRevision: expectedRevision(revision)})
 	if err != nil {
+		if status.Code(err) == codes.Unavailable {
+			return ErrUnavailable
+		}
+
 		if err.Error() == "rpc error: code = Internal desc = unauthenticated" {
 			return ErrUnauthenticated
 		}
+
+		if notAllowed(err) {
+			return ErrNotAllowed
+		}
+
+		if err.Error() == "rpc error: code = NotFound desc = this data does not exist" {
+			return ErrDataDoesNotExist
+		}
+
+		if err.Error() == "rpc error: code = Aborted desc = revision conflict" {
+			return ErrRevisionConflict
+		}
 		return err
 	}
 
 	return nil
 }
 
-func (c *PamGRPCClient) Get(ctx context.Context, authToken string, name string) (*GetResponse, error) {
+func (c *PamGRPCClient) ListVersions(ctx context.Context, authToken string, name string) ([]Version, error) {
 	md := metadata.New(map[string]string{"auth-token": authToken})
 	ctx = metadata.NewOutgoingContext(ctx, md)
 
-	data, err := c.client.Get(ctx, &pamserver.GetData{Name: name})
+	resp, err := c.client.ListVersions(ctx, &pamserver.GetDataVersions{Name: name})
 	if err != nil {
 		if err.Error() == "rpc error: code = Internal desc = unauthenticated" {
 			return nil, ErrUnauthenticated
 		}
 
+		if notAllowed(err) {
+			return nil, ErrNotAllowed
+		}
+
 		if err.Error() == "rpc error: code = NotFound desc = this data does not exist" {
 			return nil, ErrDataDoesNotExist
 		}
 		return nil, err
 	}
 
-	return &GetResponse{Kind: int(data.Kind), Data: data.Data}, nil
+	versions := make([]Version, 0, len(resp.Versions))
+	for _, v := range resp.Versions {
+		versions = append(versions, Version{
+			Version:    int(v.Version),
+			Kind:       int(v.Kind),
+			ReplacedAt: v.ReplacedAt.AsTime(),
+			Current:    v.Current,
+		})
+	}
+
+	return versions, nil
 }
 
-func (c *PamGRPCClient) List(ctx context.Context, authToken string) ([]string, error) {
+func (c *PamGRPCClient) GetVersion(ctx context.Context, authToken string, name string, version int) (*GetResponse, error) {
 	md := metadata.New(map[string]string{"auth-token": authToken})
 	ctx = metadata.NewOutgoingContext(ctx, md)
 
-	names, err := c.client.GetNames(ctx, &pamserver.GetDataNames{})
+	data, err := c.client.GetVersion(ctx, &pamserver.GetDataVersion{Name: name, Version: int32(version)})
 	if err != nil {
 		if err.Error() == "rpc error: code = Internal desc = unauthenticated" {
 			return nil, ErrUnauthenticated
 		}
 
+		if notAllowed(err) {
+			return nil, ErrNotAllowed
+		}
+
+		if err.Error() == "rpc error: code = NotFound desc = this version does not exist" {
+			return nil, ErrVersionDoesNotExist
+		}
 		return nil, err
 	}
 
-	return names.Names, nil
+	return &GetResponse{Kind: int(data.Kind), Data: data.Data, Revision: int(data.Revision)}, nil
+}
+
+func (c *PamGRPCClient) Restore(ctx context.Context, authToken string, name string, version int) (int, error) {
+	md := metadata.New(map[string]string{"auth-token": authToken})
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	resp, err := c.client.Restore(ctx, &pamserver.RestoreData{Name: name, Version: int32(version)})
+	if err != nil {
+		if err.Error() == "rpc error: code = Internal desc = unauthenticated" {
+			return 0, ErrUnauthenticated
+		}
+
+		if notAllowed(err) {
+			return 0, ErrNotAllowed
+		}
+
+		if err.Error() == "rpc error: code = NotFound desc = this data does not exist" {
+			return 0, ErrDataDoesNotExist
+		}
+
+		if err.Error() == "rpc error: code = NotFound desc = this version does not exist" {
+			return 0, ErrVersionDoesNotExist
+		}
+		return 0, err
+	}
+
+	return int(resp.Version), nil
+}
+
+func (c *PamGRPCClient) UploadFile(ctx context.Context, authToken string, name string, info []byte, meta Meta, revision int, r io.Reader) (int, error) {
+	md := metadata.New(map[string]string{"auth-token": authToken})
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.client.UploadFile(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	first := true
+	buf := make([]byte, FileChunkSize)
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if readErr != nil && !errors.Is(readErr, io.EOF) && !errors.Is(readErr, io.ErrUnexpectedEOF) {
+			return 0, readErr
+		}
+
+		// the first message carries the name, so it is sent even for an empty file
+		if n > 0 || first {
+			msg := &pamserver.UploadFileChunk{Chunk: buf[:n]}
+			if first {
+				msg.Name = name
+				msg.Info = info
+				msg.ExpectedRevision = expectedRevision(revision)
+				msg.Folder = meta.Folder
+				msg.Tags = meta.Tags
+				first = false
+			}
+
+			// the actual error is returned by CloseAndRecv
+			if err = stream.Send(msg); err != nil {
+				break
+			}
+		}
+
+		if readErr != nil {
+			break
+		}
+	}
+
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		if err.Error() == "rpc error: code = Internal desc = unauthenticated" {
+			return 0, ErrUnauthenticated
+		}
+
+		if notAllowed(err) {
+			return 0, ErrNotAllowed
+		}
+
+		if err.Error() == "rpc error: code = Aborted desc = revision conflict" {
+			return 0, ErrRevisionConflict
+		}
+		return 0, err
+	}
+
+	return int(resp.Revision), nil
+}
+
+func (c *PamGRPCClient) DownloadFile(ctx context.Context, authToken string, name string, w io.Writer) error {
+	md := metadata.New(map[string]string{"auth-token": authToken})
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	stream, err := c.client.DownloadFile(ctx, &pamserver.GetData{Name: name})
+	if err != nil {
+		return err
+	}
+
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			if status.Code(err) == codes.Unavailable {
+				return ErrUnavailable
+			}
+
+			if err.Error() == "rpc error: code = Internal desc = unauthenticated" {
+				return ErrUnauthenticated
+			}
+
+			if notAllowed(err) {
+				return ErrNotAllowed
+			}
+
+			if err.Error() == "rpc error: code = NotFound desc = this data does not exist" {
+				return ErrDataDoesNotExist
+			}
+
+			if err.Error() == "rpc error: code = FailedPrecondition desc = this data is not a file" {
+				return ErrNotAFile
+			}
+			return err
+		}
+
+		if _, err = w.Write(chunk.Chunk); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *PamGRPCClient) GetVaultParams(ctx context.Context, authToken string) ([]byte, error) {
+	md := metadata.New(map[string]string{"auth-token": authToken})
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	resp, err := c.client.GetVaultParams(ctx, &pamserver.VaultParamsRequest{})
+	if err != nil {
+		if status.Code(err) == codes.Unavailable {
+			return nil, ErrUnavailable
+		}
+
+		if err.Error() == "rpc error: code = Internal desc = unauthenticated" {
+			return nil, ErrUnauthenticated
+		}
+
+		if err.Error() == "rpc error: code = NotFound desc = vault is not initialized" {
+			return nil, ErrVaultNotInitialized
+		}
+		return nil, err
+	}
+
+	return resp.Params, nil
+}
+
+func (c *PamGRPCClient) SetVaultParams(ctx context.Context, authToken string, params []byte) error {
+	md := metadata.New(map[string]string{"auth-token": authToken})
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	_, err := c.client.SetVaultParams(ctx, &pamserver.VaultParams{Params: params})
+	if err != nil {
+		if err.Error() == "rpc error: code = Internal desc = unauthenticated" {
+			return ErrUnauthenticated
+		}
+
+		if notAllowed(err) {
+			return ErrNotAllowed
+		}
+
+		if err.Error() == "rpc error: code = AlreadyExists desc = vault is already initialized" {
+			return ErrVaultAlreadyInitialized
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (c *PamGRPCClient) Sync(ctx context.Context, authToken string, since int64) (*SyncResponse, error) {
+	md := metadata.New(map[string]string{"auth-token": authToken})
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	resp, err := c.client.Sync(ctx, &pamserver.SyncRequest{SinceRevision: since})
+	if err != nil {
+		if status.Code(err) == codes.Unavailable {
+			return nil, ErrUnavailable
+		}
+
+		if err.Error() == "rpc error: code = Internal desc = unauthenticated" {
+			return nil, ErrUnauthenticated
+		}
+
+		if notAllowed(err) {
+			return nil, ErrNotAllowed
+		}
+		return nil, err
+	}
+
+	changes := make([]Change, 0, len(resp.Changes))
+	for _, change := range resp.Changes {
+		c := Change{
+			Name:     change.Name,
+			Revision: change.Revision,
+			Deleted:  change.Deleted,
+		}
+		if !change.Deleted {
+			c.Kind = int(change.Kind)
+			c.Data = change.Data
+			c.Version = int(change.Version)
+			c.Meta = Meta{Folder: change.Folder, Tags: change.Tags}
+			c.CreatedAt = change.CreatedAt.AsTime()
+			c.UpdatedAt = change.UpdatedAt.AsTime()
+		}
+
+		changes = append(changes, c)
+	}
+
+	return &SyncResponse{Changes: changes, Revision: resp.Revision, More: resp.More}, nil
+}
+
+func (c *PamGRPCClient) Logout(ctx context.Context, authToken string) error {
+	md := metadata.New(map[string]string{"auth-token": authToken})
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	_, err := c.client.Logout(ctx, &pamserver.LogoutRequest{})
+	if err != nil {
+		if status.Code(err) == codes.Unavailable {
+			return ErrUnavailable
+		}
+
+		if err.Error() == "rpc error: code = Internal desc = unauthenticated" {
+			return ErrUnauthenticated
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (c *PamGRPCClient) RevokeToken(ctx context.Context, authToken string, token string) error {
+	md := metadata.New(map[string]string{"auth-token": authToken})
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	_, err := c.client.RevokeToken(ctx, &pamserver.RevokeTokenRequest{Token: token})
+	if err != nil {
+		if status.Code(err) == codes.Unavailable {
+			return ErrUnavailable
+		}
+
+		if err.Error() == "rpc error: code = Internal desc = unauthenticated" {
+			return ErrUnauthenticated
+		}
+
+		if err.Error() == "rpc error: code = NotFound desc = this token does not exist" {
+			return ErrTokenDoesNotExist
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (c *PamGRPCClient) RevokeSession(ctx context.Context, authToken string, id int) error {
+	md := metadata.New(map[string]string{"auth-token": authToken})
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	_, err := c.client.RevokeToken(ctx, &pamserver.RevokeTokenRequest{SessionId: int32(id)})
+	if err != nil {
+		if status.Code(err) == codes.Unavailable {
+			return ErrUnavailable
+		}
+
+		if err.Error() == "rpc error: code = Internal desc = unauthenticated" {
+			return ErrUnauthenticated
+		}
+
+		if err.Error() == "rpc error: code = NotFound desc = this token does not exist" {
+			return ErrTokenDoesNotExist
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (c *PamGRPCClient) ListSessions(ctx context.Context, authToken string) ([]Session, error) {
+	md := metadata.New(map[string]string{"auth-token": authToken})
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	resp, err := c.client.ListSessions(ctx, &pamserver.ListSessionsRequest{})
+	if err != nil {
+		if status.Code(err) == codes.Unavailable {
+			return nil, ErrUnavailable
+		}
+
+		if err.Error() == "rpc error: code = Internal desc = unauthenticated" {
+			return nil, ErrUnauthenticated
+		}
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(resp.Sessions))
+	for _, session := range resp.Sessions {
+		sessions = append(sessions, Session{
+			ID:         int(session.Id),
+			CreatedAt:  session.CreatedAt.AsTime(),
+			LastUsedAt: session.LastUsedAt.AsTime(),
+			ExpiresAt:  session.ExpiresAt.AsTime(),
+			IP:         session.Ip,
+			UserAgent:  session.UserAgent,
+			Current:    session.Current,
+		})
+	}
+
+	return sessions, nil
+}
+
+func (c *PamGRPCClient) EnableTwoFactor(ctx context.Context, authToken string, pwd string) (string, string, error) {
+	md := metadata.New(map[string]string{"auth-token": authToken})
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	resp, err := c.client.EnableTwoFactor(ctx, &pamserver.EnableTwoFactorRequest{Pwd: pwd})
+	if err != nil {
+		if err.Error() == "rpc error: code = Internal desc = unauthenticated" {
+			return "", "", ErrUnauthenticated
+		}
+
+		if err.Error() == "rpc error: code = PermissionDenied desc = wrong password" {
+			return "", "", ErrWrongPassword
+		}
+
+		if err.Error() == "rpc error: code = FailedPrecondition desc = two-factor authentication is already enabled" {
+			return "", "", ErrTwoFactorEnabled
+		}
+
+		if status.Code(err) == codes.ResourceExhausted {
+			return "", "", tooManyAttempts(err)
+		}
+
+		if status.Code(err) == codes.Unavailable {
+			return "", "", ErrUnavailable
+		}
+		return "", "", err
+	}
+
+	return resp.Secret, resp.Uri, nil
+}
+
+func (c *PamGRPCClient) ConfirmTwoFactor(ctx context.Context, authToken string, code string) ([]string, error) {
+	md := metadata.New(map[string]string{"auth-token": authToken})
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	resp, err := c.client.ConfirmTwoFactor(ctx, &pamserver.ConfirmTwoFactorRequest{Code: code})
+	if err != nil {
+		if err.Error() == "rpc error: code = Internal desc = unauthenticated" {
+			return nil, ErrUnauthenticated
+		}
+
+		if err.Error() == "rpc error: code = FailedPrecondition desc = two-factor authentication is already enabled" {
+			return nil, ErrTwoFactorEnabled
+		}
+
+		if err.Error() == "rpc error: code = InvalidArgument desc = wrong code" {
+			return nil, ErrWrongCode
+		}
+		return nil, err
+	}
+
+	return resp.RecoveryCodes, nil
+}
+
+func (c *PamGRPCClient) DisableTwoFactor(ctx context.Context, authToken string, pwd string, code string) error {
+	md := metadata.New(map[string]string{"auth-token": authToken})
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	_, err := c.client.DisableTwoFactor(ctx, &pamserver.DisableTwoFactorRequest{Pwd: pwd, Code: code})
+	if err != nil {
+		return twoFactorError(err)
+	}
+
+	return nil
+}
+
+func (c *PamGRPCClient) RegenerateRecoveryCodes(ctx context.Context, authToken string, pwd string, code string) ([]string, error) {
+	md := metadata.New(map[string]string{"auth-token": authToken})
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	resp, err := c.client.RegenerateRecoveryCodes(ctx, &pamserver.RegenerateRecoveryCodesRequest{Pwd: pwd, Code: code})
+	if err != nil {
+		return nil, twoFactorError(err)
+	}
+
+	return resp.RecoveryCodes, nil
+}
+
+// twoFactorError переводит ошибки изменения настроек 2FA, для которого нужны пароль и второй фактор
+func twoFactorError(err error) error {
+	if err.Error() == "rpc error: code = Internal desc = unauthenticated" {
+		return ErrUnauthenticated
+	}
+
+	if err.Error() == "rpc error: code = PermissionDenied desc = wrong password" {
+		return ErrWrongPassword
+	}
+
+	if err.Error() == "rpc error: code = Unauthenticated desc = second factor required" {
+		return ErrSecondFactorRequired
+	}
+
+	if err.Error() == "rpc error: code = PermissionDenied desc = wrong second factor code" {
+		return ErrWrongSecondFactor
+	}
+
+	if err.Error() == "rpc error: code = FailedPrecondition desc = two-factor authentication is not enabled" {
+		return ErrTwoFactorDisabled
+	}
+
+	if status.Code(err) == codes.ResourceExhausted {
+		return tooManyAttempts(err)
+	}
+
+	if status.Code(err) == codes.Unavailable {
+		return ErrUnavailable
+	}
+	return err
+}
+
+func (c *PamGRPCClient) ChangePassword(ctx context.Context, authToken string, currentPwd string, newPwd string) error {
+	md := metadata.New(map[string]string{"auth-token": authToken})
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	_, err := c.client.ChangePassword(ctx, &pamserver.ChangePasswordRequest{CurrentPwd: currentPwd, NewPwd: newPwd})
+	if err != nil {
+		if err.Error() == "rpc error: code = Internal desc = unauthenticated" {
+			return ErrUnauthenticated
+		}
+
+		if err.Error() == "rpc error: code = PermissionDenied desc = wrong password" {
+			return ErrWrongPassword
+		}
+
+		if status.Code(err) == codes.ResourceExhausted {
+			return tooManyAttempts(err)
+		}
+
+		if status.Code(err) == codes.Unavailable {
+			return ErrUnavailable
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (c *PamGRPCClient) DeleteAccount(ctx context.Context, authToken string, pwd string) error {
+	md := metadata.New(map[string]string{"auth-token": authToken})
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	_, err := c.client.DeleteAccount(ctx, &pamserver.DeleteAccountRequest{Pwd: pwd})
+	if err != nil {
+		if err.Error() == "rpc error: code = Internal desc = unauthenticated" {
+			return ErrUnauthenticated
+		}
+
+		if err.Error() == "rpc error: code = PermissionDenied desc = wrong password" {
+			return ErrWrongPassword
+		}
+
+		if status.Code(err) == codes.ResourceExhausted {
+			return tooManyAttempts(err)
+		}
+
+		if status.Code(err) == codes.Unavailable {
+			return ErrUnavailable
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (c *PamGRPCClient) CreateApiToken(ctx context.Context, authToken string, opts ApiTokenOptions) (int, string, error) {
+	md := metadata.New(map[string]string{"auth-token": authToken})
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	req := &pamserver.CreateApiTokenRequest{
+		Description: opts.Description,
+		Write:       opts.Write,
+		Prefixes:    opts.Prefixes,
+	}
+	if !opts.ExpiresAt.IsZero() {
+		req.ExpiresAt = timestamppb.New(opts.ExpiresAt)
+	}
+
+	resp, err := c.client.CreateApiToken(ctx, req)
+	if err != nil {
+		if err.Error() == "rpc error: code = Internal desc = unauthenticated" {
+			return 0, "", ErrUnauthenticated
+		}
+
+		if notAllowed(err) {
+			return 0, "", ErrNotAllowed
+		}
+
+		if status.Code(err) == codes.Unavailable {
+			return 0, "", ErrUnavailable
+		}
+		return 0, "", err
+	}
+
+	return int(resp.Id), resp.Token, nil
+}
+
+func (c *PamGRPCClient) ListApiTokens(ctx context.Context, authToken string) ([]ApiToken, error) {
+	md := metadata.New(map[string]string{"auth-token": authToken})
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	resp, err := c.client.ListApiTokens(ctx, &pamserver.ListApiTokensRequest{})
+	if err != nil {
+		if err.Error() == "rpc error: code = Internal desc = unauthenticated" {
+			return nil, ErrUnauthenticated
+		}
+
+		if notAllowed(err) {
+			return nil, ErrNotAllowed
+		}
+
+		if status.Code(err) == codes.Unavailable {
+			return nil, ErrUnavailable
+		}
+		return nil, err
+	}
+
+	tokens := make([]ApiToken, 0, len(resp.Tokens))
+	for _, token := range resp.Tokens {
+		t := ApiToken{
+			ID:          int(token.Id),
+			Description: token.Description,
+			Write:       token.Write,
+			Prefixes:    token.Prefixes,
+			CreatedAt:   token.CreatedAt.AsTime(),
+		}
+		if token.ExpiresAt != nil {
+			t.ExpiresAt = token.ExpiresAt.AsTime()
+		}
+		if token.LastUsedAt != nil {
+			t.LastUsedAt = token.LastUsedAt.AsTime()
+		}
+
+		tokens = append(tokens, t)
+	}
+
+	return tokens, nil
 }
@@ -0,0 +1,484 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/smakimka/pam/internal/client/pamclient"
+	"github.com/smakimka/pam/internal/client/vault"
+)
+
+// ErrQueued возвращается, когда сервер недоступен и изменение сохранено в локальной копии,
+// на сервер оно будет отправлено при следующей синхронизации
+var ErrQueued = errors.New("server is unreachable, the change is saved locally and will be uploaded on the next sync")
+
+// ErrNoReplica возвращается при синхронизации, когда задан PAM_TOKEN, локальная копия с ним не используется
+var ErrNoReplica = errors.New("the local copy is not used with " + TokenEnv)
+
+// replicaAD связывает зашифрованную локальную копию с ее назначением
+var replicaAD = []byte("pam replica")
+
+// ConflictPolicy что делать при синхронизации с изменениями, которые конфликтуют с данными на сервере
+type ConflictPolicy int
+
+const (
+	// KeepConflicts оставляет конфликтующие изменения в очереди
+	KeepConflicts ConflictPolicy = iota
+	// OverwriteConflicts перезаписывает данные на сервере
+	OverwriteConflicts
+	// DiscardConflicts удаляет конфликтующие изменения из очереди
+	DiscardConflicts
+)
+
+type SyncResult struct {
+	Pushed    int
+	Pulled    int
+	Conflicts []string
+	Pending   int
+}
+
+// replicaRecord данные так, как они хранятся на сервере, то есть зашифрованными
+type replicaRecord struct {
+	Kind      int            `json:"kind"`
+	Data      []byte         `json:"data"`
+	Revision  int            `json:"revision"`
+	Meta      pamclient.Meta `json:"meta"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// pendingChange изменение, сделанное без связи с сервером
+type pendingChange struct {
+	Name   string         `json:"name"`
+	Delete bool           `json:"delete"`
+	Kind   int            `json:"kind"`
+	Data   []byte         `json:"data"`
+	Meta   pamclient.Meta `json:"meta"`
+	// Revision ревизия данных на сервере, от которой сделано изменение
+	Revision  int       `json:"revision"`
+	Conflict  bool      `json:"conflict"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// replica локальная копия данных пользователя. Хранится рядом с pam.data, зашифрованная ключом хранилища
+type replica struct {
+	Revision int64                     `json:"revision"`
+	Records  map[string]*replicaRecord `json:"records"`
+	Pending  []*pendingChange          `json:"pending"`
+}
+
+func replicaPath() (string, error) {
+	return dataPath("replica.data")
+}
+
+// removeReplica удаляет локальную копию, например, при входе под другим пользователем
+func (s *State) removeReplica() error {
+	s.replica = nil
+
+	path, err := replicaPath()
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *State) loadReplica(key *vault.Key) (*replica, error) {
+	if s.noReplica {
+		return nil, ErrNoReplica
+	}
+	if s.replica != nil {
+		return s.replica, nil
+	}
+
+	r := &replica{Records: map[string]*replicaRecord{}}
+
+	path, err := replicaPath()
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.replica = r
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := key.Open(sealed, replicaAD)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, r); err != nil {
+		return nil, err
+	}
+	if r.Records == nil {
+		r.Records = map[string]*replicaRecord{}
+	}
+
+	s.replica = r
+	return r, nil
+}
+
+func (s *State) saveReplica(key *vault.Key) error {
+	if s.replica == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(s.replica)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := key.Seal(data, replicaAD)
+	if err != nil {
+		return err
+	}
+
+	path, err := replicaPath()
+	if err != nil {
+		return err
+	}
+
+	// written to a temporary file first so a crash never leaves a half written replica
+	tmp, err := os.CreateTemp(filepath.Dir(path), "replica-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(sealed); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// pending возвращает изменение данных из очереди
+func (r *replica) pending(name string) (int, *pendingChange) {
+	for i, p := range r.Pending {
+		if p.Name == name {
+			return i, p
+		}
+	}
+
+	return -1, nil
+}
+
+// lookup возвращает данные с учетом изменений из очереди, nil - данных нет
+func (r *replica) lookup(name string) *replicaRecord {
+	record := r.Records[name]
+
+	_, p := r.pending(name)
+	if p == nil {
+		return record
+	}
+	if p.Delete {
+		return nil
+	}
+
+	local := &replicaRecord{
+		Kind:      p.Kind,
+		Data:      p.Data,
+		Revision:  p.Revision,
+		Meta:      p.Meta,
+		CreatedAt: p.ChangedAt,
+		UpdatedAt: p.ChangedAt,
+	}
+	if record != nil {
+		local.CreatedAt = record.CreatedAt
+		if p.Revision == pamclient.AnyRevision {
+			local.Revision = record.Revision
+		}
+	} else if p.Revision == pamclient.AnyRevision {
+		local.Revision = 0
+	}
+
+	return local
+}
+
+// queue ставит изменение в очередь. Повторное изменение тех же данных заменяет предыдущее,
+// но сохраняет ревизию, от которой оно было сделано
+func (r *replica) queue(change *pendingChange) {
+	i, p := r.pending(change.Name)
+	if p == nil {
+		r.Pending = append(r.Pending, change)
+		return
+	}
+
+	change.Revision = p.Revision
+	if change.Delete && !p.Delete && r.Records[change.Name] == nil {
+		// the data never reached the server, so there is nothing to delete
+		r.Pending = slices.Delete(r.Pending, i, i+1)
+		return
+	}
+
+	r.Pending[i] = change
+}
+
+func (r *replica) apply(change pamclient.Change) {
+	if change.Deleted {
+		delete(r.Records, change.Name)
+		return
+	}
+
+	r.Records[change.Name] = &replicaRecord{
+		Kind:      change.Kind,
+		Data:      change.Data,
+		Revision:  change.Version,
+		Meta:      change.Meta,
+		CreatedAt: change.CreatedAt,
+		UpdatedAt: change.UpdatedAt,
+	}
+}
+
+// Sync отправляет на сервер изменения, сделанные без связи с ним, и загружает изменения с сервера в локальную копию
+func (s *State) Sync(ctx context.Context, policy ConflictPolicy) (*SyncResult, error) {
+	key, err := s.vaultKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.sync(ctx, key, policy)
+}
+
+func (s *State) sync(ctx context.Context, key *vault.Key, policy ConflictPolicy) (*SyncResult, error) {
+	r, err := s.loadReplica(key)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &SyncResult{}
+	err = s.push(ctx, r, policy, res)
+	if err == nil {
+		err = s.pull(ctx, r, res)
+	}
+	res.Pending = len(r.Pending)
+
+	if saveErr := s.saveReplica(key); saveErr != nil && err == nil {
+		err = saveErr
+	}
+
+	return res, err
+}
+
+// syncQuietly обновляет локальную копию после удачного обращения к серверу, ошибки синхронизации не мешают
+// основной операции
+func (s *State) syncQuietly(ctx context.Context, key *vault.Key) {
+	_, _ = s.sync(ctx, key, KeepConflicts)
+}
+
+func (s *State) push(ctx context.Context, r *replica, policy ConflictPolicy, res *SyncResult) error {
+	remaining := []*pendingChange{}
+
+	for i, p := range r.Pending {
+		if p.Conflict {
+			switch policy {
+			case DiscardConflicts:
+				continue
+			case OverwriteConflicts:
+				p.Conflict = false
+				p.Revision = pamclient.AnyRevision
+			default:
+				remaining = append(remaining, p)
+				res.Conflicts = append(res.Conflicts, p.Name)
+				continue
+			}
+		}
+
+		var err error
+		if p.Delete {
+			// the data may have been changed by someone else since it was deleted here
+			err = s.client.Delete(ctx, s.AuthToken, p.Name, p.Revision)
+			if errors.Is(err, pamclient.ErrDataDoesNotExist) {
+				err = nil
+			}
+		} else {
+			_, err = s.client.Upload(ctx, s.AuthToken, p.Name, p.Kind, p.Data, p.Meta, p.Revision)
+		}
+
+		if errors.Is(err, pamclient.ErrRevisionConflict) {
+			p.Conflict = true
+			remaining = append(remaining, p)
+			res.Conflicts = append(res.Conflicts, p.Name)
+			continue
+		}
+		if err != nil {
+			// the change order is kept, so the rest is pushed on the next sync
+			r.Pending = append(remaining, r.Pending[i:]...)
+			return err
+		}
+
+		res.Pushed++
+	}
+
+	r.Pending = remaining
+	return nil
+}
+
+func (s *State) pull(ctx context.Context, r *replica, res *SyncResult) error {
+	for {
+		resp, err := s.client.Sync(ctx, s.AuthToken, r.Revision)
+		if err != nil {
+			return err
+		}
+
+		for _, change := range resp.Changes {
+			r.apply(change)
+		}
+		r.Revision = resp.Revision
+		res.Pulled += len(resp.Changes)
+
+		if !resp.More {
+			return nil
+		}
+	}
+}
+
+// getLocal возвращает данные из локальной копии, когда сервер недоступен
+func (s *State) getLocal(ctx context.Context, name string) (*pamclient.GetResponse, *vault.Key, error) {
+	key, err := s.vaultKey(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r, err := s.loadReplica(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	record := r.lookup(name)
+	if record == nil {
+		return nil, nil, pamclient.ErrDataDoesNotExist
+	}
+
+	return &pamclient.GetResponse{
+		Kind:      record.Kind,
+		Data:      record.Data,
+		Revision:  record.Revision,
+		Meta:      record.Meta,
+		CreatedAt: record.CreatedAt,
+		UpdatedAt: record.UpdatedAt,
+	}, key, nil
+}
+
+// listLocal возвращает список данных из локальной копии, когда сервер недоступен. Фильтры и сортировка
+// те же, что и на сервере, но возвращается сразу весь список
+func (s *State) listLocal(ctx context.Context, opts pamclient.ListOptions) ([]pamclient.DataInfo, error) {
+	key, err := s.vaultKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := s.loadReplica(key)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(r.Records)+len(r.Pending))
+	for name := range r.Records {
+		names = append(names, name)
+	}
+	for _, p := range r.Pending {
+		if _, ok := r.Records[p.Name]; !ok {
+			names = append(names, p.Name)
+		}
+	}
+
+	infos := []pamclient.DataInfo{}
+	for _, name := range names {
+		record := r.lookup(name)
+		if record == nil || !strings.HasPrefix(name, opts.Prefix) {
+			continue
+		}
+		if opts.Kind != nil && record.Kind != *opts.Kind {
+			continue
+		}
+		if opts.Tag != "" && !slices.Contains(record.Meta.Tags, opts.Tag) {
+			continue
+		}
+
+		infos = append(infos, pamclient.DataInfo{
+			Name:      name,
+			Kind:      record.Kind,
+			Revision:  record.Revision,
+			Meta:      record.Meta,
+			CreatedAt: record.CreatedAt,
+			UpdatedAt: record.UpdatedAt,
+		})
+	}
+
+	slices.SortFunc(infos, func(a, b pamclient.DataInfo) int {
+		switch opts.Sort {
+		case "name":
+		case "created":
+			if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+				return c
+			}
+		case "updated":
+			if c := b.UpdatedAt.Compare(a.UpdatedAt); c != 0 {
+				return c
+			}
+		default:
+			if c := strings.Compare(a.Folder, b.Folder); c != 0 {
+				return c
+			}
+		}
+
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return infos, nil
+}
+
+// queueLocal сохраняет изменение в локальной копии, когда сервер недоступен. Ожидаемая ревизия проверяется
+// по локальной копии, чтобы конфликт можно было разрешить сразу
+func (s *State) queueLocal(ctx context.Context, change *pendingChange) error {
+	key, err := s.vaultKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	r, err := s.loadReplica(key)
+	if err != nil {
+		return err
+	}
+
+	current := r.lookup(change.Name)
+	switch {
+	case change.Delete:
+		if current == nil {
+			return pamclient.ErrDataDoesNotExist
+		}
+		change.Revision = current.Revision
+	case change.Revision == 0 && current != nil,
+		change.Revision > 0 && (current == nil || current.Revision != change.Revision):
+		return pamclient.ErrRevisionConflict
+	}
+
+	change.ChangedAt = time.Now()
+	r.queue(change)
+
+	if err = s.saveReplica(key); err != nil {
+		return err
+	}
+
+	return ErrQueued
+}
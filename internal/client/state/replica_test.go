@@ -0,0 +1,57 @@
+package state
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smakimka/pam/internal/client/pamclient"
+	"github.com/smakimka/pam/internal/datatypes"
+)
+
+func TestReplicaLookup(t *testing.T) {
+	r := &replica{Records: map[string]*replicaRecord{}}
+	r.apply(pamclient.Change{Name: "a", Revision: 1, Kind: datatypes.Text, Data: []byte("server"), Version: 3})
+	r.apply(pamclient.Change{Name: "b", Revision: 2, Kind: datatypes.Text, Data: []byte("b"), Version: 1})
+
+	assert.Equal(t, []byte("server"), r.lookup("a").Data)
+	assert.Nil(t, r.lookup("c"))
+
+	r.queue(&pendingChange{Name: "a", Kind: datatypes.Text, Data: []byte("local"), Revision: 3, ChangedAt: time.Now()})
+	r.queue(&pendingChange{Name: "b", Delete: true, Revision: 1})
+	r.queue(&pendingChange{Name: "c", Kind: datatypes.Text, Data: []byte("new"), Revision: pamclient.AnyRevision})
+
+	assert.Equal(t, []byte("local"), r.lookup("a").Data)
+	assert.Equal(t, 3, r.lookup("a").Revision)
+	assert.Nil(t, r.lookup("b"))
+	assert.Equal(t, 0, r.lookup("c").Revision)
+
+	// a second change keeps the revision the first one was made from
+	r.queue(&pendingChange{Name: "a", Kind: datatypes.Text, Data: []byte("local 2"), Revision: pamclient.AnyRevision})
+	assert.Len(t, r.Pending, 3)
+	assert.Equal(t, 3, r.Pending[0].Revision)
+	assert.Equal(t, []byte("local 2"), r.lookup("a").Data)
+
+	// deleting data that never reached the server just drops it from the queue
+	r.queue(&pendingChange{Name: "c", Delete: true})
+	assert.Len(t, r.Pending, 2)
+	assert.Nil(t, r.lookup("c"))
+
+	r.apply(pamclient.Change{Name: "b", Revision: 3, Deleted: true})
+	_, ok := r.Records["b"]
+	assert.False(t, ok)
+}
+
+func TestNoReplicaWithEnvToken(t *testing.T) {
+	s := &State{noReplica: true}
+
+	_, err := s.loadReplica(nil)
+	assert.ErrorIs(t, err, ErrNoReplica)
+
+	// sync doesn't reach the server or the local copy
+	_, err = s.sync(context.Background(), nil, KeepConflicts)
+	assert.ErrorIs(t, err, ErrNoReplica)
+	assert.Nil(t, s.replica)
+}
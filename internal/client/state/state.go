@@ -2,28 +2,60 @@ package state
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"syscall"
 
 	"github.com/adrg/xdg"
 	"github.com/smakimka/pam/internal/client/pamclient"
+	"github.com/smakimka/pam/internal/client/vault"
+	"github.com/smakimka/pam/internal/datatypes"
 	"golang.org/x/term"
 )
 
+// TokenEnv переменная среды с токеном, например, API токеном на сборочном агенте. Такой токен используется
+// вместо сохраненного и не сохраняется
+const TokenEnv = "PAM_TOKEN"
+
 type State struct {
-	dataFile   *os.File
-	client     pamclient.PamClient
-	ServerAddr string `json:"server_addr"`
-	AuthToken  string `json:"auth_token"`
+	dataFile *os.File
+	client   pamclient.PamClient
+	key      *vault.Key
+	replica  *replica
+	// noReplica локальная копия не используется: токен из PAM_TOKEN может видеть не все данные профиля
+	noReplica   bool
+	savedToken  *string
+	ServerAddr  string `json:"server_addr"`
+	AuthToken   string `json:"auth_token"`
+	VaultParams []byte `json:"vault_params"`
+	// ClientCert и ClientKey клиентский сертификат и ключ, с которыми сервер пускает без токена
+	ClientCert string `json:"client_cert,omitempty"`
+	ClientKey  string `json:"client_key,omitempty"`
+}
+
+// dataPath путь к файлу клиента. Если задана переменная среды PAM_PROFILE, у каждого профиля своя
+// директория, например, для разных серверов или пользователей на одной машине
+func dataPath(name string) (string, error) {
+	if profile := os.Getenv("PAM_PROFILE"); profile != "" {
+		if profile != filepath.Base(profile) || profile == "." || profile == ".." {
+			return "", fmt.Errorf("invalid profile name %q", profile)
+		}
+
+		return xdg.DataFile(filepath.Join("pam", "profiles", profile, name))
+	}
+
+	return xdg.DataFile(filepath.Join("pam", name))
 }
 
 func Open() (*State, error) {
 	cfg := &State{}
 
-	filePath, err := xdg.DataFile("pam/pam.data")
+	filePath, err := dataPath("pam.data")
 	if err != nil {
 		return cfg, err
 	}
@@ -46,6 +78,13 @@ func Open() (*State, error) {
 		}
 	}
 
+	if token := os.Getenv(TokenEnv); token != "" {
+		saved := cfg.AuthToken
+		cfg.savedToken = &saved
+		cfg.AuthToken = token
+		cfg.noReplica = true
+	}
+
 	return cfg, nil
 }
 
@@ -59,6 +98,10 @@ func (s *State) Close() {
 	}
 	defer s.dataFile.Close()
 
+	if s.savedToken != nil {
+		s.AuthToken = *s.savedToken
+	}
+
 	data, err := json.Marshal(s)
 	if err != nil {
 		return
@@ -93,6 +136,33 @@ func (s *State) ReadServerAddr() error {
 	return nil
 }
 
+// SetClientCert запоминает клиентский сертификат и ключ, пустые пути убирают их. Сертификат начнет
+// использоваться со следующего запуска
+func (s *State) SetClientCert(certFile string, keyFile string) error {
+	if certFile == "" || keyFile == "" {
+		s.ClientCert = ""
+		s.ClientKey = ""
+		return nil
+	}
+
+	if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		return err
+	}
+
+	certFile, err := filepath.Abs(certFile)
+	if err != nil {
+		return err
+	}
+	keyFile, err = filepath.Abs(keyFile)
+	if err != nil {
+		return err
+	}
+
+	s.ClientCert = certFile
+	s.ClientKey = keyFile
+	return nil
+}
+
 func (s *State) collectUsernameAndPwd() ([]string, error) {
 	var username string
 	fmt.Print("Enter username: ")
@@ -122,7 +192,9 @@ func (s *State) Register(ctx context.Context) error {
 	}
 
 	s.AuthToken = token
-	return nil
+	s.VaultParams = nil
+	s.key = nil
+	return s.removeReplica()
 }
 
 func (s *State) Auth(ctx context.Context) error {
@@ -131,26 +203,271 @@ func (s *State) Auth(ctx context.Context) error {
 		return err
 	}
 
-	token, err := s.client.Auth(ctx, login[0], login[1])
+	token, err := s.client.Auth(ctx, login[0], login[1], "")
+	if errors.Is(err, pamclient.ErrSecondFactorRequired) {
+		var otp string
+		fmt.Print("\nEnter two-factor code or recovery code: ")
+		if _, err = fmt.Scanln(&otp); err != nil {
+			return err
+		}
+
+		token, err = s.client.Auth(ctx, login[0], login[1], otp)
+	}
 	if err != nil {
 		return err
 	}
 
 	s.AuthToken = token
-	return nil
+	s.VaultParams = nil
+	s.key = nil
+	return s.removeReplica()
+}
+
+// Logout отзывает токен на сервере и забывает его вместе с ключом хранилища и локальной копией.
+// Если токен уже истек, он просто забывается
+func (s *State) Logout(ctx context.Context) error {
+	if s.AuthToken == "" {
+		return pamclient.ErrUnauthenticated
+	}
+
+	err := s.client.Logout(ctx, s.AuthToken)
+	if err != nil && !errors.Is(err, pamclient.ErrUnauthenticated) {
+		return err
+	}
+
+	s.AuthToken = ""
+	s.VaultParams = nil
+	s.key = nil
+	return s.removeReplica()
 }
 
-func (s *State) Upload(ctx context.Context, name string, kind int, data []byte) error {
-	err := s.client.Upload(ctx, s.AuthToken, name, kind, data)
+var ErrPwdMismatch = errors.New("passwords don't match")
+
+func readPwd(prompt string) (string, error) {
+	fmt.Print(prompt)
+	bytePwd, err := term.ReadPassword(syscall.Stdin)
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+
+	return string(bytePwd), nil
+}
+
+// ChangePassword интерактивно запрашивает текущий и новый пароль от аккаунта и меняет его. Мастер пароль
+// и сохраненный токен остаются прежними, остальные токены отзываются
+func (s *State) ChangePassword(ctx context.Context) error {
+	current, err := readPwd("Enter current password: ")
 	if err != nil {
 		return err
 	}
 
-	return nil
+	pwd, err := readPwd("Enter new password: ")
+	if err != nil {
+		return err
+	}
+
+	repeated, err := readPwd("Repeat new password: ")
+	if err != nil {
+		return err
+	}
+
+	if pwd != repeated {
+		return ErrPwdMismatch
+	}
+
+	return s.client.ChangePassword(ctx, s.AuthToken, current, pwd)
 }
 
+// DeleteAccount интерактивно запрашивает пароль, удаляет аккаунт со всеми данными на сервере и забывает
+// все, что о нем известно локально: токен, ключ хранилища, локальную копию и клиентский сертификат
+func (s *State) DeleteAccount(ctx context.Context) error {
+	pwd, err := readPwd("Enter password: ")
+	if err != nil {
+		return err
+	}
+
+	if err = s.client.DeleteAccount(ctx, s.AuthToken, pwd); err != nil {
+		return err
+	}
+
+	s.AuthToken = ""
+	s.VaultParams = nil
+	s.key = nil
+	s.ClientCert = ""
+	s.ClientKey = ""
+	return s.removeReplica()
+}
+
+func (s *State) CreateApiToken(ctx context.Context, opts pamclient.ApiTokenOptions) (int, string, error) {
+	return s.client.CreateApiToken(ctx, s.AuthToken, opts)
+}
+
+func (s *State) ListApiTokens(ctx context.Context) ([]pamclient.ApiToken, error) {
+	return s.client.ListApiTokens(ctx, s.AuthToken)
+}
+
+// EnableTwoFactor интерактивно запрашивает пароль и начинает включение 2FA
+func (s *State) EnableTwoFactor(ctx context.Context) (string, string, error) {
+	pwd, err := readPwd("Enter password: ")
+	if err != nil {
+		return "", "", err
+	}
+
+	return s.client.EnableTwoFactor(ctx, s.AuthToken, pwd)
+}
+
+func (s *State) ConfirmTwoFactor(ctx context.Context, code string) ([]string, error) {
+	return s.client.ConfirmTwoFactor(ctx, s.AuthToken, code)
+}
+
+// DisableTwoFactor интерактивно запрашивает пароль и код и выключает 2FA
+func (s *State) DisableTwoFactor(ctx context.Context) error {
+	return withSecondFactor(func(pwd string, code string) error {
+		return s.client.DisableTwoFactor(ctx, s.AuthToken, pwd, code)
+	})
+}
+
+// RegenerateRecoveryCodes интерактивно запрашивает пароль и код и заменяет коды восстановления новыми
+func (s *State) RegenerateRecoveryCodes(ctx context.Context) ([]string, error) {
+	var recoveryCodes []string
+	err := withSecondFactor(func(pwd string, code string) error {
+		var err error
+		recoveryCodes, err = s.client.RegenerateRecoveryCodes(ctx, s.AuthToken, pwd, code)
+		return err
+	})
+
+	return recoveryCodes, err
+}
+
+// withSecondFactor запрашивает пароль и вызывает call, код запрашивается, только если сервер его потребовал
+func withSecondFactor(call func(pwd string, code string) error) error {
+	pwd, err := readPwd("Enter password: ")
+	if err != nil {
+		return err
+	}
+
+	err = call(pwd, "")
+	if errors.Is(err, pamclient.ErrSecondFactorRequired) {
+		var code string
+		fmt.Print("Enter two-factor code or recovery code: ")
+		if _, err = fmt.Scanln(&code); err != nil {
+			return err
+		}
+
+		err = call(pwd, code)
+	}
+
+	return err
+}
+
+func (s *State) ListSessions(ctx context.Context) ([]pamclient.Session, error) {
+	return s.client.ListSessions(ctx, s.AuthToken)
+}
+
+func (s *State) RevokeSession(ctx context.Context, id int) error {
+	return s.client.RevokeSession(ctx, s.AuthToken, id)
+}
+
+// Upload шифрует и сохраняет данные, revision - ожидаемая текущая ревизия данных или pamclient.AnyRevision.
+// Возвращает новую ревизию
+func (s *State) Upload(ctx context.Context, name string, kind int, data []byte, meta pamclient.Meta, revision int) (int, error) {
+	key, err := s.vaultKey(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	sealed, err := key.Seal(data, vault.RecordAD(name, kind))
+	if err != nil {
+		return 0, err
+	}
+
+	newRevision, err := s.client.Upload(ctx, s.AuthToken, name, kind, sealed, meta, revision)
+	if errors.Is(err, pamclient.ErrUnavailable) && !s.noReplica {
+		return 0, s.queueLocal(ctx, &pendingChange{Name: name, Kind: kind, Data: sealed, Meta: meta, Revision: revision})
+	}
+	if err != nil {
+		return newRevision, err
+	}
+
+	s.syncQuietly(ctx, key)
+	return newRevision, nil
+}
+
+// Get получает и расшифровывает данные, если сервер недоступен, данные берутся из локальной копии
 func (s *State) Get(ctx context.Context, name string) (*pamclient.GetResponse, error) {
+	var key *vault.Key
+
 	data, err := s.client.Get(ctx, s.AuthToken, name)
+	if errors.Is(err, pamclient.ErrUnavailable) && !s.noReplica {
+		data, key, err = s.getLocal(ctx, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if key == nil {
+		if key, err = s.vaultKey(ctx); err != nil {
+			return nil, err
+		}
+		s.syncQuietly(ctx, key)
+	}
+
+	data.Data, err = key.Open(data.Data, vault.RecordAD(name, data.Kind))
+	if err != nil {
+		return nil, err
+	}
+
+	return data, err
+}
+
+// List возвращает список данных, если сервер недоступен, список берется из локальной копии целиком
+func (s *State) List(ctx context.Context, opts pamclient.ListOptions) ([]pamclient.DataInfo, string, error) {
+	infos, next, err := s.client.List(ctx, s.AuthToken, opts)
+	if errors.Is(err, pamclient.ErrUnavailable) && !s.noReplica {
+		infos, err = s.listLocal(ctx, opts)
+		return infos, "", err
+	}
+	if err != nil {
+		return infos, next, err
+	}
+
+	return infos, next, err
+}
+
+func (s *State) Delete(ctx context.Context, name string) error {
+	err := s.client.Delete(ctx, s.AuthToken, name, pamclient.AnyRevision)
+	if errors.Is(err, pamclient.ErrUnavailable) && !s.noReplica {
+		return s.queueLocal(ctx, &pendingChange{Name: name, Delete: true})
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *State) ListVersions(ctx context.Context, name string) ([]pamclient.Version, error) {
+	versions, err := s.client.ListVersions(ctx, s.AuthToken, name)
+	if err != nil {
+		return versions, err
+	}
+
+	return versions, err
+}
+
+func (s *State) GetVersion(ctx context.Context, name string, version int) (*pamclient.GetResponse, error) {
+	data, err := s.client.GetVersion(ctx, s.AuthToken, name, version)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := s.vaultKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data.Data, err = key.Open(data.Data, vault.RecordAD(name, data.Kind))
 	if err != nil {
 		return nil, err
 	}
@@ -158,11 +475,47 @@ func (s *State) Get(ctx context.Context, name string) (*pamclient.GetResponse, e
 	return data, err
 }
 
-func (s *State) List(ctx context.Context) ([]string, error) {
-	names, err := s.client.List(ctx, s.AuthToken)
+func (s *State) Restore(ctx context.Context, name string, version int) (int, error) {
+	newVersion, err := s.client.Restore(ctx, s.AuthToken, name, version)
 	if err != nil {
-		return names, err
+		return newVersion, err
+	}
+
+	return newVersion, err
+}
+
+func (s *State) UploadFile(ctx context.Context, name string, info []byte, meta pamclient.Meta, revision int, r io.Reader) (int, error) {
+	key, err := s.vaultKey(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	ad := vault.RecordAD(name, datatypes.File)
+	sealed, err := key.Seal(info, ad)
+	if err != nil {
+		return 0, err
+	}
+
+	newRevision, err := s.client.UploadFile(ctx, s.AuthToken, name, sealed, meta, revision, vault.NewEncryptingReader(key, ad, r))
+	if err != nil {
+		return newRevision, err
+	}
+
+	return newRevision, nil
+}
+
+func (s *State) DownloadFile(ctx context.Context, name string, w io.Writer) error {
+	key, err := s.vaultKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	dw := vault.NewDecryptingWriter(key, vault.RecordAD(name, datatypes.File), w)
+
+	err = s.client.DownloadFile(ctx, s.AuthToken, name, dw)
+	if err != nil {
+		return err
 	}
 
-	return names, err
+	return dw.Close()
 }
@@ -0,0 +1,109 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"golang.org/x/term"
+
+	"github.com/smakimka/pam/internal/client/pamclient"
+	"github.com/smakimka/pam/internal/client/vault"
+)
+
+// MasterPwdEnv переменная среды, из которой берется мастер пароль вместо интерактивного ввода
+const MasterPwdEnv = "PAM_MASTER_PASSWORD"
+
+var ErrMasterPwdMismatch = errors.New("master passwords don't match")
+
+func (s *State) readMasterPwd(prompt string) (string, error) {
+	if pwd, ok := os.LookupEnv(MasterPwdEnv); ok {
+		return pwd, nil
+	}
+
+	fmt.Print(prompt)
+	bytePwd, err := term.ReadPassword(syscall.Stdin)
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+
+	return string(bytePwd), nil
+}
+
+// vaultKey возвращает ключ хранилища, при первом использовании хранилища создает его параметры
+func (s *State) vaultKey(ctx context.Context) (*vault.Key, error) {
+	if s.key != nil {
+		return s.key, nil
+	}
+
+	if len(s.VaultParams) == 0 {
+		params, err := s.client.GetVaultParams(ctx, s.AuthToken)
+		if errors.Is(err, pamclient.ErrVaultNotInitialized) {
+			return s.initVault(ctx)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		s.VaultParams = params
+	}
+
+	params, err := vault.UnmarshalParams(s.VaultParams)
+	if err != nil {
+		return nil, err
+	}
+
+	pwd, err := s.readMasterPwd("Enter master password: ")
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := params.DeriveKey(pwd)
+	if err != nil {
+		return nil, err
+	}
+
+	s.key = key
+	return key, nil
+}
+
+func (s *State) initVault(ctx context.Context) (*vault.Key, error) {
+	fmt.Println("Your vault is not initialized yet, all data is encrypted with a master password that never leaves this machine")
+
+	pwd, err := s.readMasterPwd("Create master password: ")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := os.LookupEnv(MasterPwdEnv); !ok {
+		repeated, err := s.readMasterPwd("Repeat master password: ")
+		if err != nil {
+			return nil, err
+		}
+
+		if pwd != repeated {
+			return nil, ErrMasterPwdMismatch
+		}
+	}
+
+	params, key, err := vault.NewParams(pwd)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := params.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.client.SetVaultParams(ctx, s.AuthToken, data); err != nil {
+		return nil, err
+	}
+
+	s.VaultParams = data
+	s.key = key
+	return key, nil
+}
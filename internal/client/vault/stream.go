@@ -0,0 +1,150 @@
+package vault
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// segmentSize размер открытого текста в одном зашифрованном сегменте потока
+const segmentSize = 64 * 1024
+
+var ErrTruncated = errors.New("encrypted stream is truncated")
+
+// Поток шифруется сегментами, каждый сегмент записывается как длина (4 байта) и результат Seal.
+// В ad сегмента входят его номер и признак последнего сегмента, поэтому переставить или отрезать
+// сегменты незаметно нельзя
+
+func segmentAD(ad []byte, idx uint64, final bool) []byte {
+	res := make([]byte, 0, len(ad)+9)
+	res = append(res, ad...)
+	res = binary.BigEndian.AppendUint64(res, idx)
+	if final {
+		return append(res, 1)
+	}
+
+	return append(res, 0)
+}
+
+type encryptingReader struct {
+	key  *Key
+	ad   []byte
+	src  *bufio.Reader
+	buf  []byte
+	out  []byte
+	idx  uint64
+	done bool
+}
+
+// NewEncryptingReader возвращает reader, из которого читается зашифрованное содержимое r
+func NewEncryptingReader(key *Key, ad []byte, r io.Reader) io.Reader {
+	return &encryptingReader{
+		key: key,
+		ad:  ad,
+		src: bufio.NewReader(r),
+		buf: make([]byte, segmentSize),
+	}
+}
+
+func (r *encryptingReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		if err := r.nextSegment(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+
+	return n, nil
+}
+
+func (r *encryptingReader) nextSegment() error {
+	n, err := io.ReadFull(r.src, r.buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+
+	final := err != nil
+	if !final {
+		if _, err = r.src.Peek(1); errors.Is(err, io.EOF) {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	sealed, err := r.key.Seal(r.buf[:n], segmentAD(r.ad, r.idx, final))
+	if err != nil {
+		return err
+	}
+
+	r.out = binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(sealed)), uint32(len(sealed)))
+	r.out = append(r.out, sealed...)
+	r.idx++
+	r.done = final
+
+	return nil
+}
+
+type decryptingWriter struct {
+	key  *Key
+	ad   []byte
+	dst  io.Writer
+	buf  []byte
+	idx  uint64
+	done bool
+}
+
+// NewDecryptingWriter возвращает writer, который расшифровывает записанное в него и пишет результат в w.
+// Close проверяет, что поток не был обрезан
+func NewDecryptingWriter(key *Key, ad []byte, w io.Writer) io.WriteCloser {
+	return &decryptingWriter{key: key, ad: ad, dst: w}
+}
+
+func (w *decryptingWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	for len(w.buf) >= 4 {
+		size := int(binary.BigEndian.Uint32(w.buf))
+		if len(w.buf) < 4+size {
+			break
+		}
+		if w.done {
+			return 0, ErrDecrypt
+		}
+
+		sealed := w.buf[4 : 4+size]
+
+		plaintext, err := w.key.Open(sealed, segmentAD(w.ad, w.idx, false))
+		if err != nil {
+			plaintext, err = w.key.Open(sealed, segmentAD(w.ad, w.idx, true))
+			if err != nil {
+				return 0, ErrDecrypt
+			}
+			w.done = true
+		}
+
+		if _, err = w.dst.Write(plaintext); err != nil {
+			return 0, err
+		}
+
+		w.buf = w.buf[4+size:]
+		w.idx++
+	}
+
+	return len(p), nil
+}
+
+func (w *decryptingWriter) Close() error {
+	if !w.done || len(w.buf) != 0 {
+		return ErrTruncated
+	}
+
+	return nil
+}
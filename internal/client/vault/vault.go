@@ -0,0 +1,141 @@
+// Пакет vault отвечает за шифрование данных на стороне клиента, сервер видит только шифротекст и параметры KDF
+package vault
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+var ErrWrongMasterPassword = errors.New("wrong master password")
+var ErrDecrypt = errors.New("can't decrypt data")
+
+const (
+	saltSize = 16
+	keySize  = chacha20poly1305.KeySize
+
+	defaultTime    = 3
+	defaultMemory  = 64 * 1024
+	defaultThreads = 4
+)
+
+var checkPlaintext = []byte("pam vault key check")
+var checkAD = []byte("check")
+
+// Params параметры argon2id, по которым из мастер пароля получается ключ хранилища.
+// Check - зашифрованная известная строка, по ней проверяется, что мастер пароль верный
+type Params struct {
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+	Check   []byte `json:"check"`
+}
+
+// Key ключ хранилища
+type Key struct {
+	secret []byte
+}
+
+// NewParams создает параметры со случайной солью для нового хранилища и ключ для них
+func NewParams(masterPwd string) (*Params, *Key, error) {
+	p := &Params{
+		Salt:    make([]byte, saltSize),
+		Time:    defaultTime,
+		Memory:  defaultMemory,
+		Threads: defaultThreads,
+	}
+
+	if _, err := rand.Read(p.Salt); err != nil {
+		return nil, nil, err
+	}
+
+	key := p.derive(masterPwd)
+
+	check, err := key.Seal(checkPlaintext, checkAD)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.Check = check
+
+	return p, key, nil
+}
+
+// UnmarshalParams восстанавливает параметры, полученные с сервера
+func UnmarshalParams(data []byte) (*Params, error) {
+	p := &Params{}
+
+	if err := json.Unmarshal(data, p); err != nil {
+		return p, err
+	}
+
+	return p, nil
+}
+
+// Marshal сериализует параметры для хранения на сервере
+func (p *Params) Marshal() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// DeriveKey получает ключ из мастер пароля и проверяет его
+func (p *Params) DeriveKey(masterPwd string) (*Key, error) {
+	key := p.derive(masterPwd)
+
+	if _, err := key.Open(p.Check, checkAD); err != nil {
+		return nil, ErrWrongMasterPassword
+	}
+
+	return key, nil
+}
+
+func (p *Params) derive(masterPwd string) *Key {
+	return &Key{secret: argon2.IDKey([]byte(masterPwd), p.Salt, p.Time, p.Memory, p.Threads, keySize)}
+}
+
+// Seal шифрует plaintext, ad не шифруется, но без него расшифровать не получится.
+// Результат - случайный nonce и шифротекст
+func (k *Key) Seal(plaintext []byte, ad []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(k.secret)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, ad), nil
+}
+
+// Open расшифровывает результат Seal
+func (k *Key) Open(ciphertext []byte, ad []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(k.secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrDecrypt
+	}
+
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, ad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	return plaintext, nil
+}
+
+// RecordAD связывает шифротекст записи с ее именем и типом, чтобы сервер не мог подменить одну запись другой
+func RecordAD(name string, kind int) []byte {
+	ad := make([]byte, 4, 4+len(name))
+	binary.BigEndian.PutUint32(ad, uint32(kind))
+
+	return append(ad, name...)
+}
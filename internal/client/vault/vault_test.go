@@ -0,0 +1,88 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testParams(t *testing.T) (*Params, *Key) {
+	params, key, err := NewParams("master")
+	require.NoError(t, err)
+
+	return params, key
+}
+
+func TestDeriveKey(t *testing.T) {
+	params, key := testParams(t)
+
+	data, err := params.Marshal()
+	require.NoError(t, err)
+	params, err = UnmarshalParams(data)
+	require.NoError(t, err)
+
+	derived, err := params.DeriveKey("master")
+	require.NoError(t, err)
+	assert.Equal(t, key, derived)
+
+	_, err = params.DeriveKey("not master")
+	assert.ErrorIs(t, err, ErrWrongMasterPassword)
+}
+
+func TestSealOpen(t *testing.T) {
+	_, key := testParams(t)
+
+	sealed, err := key.Seal([]byte("secret"), RecordAD("name", 0))
+	require.NoError(t, err)
+	assert.NotContains(t, string(sealed), "secret")
+
+	plaintext, err := key.Open(sealed, RecordAD("name", 0))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("secret"), plaintext)
+
+	_, err = key.Open(sealed, RecordAD("other", 0))
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	_, err = key.Open(sealed, RecordAD("name", 1))
+	assert.ErrorIs(t, err, ErrDecrypt)
+}
+
+func TestStream(t *testing.T) {
+	_, key := testParams(t)
+	ad := RecordAD("file", 3)
+
+	for _, size := range []int{0, 1, segmentSize - 1, segmentSize, segmentSize + 1, 3*segmentSize + 17} {
+		plaintext := make([]byte, size)
+		_, err := rand.Read(plaintext)
+		require.NoError(t, err)
+
+		encrypted, err := io.ReadAll(NewEncryptingReader(key, ad, bytes.NewReader(plaintext)))
+		require.NoError(t, err)
+
+		// transport chunking doesn't have to match segments
+		var out bytes.Buffer
+		w := NewDecryptingWriter(key, ad, &out)
+		for rest := encrypted; len(rest) > 0; {
+			n := min(1000, len(rest))
+			_, err = w.Write(rest[:n])
+			require.NoError(t, err)
+			rest = rest[n:]
+		}
+		require.NoError(t, w.Close())
+		assert.Equal(t, plaintext, append([]byte{}, out.Bytes()...))
+
+		if size > segmentSize {
+			// dropping the last segment must be noticed
+			first := 4 + int(binary.BigEndian.Uint32(encrypted))
+			w = NewDecryptingWriter(key, ad, io.Discard)
+			_, err = w.Write(encrypted[:first])
+			require.NoError(t, err)
+			assert.ErrorIs(t, w.Close(), ErrTruncated)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package datatypes
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCardNumber = errors.New("invalid card number")
+var ErrInvalidExpiry = errors.New("invalid expiry date, expected MM/YY")
+var ErrCardExpired = errors.New("card is expired")
+var ErrInvalidCVV = errors.New("invalid CVV")
+var ErrInvalidPIN = errors.New("invalid PIN")
+
+// CardData данные банковской карты, срок действия хранится в виде MM/YY
+type CardData struct {
+	Number string `json:"number"`
+	Holder string `json:"holder"`
+	Expiry string `json:"expiry"`
+	CVV    string `json:"cvv"`
+	PIN    string `json:"pin,omitempty"`
+}
+
+// Marshal сериализует данные для сохранения в user_data.data
+func (c *CardData) Marshal() ([]byte, error) {
+	return json.Marshal(c)
+}
+
+// UnmarshalCard восстанавливает CardData из сохраненных байт
+func UnmarshalCard(data []byte) (*CardData, error) {
+	c := &CardData{}
+
+	if err := json.Unmarshal(data, c); err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
+
+// Normalize убирает из номера пробелы и дефисы, а из остальных полей лишние пробелы
+func (c *CardData) Normalize() {
+	c.Number = strings.NewReplacer(" ", "", "-", "").Replace(c.Number)
+	c.Holder = strings.TrimSpace(c.Holder)
+	c.Expiry = strings.TrimSpace(c.Expiry)
+	c.CVV = strings.TrimSpace(c.CVV)
+	c.PIN = strings.TrimSpace(c.PIN)
+}
+
+// Validate проверяет номер по алгоритму Луна, срок действия относительно now, CVV и PIN
+func (c *CardData) Validate(now time.Time) error {
+	if !isDigits(c.Number) || len(c.Number) < 12 || len(c.Number) > 19 || !luhnValid(c.Number) {
+		return ErrInvalidCardNumber
+	}
+
+	expiry, err := c.ExpiryTime()
+	if err != nil {
+		return err
+	}
+	if !now.Before(expiry) {
+		return ErrCardExpired
+	}
+
+	if !isDigits(c.CVV) || len(c.CVV) < 3 || len(c.CVV) > 4 {
+		return ErrInvalidCVV
+	}
+
+	if c.PIN != "" && (!isDigits(c.PIN) || len(c.PIN) < 4 || len(c.PIN) > 12) {
+		return ErrInvalidPIN
+	}
+
+	return nil
+}
+
+// ExpiryTime возвращает момент, когда карта перестает действовать - начало месяца, следующего за указанным
+func (c *CardData) ExpiryTime() (time.Time, error) {
+	t, err := time.Parse("01/06", c.Expiry)
+	if err != nil {
+		return time.Time{}, ErrInvalidExpiry
+	}
+
+	return t.AddDate(0, 1, 0), nil
+}
+
+// MaskedNumber возвращает номер, в котором видны только последние 4 цифры
+func (c *CardData) MaskedNumber() string {
+	if len(c.Number) <= 4 {
+		return c.Number
+	}
+
+	masked := strings.Repeat("*", len(c.Number)-4) + c.Number[len(c.Number)-4:]
+
+	return groupDigits(masked)
+}
+
+// FormattedNumber возвращает номер, разбитый на группы по 4 цифры
+func (c *CardData) FormattedNumber() string {
+	return groupDigits(c.Number)
+}
+
+func groupDigits(number string) string {
+	var b strings.Builder
+
+	for i, r := range number {
+		if i != 0 && i%4 == 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func luhnValid(number string) bool {
+	sum := 0
+	double := false
+
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+
+		sum += d
+		double = !double
+	}
+
+	return sum%10 == 0
+}
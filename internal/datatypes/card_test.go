@@ -0,0 +1,73 @@
+package datatypes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCardValidate(t *testing.T) {
+	now := time.Date(2024, time.June, 15, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		card    CardData
+		wantErr error
+	}{
+		{
+			name:    "valid",
+			card:    CardData{Number: "4111 1111 1111 1111", Expiry: "06/24", CVV: "123", PIN: "1234"},
+			wantErr: nil,
+		},
+		{
+			name:    "valid without pin",
+			card:    CardData{Number: "5500-0000-0000-0004", Expiry: "12/30", CVV: "1234"},
+			wantErr: nil,
+		},
+		{
+			name:    "wrong checksum",
+			card:    CardData{Number: "4111111111111112", Expiry: "06/24", CVV: "123"},
+			wantErr: ErrInvalidCardNumber,
+		},
+		{
+			name:    "letters in number",
+			card:    CardData{Number: "41111111111a1111", Expiry: "06/24", CVV: "123"},
+			wantErr: ErrInvalidCardNumber,
+		},
+		{
+			name:    "bad expiry format",
+			card:    CardData{Number: "4111111111111111", Expiry: "2024-06", CVV: "123"},
+			wantErr: ErrInvalidExpiry,
+		},
+		{
+			name:    "expired",
+			card:    CardData{Number: "4111111111111111", Expiry: "05/24", CVV: "123"},
+			wantErr: ErrCardExpired,
+		},
+		{
+			name:    "short cvv",
+			card:    CardData{Number: "4111111111111111", Expiry: "06/24", CVV: "12"},
+			wantErr: ErrInvalidCVV,
+		},
+		{
+			name:    "bad pin",
+			card:    CardData{Number: "4111111111111111", Expiry: "06/24", CVV: "123", PIN: "12"},
+			wantErr: ErrInvalidPIN,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.card.Normalize()
+			assert.Equal(t, test.wantErr, test.card.Validate(now))
+		})
+	}
+}
+
+func TestCardMaskedNumber(t *testing.T) {
+	card := CardData{Number: "4111111111111111"}
+
+	assert.Equal(t, "**** **** **** 1111", card.MaskedNumber())
+	assert.Equal(t, "4111 1111 1111 1111", card.FormattedNumber())
+}
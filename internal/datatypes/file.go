@@ -0,0 +1,26 @@
+package datatypes
+
+import "encoding/json"
+
+// FileData описание сохраненного файла, само содержимое передается и хранится чанками отдельно
+type FileData struct {
+	Filename string `json:"filename"`
+	Mode     uint32 `json:"mode"`
+	Size     int64  `json:"size"`
+}
+
+// Marshal сериализует данные для сохранения в user_data.data
+func (f *FileData) Marshal() ([]byte, error) {
+	return json.Marshal(f)
+}
+
+// UnmarshalFile восстанавливает FileData из сохраненных байт
+func UnmarshalFile(data []byte) (*FileData, error) {
+	f := &FileData{}
+
+	if err := json.Unmarshal(data, f); err != nil {
+		return f, err
+	}
+
+	return f, nil
+}
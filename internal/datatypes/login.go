@@ -0,0 +1,27 @@
+package datatypes
+
+import "encoding/json"
+
+// LoginData пара логин/пароль вместе с адресами, где она используется, и заметками
+type LoginData struct {
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	URLs     []string `json:"urls,omitempty"`
+	Notes    string   `json:"notes,omitempty"`
+}
+
+// Marshal сериализует данные для сохранения в user_data.data
+func (l *LoginData) Marshal() ([]byte, error) {
+	return json.Marshal(l)
+}
+
+// UnmarshalLogin восстанавливает LoginData из сохраненных байт
+func UnmarshalLogin(data []byte) (*LoginData, error) {
+	l := &LoginData{}
+
+	if err := json.Unmarshal(data, l); err != nil {
+		return l, err
+	}
+
+	return l, nil
+}
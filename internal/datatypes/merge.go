@@ -0,0 +1,43 @@
+package datatypes
+
+import (
+	"bytes"
+	"slices"
+)
+
+// MergeText объединяет текст, сохраненный кем-то другим, с новым: если они отличаются, новый текст дописывается в конец
+func MergeText(current []byte, incoming []byte) []byte {
+	if bytes.Equal(current, incoming) || len(current) == 0 {
+		return incoming
+	}
+	if len(incoming) == 0 {
+		return current
+	}
+
+	merged := make([]byte, 0, len(current)+1+len(incoming))
+	merged = append(merged, current...)
+	merged = append(merged, '\n')
+
+	return append(merged, incoming...)
+}
+
+// Merge объединяет новые данные l с данными current, сохраненными кем-то другим.
+// Заполненные поля l имеют приоритет, адреса объединяются, заметки склеиваются
+func (l *LoginData) Merge(current *LoginData) {
+	if l.Username == "" {
+		l.Username = current.Username
+	}
+	if l.Password == "" {
+		l.Password = current.Password
+	}
+
+	urls := slices.Clone(current.URLs)
+	for _, url := range l.URLs {
+		if !slices.Contains(urls, url) {
+			urls = append(urls, url)
+		}
+	}
+	l.URLs = urls
+
+	l.Notes = string(MergeText([]byte(current.Notes), []byte(l.Notes)))
+}
@@ -0,0 +1,37 @@
+package datatypes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeText(t *testing.T) {
+	assert.Equal(t, []byte("same"), MergeText([]byte("same"), []byte("same")))
+	assert.Equal(t, []byte("new"), MergeText(nil, []byte("new")))
+	assert.Equal(t, []byte("old"), MergeText([]byte("old"), nil))
+	assert.Equal(t, []byte("old\nnew"), MergeText([]byte("old"), []byte("new")))
+}
+
+func TestLoginMerge(t *testing.T) {
+	current := &LoginData{
+		Username: "alice",
+		Password: "old",
+		URLs:     []string{"https://a.example", "https://b.example"},
+		Notes:    "old notes",
+	}
+	incoming := &LoginData{
+		Password: "new",
+		URLs:     []string{"https://b.example", "https://c.example"},
+	}
+
+	incoming.Merge(current)
+
+	assert.Equal(t, &LoginData{
+		Username: "alice",
+		Password: "new",
+		URLs:     []string{"https://a.example", "https://b.example", "https://c.example"},
+		Notes:    "old notes",
+	}, incoming)
+	assert.Equal(t, []string{"https://a.example", "https://b.example"}, current.URLs)
+}
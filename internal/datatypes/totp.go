@@ -0,0 +1,255 @@
+package datatypes
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidTOTPSecret = errors.New("invalid TOTP secret, expected base32")
+var ErrInvalidOTPAuthURI = errors.New("invalid otpauth URI")
+var ErrUnsupportedTOTPAlgorithm = errors.New("unsupported TOTP algorithm")
+
+const (
+	defaultTOTPDigits = 6
+	defaultTOTPPeriod = 30
+)
+
+// TOTPData секрет для генерации одноразовых кодов по RFC 6238
+type TOTPData struct {
+	Secret    string `json:"secret"`
+	Issuer    string `json:"issuer,omitempty"`
+	Account   string `json:"account,omitempty"`
+	Algorithm string `json:"algorithm"`
+	Digits    int    `json:"digits"`
+	Period    int    `json:"period"`
+}
+
+// NewTOTP создает TOTPData с параметрами по умолчанию: SHA1, 6 цифр, 30 секунд
+func NewTOTP(secret string) *TOTPData {
+	return &TOTPData{
+		Secret:    normalizeSecret(secret),
+		Algorithm: "SHA1",
+		Digits:    defaultTOTPDigits,
+		Period:    defaultTOTPPeriod,
+	}
+}
+
+// GenerateTOTP создает TOTPData с параметрами по умолчанию и случайным 160 битным секретом
+func GenerateTOTP(issuer string, account string) (*TOTPData, error) {
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	t := NewTOTP(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(key))
+	t.Issuer = issuer
+	t.Account = account
+
+	return t, nil
+}
+
+// URI возвращает otpauth:// URI, который понимают приложения-аутентификаторы
+func (t *TOTPData) URI() string {
+	q := url.Values{}
+	q.Set("secret", normalizeSecret(t.Secret))
+	if t.Issuer != "" {
+		q.Set("issuer", t.Issuer)
+	}
+	q.Set("algorithm", t.Algorithm)
+	q.Set("digits", strconv.Itoa(t.Digits))
+	q.Set("period", strconv.Itoa(t.Period))
+
+	label := t.Account
+	if t.Issuer != "" {
+		label = t.Issuer + ":" + t.Account
+	}
+
+	u := url.URL{Scheme: "otpauth", Host: "totp", Path: "/" + label, RawQuery: q.Encode()}
+	return u.String()
+}
+
+// ParseOTPAuthURI разбирает URI вида otpauth://totp/Issuer:account?secret=...&issuer=...
+func ParseOTPAuthURI(uri string) (*TOTPData, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, ErrInvalidOTPAuthURI
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" {
+		return nil, ErrInvalidOTPAuthURI
+	}
+
+	q := u.Query()
+	t := NewTOTP(q.Get("secret"))
+
+	label := strings.TrimPrefix(u.Path, "/")
+	if issuer, account, ok := strings.Cut(label, ":"); ok {
+		t.Issuer = strings.TrimSpace(issuer)
+		t.Account = strings.TrimSpace(account)
+	} else {
+		t.Account = label
+	}
+	if issuer := q.Get("issuer"); issuer != "" {
+		t.Issuer = issuer
+	}
+
+	if algorithm := q.Get("algorithm"); algorithm != "" {
+		t.Algorithm = strings.ToUpper(algorithm)
+	}
+	if digits := q.Get("digits"); digits != "" {
+		if t.Digits, err = strconv.Atoi(digits); err != nil {
+			return nil, ErrInvalidOTPAuthURI
+		}
+	}
+	if period := q.Get("period"); period != "" {
+		if t.Period, err = strconv.Atoi(period); err != nil {
+			return nil, ErrInvalidOTPAuthURI
+		}
+	}
+
+	if err = t.Validate(); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Marshal сериализует данные для сохранения в user_data.data
+func (t *TOTPData) Marshal() ([]byte, error) {
+	return json.Marshal(t)
+}
+
+// UnmarshalTOTP восстанавливает TOTPData из сохраненных байт
+func UnmarshalTOTP(data []byte) (*TOTPData, error) {
+	t := &TOTPData{}
+
+	if err := json.Unmarshal(data, t); err != nil {
+		return t, err
+	}
+
+	return t, nil
+}
+
+// Validate проверяет, что по этим параметрам можно сгенерировать код
+func (t *TOTPData) Validate() error {
+	if _, err := t.key(); err != nil {
+		return err
+	}
+	if _, err := t.hash(); err != nil {
+		return err
+	}
+	if t.Digits < 6 || t.Digits > 10 {
+		return fmt.Errorf("%w: digits must be between 6 and 10", ErrInvalidOTPAuthURI)
+	}
+	if t.Period <= 0 {
+		return fmt.Errorf("%w: period must be positive", ErrInvalidOTPAuthURI)
+	}
+
+	return nil
+}
+
+// Code возвращает код, действующий в момент now
+func (t *TOTPData) Code(now time.Time) (string, error) {
+	key, err := t.key()
+	if err != nil {
+		return "", err
+	}
+	h, err := t.hash()
+	if err != nil {
+		return "", err
+	}
+
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(now.Unix())/uint64(t.Period))
+
+	mac := hmac.New(h, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := uint64(binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff)
+
+	mod := uint64(1)
+	for i := 0; i < t.Digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", t.Digits, value%mod), nil
+}
+
+// Verify проверяет код, допуская расхождение часов на skew периодов в обе стороны.
+// Возвращает номер периода, которому соответствует код, чтобы один код нельзя было использовать дважды
+func (t *TOTPData) Verify(code string, now time.Time, skew int) (int64, bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != t.Digits {
+		return 0, false
+	}
+
+	period := int64(t.Period)
+	for i := -skew; i <= skew; i++ {
+		at := now.Add(time.Duration(i*t.Period) * time.Second)
+
+		want, err := t.Code(at)
+		if err != nil {
+			return 0, false
+		}
+
+		if hmac.Equal([]byte(want), []byte(code)) {
+			return at.Unix() / period, true
+		}
+	}
+
+	return 0, false
+}
+
+// Remaining возвращает сколько еще будет действовать код, действующий в момент now
+func (t *TOTPData) Remaining(now time.Time) time.Duration {
+	period := time.Duration(t.Period) * time.Second
+
+	return period - time.Duration(now.UnixNano())%period
+}
+
+func (t *TOTPData) key() ([]byte, error) {
+	secret := normalizeSecret(t.Secret)
+	if secret == "" {
+		return nil, ErrInvalidTOTPSecret
+	}
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return nil, ErrInvalidTOTPSecret
+	}
+
+	return key, nil
+}
+
+func (t *TOTPData) hash() (func() hash.Hash, error) {
+	switch t.Algorithm {
+	case "SHA1", "":
+		return sha1.New, nil
+	case "SHA256":
+		return sha256.New, nil
+	case "SHA512":
+		return sha512.New, nil
+	default:
+		return nil, ErrUnsupportedTOTPAlgorithm
+	}
+}
+
+func normalizeSecret(secret string) string {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+
+	return strings.TrimRight(secret, "=")
+}
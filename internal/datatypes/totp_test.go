@@ -0,0 +1,124 @@
+package datatypes
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// test vectors from RFC 6238 appendix B
+	secrets := map[string]string{
+		"SHA1":   "12345678901234567890",
+		"SHA256": "12345678901234567890123456789012",
+		"SHA512": "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+
+	tests := []struct {
+		unix      int64
+		algorithm string
+		want      string
+	}{
+		{unix: 59, algorithm: "SHA1", want: "94287082"},
+		{unix: 59, algorithm: "SHA256", want: "46119246"},
+		{unix: 59, algorithm: "SHA512", want: "90693936"},
+		{unix: 1111111109, algorithm: "SHA1", want: "07081804"},
+		{unix: 1234567890, algorithm: "SHA256", want: "91819424"},
+		{unix: 20000000000, algorithm: "SHA512", want: "47863826"},
+	}
+
+	for _, test := range tests {
+		totp := NewTOTP(base32.StdEncoding.EncodeToString([]byte(secrets[test.algorithm])))
+		totp.Algorithm = test.algorithm
+		totp.Digits = 8
+
+		code, err := totp.Code(time.Unix(test.unix, 0))
+		require.NoError(t, err)
+		assert.Equal(t, test.want, code)
+	}
+}
+
+func TestParseOTPAuthURI(t *testing.T) {
+	tests := []struct {
+		uri     string
+		want    *TOTPData
+		wantErr bool
+	}{
+		{
+			uri: "otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Example",
+			want: &TOTPData{
+				Secret:    "JBSWY3DPEHPK3PXP",
+				Issuer:    "Example",
+				Account:   "alice@google.com",
+				Algorithm: "SHA1",
+				Digits:    6,
+				Period:    30,
+			},
+		},
+		{
+			uri: "otpauth://totp/bob?secret=jbswy3dpehpk3pxp&algorithm=sha256&digits=8&period=60",
+			want: &TOTPData{
+				Secret:    "JBSWY3DPEHPK3PXP",
+				Account:   "bob",
+				Algorithm: "SHA256",
+				Digits:    8,
+				Period:    60,
+			},
+		},
+		{
+			uri:     "otpauth://hotp/bob?secret=JBSWY3DPEHPK3PXP",
+			wantErr: true,
+		},
+		{
+			uri:     "otpauth://totp/bob?secret=not-base32!",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		totp, err := ParseOTPAuthURI(test.uri)
+		if test.wantErr {
+			assert.Error(t, err)
+			continue
+		}
+
+		require.NoError(t, err)
+		assert.Equal(t, test.want, totp)
+	}
+}
+
+func TestTOTPVerify(t *testing.T) {
+	totp, err := GenerateTOTP("pam", "user")
+	require.NoError(t, err)
+	require.NoError(t, totp.Validate())
+
+	now := time.Unix(1700000000, 0)
+	code, err := totp.Code(now)
+	require.NoError(t, err)
+
+	counter, ok := totp.Verify(code, now, 1)
+	assert.True(t, ok)
+	assert.Equal(t, now.Unix()/30, counter)
+
+	// the previous code is still accepted with a skew of one period
+	_, ok = totp.Verify(code, now.Add(30*time.Second), 1)
+	assert.True(t, ok)
+
+	_, ok = totp.Verify(code, now.Add(90*time.Second), 1)
+	assert.False(t, ok)
+
+	_, ok = totp.Verify("12345", now, 1)
+	assert.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	totp, err := GenerateTOTP("pam", "user")
+	require.NoError(t, err)
+
+	parsed, err := ParseOTPAuthURI(totp.URI())
+	require.NoError(t, err)
+	assert.Equal(t, totp, parsed)
+}
@@ -2,4 +2,8 @@ package datatypes
 
 const (
 	Text int = iota
+	Login
+	Card
+	File
+	TOTP
 )
@@ -19,11 +19,31 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	PamServer_Register_FullMethodName     = "/PamServer/Register"
-	PamServer_Authenticate_FullMethodName = "/PamServer/Authenticate"
-	PamServer_Upload_FullMethodName       = "/PamServer/Upload"
-	PamServer_Get_FullMethodName          = "/PamServer/Get"
-	PamServer_GetNames_FullMethodName     = "/PamServer/GetNames"
+	PamServer_Register_FullMethodName                = "/PamServer/Register"
+	PamServer_Authenticate_FullMethodName            = "/PamServer/Authenticate"
+	PamServer_Upload_FullMethodName                  = "/PamServer/Upload"
+	PamServer_Get_FullMethodName                     = "/PamServer/Get"
+	PamServer_GetNames_FullMethodName                = "/PamServer/GetNames"
+	PamServer_Delete_FullMethodName                  = "/PamServer/Delete"
+	PamServer_ListVersions_FullMethodName            = "/PamServer/ListVersions"
+	PamServer_GetVersion_FullMethodName              = "/PamServer/GetVersion"
+	PamServer_Restore_FullMethodName                 = "/PamServer/Restore"
+	PamServer_UploadFile_FullMethodName              = "/PamServer/UploadFile"
+	PamServer_DownloadFile_FullMethodName            = "/PamServer/DownloadFile"
+	PamServer_GetVaultParams_FullMethodName          = "/PamServer/GetVaultParams"
+	PamServer_SetVaultParams_FullMethodName          = "/PamServer/SetVaultParams"
+	PamServer_Sync_FullMethodName                    = "/PamServer/Sync"
+	PamServer_Logout_FullMethodName                  = "/PamServer/Logout"
+	PamServer_RevokeToken_FullMethodName             = "/PamServer/RevokeToken"
+	PamServer_ListSessions_FullMethodName            = "/PamServer/ListSessions"
+	PamServer_EnableTwoFactor_FullMethodName         = "/PamServer/EnableTwoFactor"
+	PamServer_ConfirmTwoFactor_FullMethodName        = "/PamServer/ConfirmTwoFactor"
+	PamServer_DisableTwoFactor_FullMethodName        = "/PamServer/DisableTwoFactor"
+	PamServer_RegenerateRecoveryCodes_FullMethodName = "/PamServer/RegenerateRecoveryCodes"
+	PamServer_ChangePassword_FullMethodName          = "/PamServer/ChangePassword"
+	PamServer_DeleteAccount_FullMethodName           = "/PamServer/DeleteAccount"
+	PamServer_CreateApiToken_FullMethodName          = "/PamServer/CreateApiToken"
+	PamServer_ListApiTokens_FullMethodName           = "/PamServer/ListApiTokens"
 )
 
 // PamServerClient is the client API for PamServer service.
@@ -35,6 +55,26 @@ type PamServerClient interface {
 	Upload(ctx context.Context, in *UploadData, opts ...grpc.CallOption) (*UploadResponse, error)
 	Get(ctx context.Context, in *GetData, opts ...grpc.CallOption) (*GetDataResponse, error)
 	GetNames(ctx context.Context, in *GetDataNames, opts ...grpc.CallOption) (*GetDataNamesResponse, error)
+	Delete(ctx context.Context, in *DeleteData, opts ...grpc.CallOption) (*DeleteDataResponse, error)
+	ListVersions(ctx context.Context, in *GetDataVersions, opts ...grpc.CallOption) (*GetDataVersionsResponse, error)
+	GetVersion(ctx context.Context, in *GetDataVersion, opts ...grpc.CallOption) (*GetDataResponse, error)
+	Restore(ctx context.Context, in *RestoreData, opts ...grpc.CallOption) (*RestoreDataResponse, error)
+	UploadFile(ctx context.Context, opts ...grpc.CallOption) (PamServer_UploadFileClient, error)
+	DownloadFile(ctx context.Context, in *GetData, opts ...grpc.CallOption) (PamServer_DownloadFileClient, error)
+	GetVaultParams(ctx context.Context, in *VaultParamsRequest, opts ...grpc.CallOption) (*VaultParams, error)
+	SetVaultParams(ctx context.Context, in *VaultParams, opts ...grpc.CallOption) (*SetVaultParamsResponse, error)
+	Sync(ctx context.Context, in *SyncRequest, opts ...grpc.CallOption) (*SyncResponse, error)
+	Logout(ctx context.Context, in *LogoutRequest, opts ...grpc.CallOption) (*LogoutResponse, error)
+	RevokeToken(ctx context.Context, in *RevokeTokenRequest, opts ...grpc.CallOption) (*RevokeTokenResponse, error)
+	ListSessions(ctx context.Context, in *ListSessionsRequest, opts ...grpc.CallOption) (*ListSessionsResponse, error)
+	EnableTwoFactor(ctx context.Context, in *EnableTwoFactorRequest, opts ...grpc.CallOption) (*EnableTwoFactorResponse, error)
+	ConfirmTwoFactor(ctx context.Context, in *ConfirmTwoFactorRequest, opts ...grpc.CallOption) (*ConfirmTwoFactorResponse, error)
+	DisableTwoFactor(ctx context.Context, in *DisableTwoFactorRequest, opts ...grpc.CallOption) (*DisableTwoFactorResponse, error)
+	RegenerateRecoveryCodes(ctx context.Context, in *RegenerateRecoveryCodesRequest, opts ...grpc.CallOption) (*RegenerateRecoveryCodesResponse, error)
+	ChangePassword(ctx context.Context, in *ChangePasswordRequest, opts ...grpc.CallOption) (*ChangePasswordResponse, error)
+	DeleteAccount(ctx context.Context, in *DeleteAccountRequest, opts ...grpc.CallOption) (*DeleteAccountResponse, error)
+	CreateApiToken(ctx context.Context, in *CreateApiTokenRequest, opts ...grpc.CallOption) (*CreateApiTokenResponse, error)
+	ListApiTokens(ctx context.Context, in *ListApiTokensRequest, opts ...grpc.CallOption) (*ListApiTokensResponse, error)
 }
 
 type pamServerClient struct {
@@ -90,6 +130,234 @@ func (c *pamServerClient) GetNames(ctx context.Context, in *GetDataNames, opts .
 	return out, nil
 }
 
+func (c *pamServerClient) Delete(ctx context.Context, in *DeleteData, opts ...grpc.CallOption) (*DeleteDataResponse, error) {
+	out := new(DeleteDataResponse)
+	err := c.cc.Invoke(ctx, PamServer_Delete_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pamServerClient) ListVersions(ctx context.Context, in *GetDataVersions, opts ...grpc.CallOption) (*GetDataVersionsResponse, error) {
+	out := new(GetDataVersionsResponse)
+	err := c.cc.Invoke(ctx, PamServer_ListVersions_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pamServerClient) GetVersion(ctx context.Context, in *GetDataVersion, opts ...grpc.CallOption) (*GetDataResponse, error) {
+	out := new(GetDataResponse)
+	err := c.cc.Invoke(ctx, PamServer_GetVersion_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pamServerClient) Restore(ctx context.Context, in *RestoreData, opts ...grpc.CallOption) (*RestoreDataResponse, error) {
+	out := new(RestoreDataResponse)
+	err := c.cc.Invoke(ctx, PamServer_Restore_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pamServerClient) UploadFile(ctx context.Context, opts ...grpc.CallOption) (PamServer_UploadFileClient, error) {
+	stream, err := c.cc.NewStream(ctx, &PamServer_ServiceDesc.Streams[0], PamServer_UploadFile_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &pamServerUploadFileClient{stream}
+	return x, nil
+}
+
+type PamServer_UploadFileClient interface {
+	Send(*UploadFileChunk) error
+	CloseAndRecv() (*UploadResponse, error)
+	grpc.ClientStream
+}
+
+type pamServerUploadFileClient struct {
+	grpc.ClientStream
+}
+
+func (x *pamServerUploadFileClient) Send(m *UploadFileChunk) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *pamServerUploadFileClient) CloseAndRecv() (*UploadResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(UploadResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *pamServerClient) DownloadFile(ctx context.Context, in *GetData, opts ...grpc.CallOption) (PamServer_DownloadFileClient, error) {
+	stream, err := c.cc.NewStream(ctx, &PamServer_ServiceDesc.Streams[1], PamServer_DownloadFile_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &pamServerDownloadFileClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type PamServer_DownloadFileClient interface {
+	Recv() (*FileChunk, error)
+	grpc.ClientStream
+}
+
+type pamServerDownloadFileClient struct {
+	grpc.ClientStream
+}
+
+func (x *pamServerDownloadFileClient) Recv() (*FileChunk, error) {
+	m := new(FileChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *pamServerClient) GetVaultParams(ctx context.Context, in *VaultParamsRequest, opts ...grpc.CallOption) (*VaultParams, error) {
+	out := new(VaultParams)
+	err := c.cc.Invoke(ctx, PamServer_GetVaultParams_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pamServerClient) SetVaultParams(ctx context.Context, in *VaultParams, opts ...grpc.CallOption) (*SetVaultParamsResponse, error) {
+	out := new(SetVaultParamsResponse)
+	err := c.cc.Invoke(ctx, PamServer_SetVaultParams_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pamServerClient) Sync(ctx context.Context, in *SyncRequest, opts ...grpc.CallOption) (*SyncResponse, error) {
+	out := new(SyncResponse)
+	err := c.cc.Invoke(ctx, PamServer_Sync_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pamServerClient) Logout(ctx context.Context, in *LogoutRequest, opts ...grpc.CallOption) (*LogoutResponse, error) {
+	out := new(LogoutResponse)
+	err := c.cc.Invoke(ctx, PamServer_Logout_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pamServerClient) RevokeToken(ctx context.Context, in *RevokeTokenRequest, opts ...grpc.CallOption) (*RevokeTokenResponse, error) {
+	out := new(RevokeTokenResponse)
+	err := c.cc.Invoke(ctx, PamServer_RevokeToken_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pamServerClient) ListSessions(ctx context.Context, in *ListSessionsRequest, opts ...grpc.CallOption) (*ListSessionsResponse, error) {
+	out := new(ListSessionsResponse)
+	err := c.cc.Invoke(ctx, PamServer_ListSessions_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pamServerClient) EnableTwoFactor(ctx context.Context, in *EnableTwoFactorRequest, opts ...grpc.CallOption) (*EnableTwoFactorResponse, error) {
+	out := new(EnableTwoFactorResponse)
+	err := c.cc.Invoke(ctx, PamServer_EnableTwoFactor_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pamServerClient) ConfirmTwoFactor(ctx context.Context, in *ConfirmTwoFactorRequest, opts ...grpc.CallOption) (*ConfirmTwoFactorResponse, error) {
+	out := new(ConfirmTwoFactorResponse)
+	err := c.cc.Invoke(ctx, PamServer_ConfirmTwoFactor_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pamServerClient) DisableTwoFactor(ctx context.Context, in *DisableTwoFactorRequest, opts ...grpc.CallOption) (*DisableTwoFactorResponse, error) {
+	out := new(DisableTwoFactorResponse)
+	err := c.cc.Invoke(ctx, PamServer_DisableTwoFactor_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pamServerClient) RegenerateRecoveryCodes(ctx context.Context, in *RegenerateRecoveryCodesRequest, opts ...grpc.CallOption) (*RegenerateRecoveryCodesResponse, error) {
+	out := new(RegenerateRecoveryCodesResponse)
+	err := c.cc.Invoke(ctx, PamServer_RegenerateRecoveryCodes_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pamServerClient) ChangePassword(ctx context.Context, in *ChangePasswordRequest, opts ...grpc.CallOption) (*ChangePasswordResponse, error) {
+	out := new(ChangePasswordResponse)
+	err := c.cc.Invoke(ctx, PamServer_ChangePassword_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pamServerClient) DeleteAccount(ctx context.Context, in *DeleteAccountRequest, opts ...grpc.CallOption) (*DeleteAccountResponse, error) {
+	out := new(DeleteAccountResponse)
+	err := c.cc.Invoke(ctx, PamServer_DeleteAccount_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pamServerClient) CreateApiToken(ctx context.Context, in *CreateApiTokenRequest, opts ...grpc.CallOption) (*CreateApiTokenResponse, error) {
+	out := new(CreateApiTokenResponse)
+	err := c.cc.Invoke(ctx, PamServer_CreateApiToken_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pamServerClient) ListApiTokens(ctx context.Context, in *ListApiTokensRequest, opts ...grpc.CallOption) (*ListApiTokensResponse, error) {
+	out := new(ListApiTokensResponse)
+	err := c.cc.Invoke(ctx, PamServer_ListApiTokens_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // PamServerServer is the server API for PamServer service.
 // All implementations must embed UnimplementedPamServerServer
 // for forward compatibility
@@ -99,6 +367,26 @@ type PamServerServer interface {
 	Upload(context.Context, *UploadData) (*UploadResponse, error)
 	Get(context.Context, *GetData) (*GetDataResponse, error)
 	GetNames(context.Context, *GetDataNames) (*GetDataNamesResponse, error)
+	Delete(context.Context, *DeleteData) (*DeleteDataResponse, error)
+	ListVersions(context.Context, *GetDataVersions) (*GetDataVersionsResponse, error)
+	GetVersion(context.Context, *GetDataVersion) (*GetDataResponse, error)
+	Restore(context.Context, *RestoreData) (*RestoreDataResponse, error)
+	UploadFile(PamServer_UploadFileServer) error
+	DownloadFile(*GetData, PamServer_DownloadFileServer) error
+	GetVaultParams(context.Context, *VaultParamsRequest) (*VaultParams, error)
+	SetVaultParams(context.Context, *VaultParams) (*SetVaultParamsResponse, error)
+	Sync(context.Context, *SyncRequest) (*SyncResponse, error)
+	Logout(context.Context, *LogoutRequest) (*LogoutResponse, error)
+	RevokeToken(context.Context, *RevokeTokenRequest) (*RevokeTokenResponse, error)
+	ListSessions(context.Context, *ListSessionsRequest) (*ListSessionsResponse, error)
+	EnableTwoFactor(context.Context, *EnableTwoFactorRequest) (*EnableTwoFactorResponse, error)
+	ConfirmTwoFactor(context.Context, *ConfirmTwoFactorRequest) (*ConfirmTwoFactorResponse, error)
+	DisableTwoFactor(context.Context, *DisableTwoFactorRequest) (*DisableTwoFactorResponse, error)
+	RegenerateRecoveryCodes(context.Context, *RegenerateRecoveryCodesRequest) (*RegenerateRecoveryCodesResponse, error)
+	ChangePassword(context.Context, *ChangePasswordRequest) (*ChangePasswordResponse, error)
+	DeleteAccount(context.Context, *DeleteAccountRequest) (*DeleteAccountResponse, error)
+	CreateApiToken(context.Context, *CreateApiTokenRequest) (*CreateApiTokenResponse, error)
+	ListApiTokens(context.Context, *ListApiTokensRequest) (*ListApiTokensResponse, error)
 	mustEmbedUnimplementedPamServerServer()
 }
 
@@ -121,6 +409,66 @@ func (UnimplementedPamServerServer) Get(context.Context, *GetData) (*GetDataResp
 func (UnimplementedPamServerServer) GetNames(context.Context, *GetDataNames) (*GetDataNamesResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetNames not implemented")
 }
+func (UnimplementedPamServerServer) Delete(context.Context, *DeleteData) (*DeleteDataResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedPamServerServer) ListVersions(context.Context, *GetDataVersions) (*GetDataVersionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListVersions not implemented")
+}
+func (UnimplementedPamServerServer) GetVersion(context.Context, *GetDataVersion) (*GetDataResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetVersion not implemented")
+}
+func (UnimplementedPamServerServer) Restore(context.Context, *RestoreData) (*RestoreDataResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Restore not implemented")
+}
+func (UnimplementedPamServerServer) UploadFile(PamServer_UploadFileServer) error {
+	return status.Errorf(codes.Unimplemented, "method UploadFile not implemented")
+}
+func (UnimplementedPamServerServer) DownloadFile(*GetData, PamServer_DownloadFileServer) error {
+	return status.Errorf(codes.Unimplemented, "method DownloadFile not implemented")
+}
+func (UnimplementedPamServerServer) GetVaultParams(context.Context, *VaultParamsRequest) (*VaultParams, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetVaultParams not implemented")
+}
+func (UnimplementedPamServerServer) SetVaultParams(context.Context, *VaultParams) (*SetVaultParamsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetVaultParams not implemented")
+}
+func (UnimplementedPamServerServer) Sync(context.Context, *SyncRequest) (*SyncResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Sync not implemented")
+}
+func (UnimplementedPamServerServer) Logout(context.Context, *LogoutRequest) (*LogoutResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Logout not implemented")
+}
+func (UnimplementedPamServerServer) RevokeToken(context.Context, *RevokeTokenRequest) (*RevokeTokenResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeToken not implemented")
+}
+func (UnimplementedPamServerServer) ListSessions(context.Context, *ListSessionsRequest) (*ListSessionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSessions not implemented")
+}
+func (UnimplementedPamServerServer) EnableTwoFactor(context.Context, *EnableTwoFactorRequest) (*EnableTwoFactorResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EnableTwoFactor not implemented")
+}
+func (UnimplementedPamServerServer) ConfirmTwoFactor(context.Context, *ConfirmTwoFactorRequest) (*ConfirmTwoFactorResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ConfirmTwoFactor not implemented")
+}
+func (UnimplementedPamServerServer) DisableTwoFactor(context.Context, *DisableTwoFactorRequest) (*DisableTwoFactorResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DisableTwoFactor not implemented")
+}
+func (UnimplementedPamServerServer) RegenerateRecoveryCodes(context.Context, *RegenerateRecoveryCodesRequest) (*RegenerateRecoveryCodesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RegenerateRecoveryCodes not implemented")
+}
+func (UnimplementedPamServerServer) ChangePassword(context.Context, *ChangePasswordRequest) (*ChangePasswordResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ChangePassword not implemented")
+}
+func (UnimplementedPamServerServer) DeleteAccount(context.Context, *DeleteAccountRequest) (*DeleteAccountResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteAccount not implemented")
+}
+func (UnimplementedPamServerServer) CreateApiToken(context.Context, *CreateApiTokenRequest) (*CreateApiTokenResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateApiToken not implemented")
+}
+func (UnimplementedPamServerServer) ListApiTokens(context.Context, *ListApiTokensRequest) (*ListApiTokensResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListApiTokens not implemented")
+}
 func (UnimplementedPamServerServer) mustEmbedUnimplementedPamServerServer() {}
 
 // UnsafePamServerServer may be embedded to opt out of forward compatibility for this service.
@@ -224,6 +572,377 @@ func _PamServer_GetNames_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _PamServer_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteData)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PamServerServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PamServer_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PamServerServer).Delete(ctx, req.(*DeleteData))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PamServer_ListVersions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDataVersions)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PamServerServer).ListVersions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PamServer_ListVersions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PamServerServer).ListVersions(ctx, req.(*GetDataVersions))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PamServer_GetVersion_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDataVersion)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PamServerServer).GetVersion(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PamServer_GetVersion_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PamServerServer).GetVersion(ctx, req.(*GetDataVersion))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PamServer_Restore_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreData)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PamServerServer).Restore(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PamServer_Restore_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PamServerServer).Restore(ctx, req.(*RestoreData))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PamServer_UploadFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(PamServerServer).UploadFile(&pamServerUploadFileServer{stream})
+}
+
+type PamServer_UploadFileServer interface {
+	SendAndClose(*UploadResponse) error
+	Recv() (*UploadFileChunk, error)
+	grpc.ServerStream
+}
+
+type pamServerUploadFileServer struct {
+	grpc.ServerStream
+}
+
+func (x *pamServerUploadFileServer) SendAndClose(m *UploadResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *pamServerUploadFileServer) Recv() (*UploadFileChunk, error) {
+	m := new(UploadFileChunk)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _PamServer_DownloadFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetData)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PamServerServer).DownloadFile(m, &pamServerDownloadFileServer{stream})
+}
+
+type PamServer_DownloadFileServer interface {
+	Send(*FileChunk) error
+	grpc.ServerStream
+}
+
+type pamServerDownloadFileServer struct {
+	grpc.ServerStream
+}
+
+func (x *pamServerDownloadFileServer) Send(m *FileChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _PamServer_GetVaultParams_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VaultParamsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PamServerServer).GetVaultParams(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PamServer_GetVaultParams_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PamServerServer).GetVaultParams(ctx, req.(*VaultParamsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PamServer_SetVaultParams_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VaultParams)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PamServerServer).SetVaultParams(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PamServer_SetVaultParams_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PamServerServer).SetVaultParams(ctx, req.(*VaultParams))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PamServer_Sync_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SyncRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PamServerServer).Sync(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PamServer_Sync_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PamServerServer).Sync(ctx, req.(*SyncRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PamServer_Logout_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LogoutRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PamServerServer).Logout(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PamServer_Logout_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PamServerServer).Logout(ctx, req.(*LogoutRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PamServer_RevokeToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevokeTokenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PamServerServer).RevokeToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PamServer_RevokeToken_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PamServerServer).RevokeToken(ctx, req.(*RevokeTokenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PamServer_ListSessions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSessionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PamServerServer).ListSessions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PamServer_ListSessions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PamServerServer).ListSessions(ctx, req.(*ListSessionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PamServer_EnableTwoFactor_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EnableTwoFactorRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PamServerServer).EnableTwoFactor(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PamServer_EnableTwoFactor_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PamServerServer).EnableTwoFactor(ctx, req.(*EnableTwoFactorRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PamServer_ConfirmTwoFactor_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConfirmTwoFactorRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PamServerServer).ConfirmTwoFactor(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PamServer_ConfirmTwoFactor_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PamServerServer).ConfirmTwoFactor(ctx, req.(*ConfirmTwoFactorRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PamServer_DisableTwoFactor_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DisableTwoFactorRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PamServerServer).DisableTwoFactor(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PamServer_DisableTwoFactor_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PamServerServer).DisableTwoFactor(ctx, req.(*DisableTwoFactorRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PamServer_RegenerateRecoveryCodes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegenerateRecoveryCodesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PamServerServer).RegenerateRecoveryCodes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PamServer_RegenerateRecoveryCodes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PamServerServer).RegenerateRecoveryCodes(ctx, req.(*RegenerateRecoveryCodesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PamServer_ChangePassword_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChangePasswordRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PamServerServer).ChangePassword(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PamServer_ChangePassword_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PamServerServer).ChangePassword(ctx, req.(*ChangePasswordRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PamServer_DeleteAccount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteAccountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PamServerServer).DeleteAccount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PamServer_DeleteAccount_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PamServerServer).DeleteAccount(ctx, req.(*DeleteAccountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PamServer_CreateApiToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateApiTokenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PamServerServer).CreateApiToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PamServer_CreateApiToken_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PamServerServer).CreateApiToken(ctx, req.(*CreateApiTokenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PamServer_ListApiTokens_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListApiTokensRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PamServerServer).ListApiTokens(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PamServer_ListApiTokens_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PamServerServer).ListApiTokens(ctx, req.(*ListApiTokensRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // PamServer_ServiceDesc is the grpc.ServiceDesc for PamServer service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -251,7 +970,90 @@ var PamServer_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetNames",
 			Handler:    _PamServer_GetNames_Handler,
 		},
+		{
+			MethodName: "Delete",
+			Handler:    _PamServer_Delete_Handler,
+		},
+		{
+			MethodName: "ListVersions",
+			Handler:    _PamServer_ListVersions_Handler,
+		},
+		{
+			MethodName: "GetVersion",
+			Handler:    _PamServer_GetVersion_Handler,
+		},
+		{
+			MethodName: "Restore",
+			Handler:    _PamServer_Restore_Handler,
+		},
+		{
+			MethodName: "GetVaultParams",
+			Handler:    _PamServer_GetVaultParams_Handler,
+		},
+		{
+			MethodName: "SetVaultParams",
+			Handler:    _PamServer_SetVaultParams_Handler,
+		},
+		{
+			MethodName: "Sync",
+			Handler:    _PamServer_Sync_Handler,
+		},
+		{
+			MethodName: "Logout",
+			Handler:    _PamServer_Logout_Handler,
+		},
+		{
+			MethodName: "RevokeToken",
+			Handler:    _PamServer_RevokeToken_Handler,
+		},
+		{
+			MethodName: "ListSessions",
+			Handler:    _PamServer_ListSessions_Handler,
+		},
+		{
+			MethodName: "EnableTwoFactor",
+			Handler:    _PamServer_EnableTwoFactor_Handler,
+		},
+		{
+			MethodName: "ConfirmTwoFactor",
+			Handler:    _PamServer_ConfirmTwoFactor_Handler,
+		},
+		{
+			MethodName: "DisableTwoFactor",
+			Handler:    _PamServer_DisableTwoFactor_Handler,
+		},
+		{
+			MethodName: "RegenerateRecoveryCodes",
+			Handler:    _PamServer_RegenerateRecoveryCodes_Handler,
+		},
+		{
+			MethodName: "ChangePassword",
+			Handler:    _PamServer_ChangePassword_Handler,
+		},
+		{
+			MethodName: "DeleteAccount",
+			Handler:    _PamServer_DeleteAccount_Handler,
+		},
+		{
+			MethodName: "CreateApiToken",
+			Handler:    _PamServer_CreateApiToken_Handler,
+		},
+		{
+			MethodName: "ListApiTokens",
+			Handler:    _PamServer_ListApiTokens_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "UploadFile",
+			Handler:       _PamServer_UploadFile_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "DownloadFile",
+			Handler:       _PamServer_DownloadFile_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "pam.proto",
 }
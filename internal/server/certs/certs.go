@@ -2,11 +2,18 @@ package certs
 
 import (
 	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
 
 	"google.golang.org/grpc/credentials"
+
+	"github.com/smakimka/pam/internal/server/config"
 )
 
-func LoadTLSCredentials() (credentials.TransportCredentials, error) {
+// LoadTLSCredentials загружает сертификат сервера. Если clientCertMode не config.ClientCertOff,
+// клиентские сертификаты проверяются по CA из clientCAFile
+func LoadTLSCredentials(clientCertMode string, clientCAFile string) (credentials.TransportCredentials, error) {
 	// Load server's certificate and private key
 	serverCert, err := tls.LoadX509KeyPair("certs/server-cert.pem", "certs/server-key.pem")
 	if err != nil {
@@ -14,10 +21,31 @@ func LoadTLSCredentials() (credentials.TransportCredentials, error) {
 	}
 
 	// Create the credentials and return it
-	config := &tls.Config{
+	tlsConfig := &tls.Config{
 		Certificates: []tls.Certificate{serverCert},
 		ClientAuth:   tls.NoClientCert,
 	}
 
-	return credentials.NewTLS(config), nil
+	if clientCertMode == config.ClientCertOff {
+		return credentials.NewTLS(tlsConfig), nil
+	}
+
+	// Load certificate of the CA who signed clients' certificates
+	pemClientCA, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(pemClientCA) {
+		return nil, fmt.Errorf("failed to add client CA's certificate")
+	}
+	tlsConfig.ClientCAs = certPool
+
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	if clientCertMode == config.ClientCertRequire {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return credentials.NewTLS(tlsConfig), nil
 }
@@ -4,47 +4,155 @@ import (
 	"context"
 	"time"
 
+	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 
 	"github.com/smakimka/pam/internal/server/model"
 	"github.com/smakimka/pam/internal/server/storage"
+	"github.com/smakimka/pam/internal/server/tokenhash"
 )
 
 type AuthInterceptor struct {
 	s storage.Storage
+	h *tokenhash.Hasher
 }
 
-func NewAuthInterceptor(s storage.Storage) *AuthInterceptor {
-	return &AuthInterceptor{s: s}
+func NewAuthInterceptor(s storage.Storage, h *tokenhash.Hasher) *AuthInterceptor {
+	return &AuthInterceptor{s: s, h: h}
 }
 
+// publicMethods методы, которые вызываются без авторизации
+var publicMethods = map[string]bool{
+	"/PamServer/Authenticate": true,
+	"/PamServer/Register":     true,
+}
+
+// Auth авторизует унарные вызовы, кладет в контекст пользователя и хеш токена
 func (i *AuthInterceptor) Auth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	if info.FullMethod == "/PamServer/Authenticate" || info.FullMethod == "/PamServer/Register" {
+	if publicMethods[info.FullMethod] {
 		return handler(ctx, req)
 	}
 
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return nil, status.Error(codes.Unauthenticated, "unauthenticated")
+	authCtx, err := i.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkScope(info.FullMethod, scopeFromContext(authCtx)); err != nil {
+		return nil, err
 	}
 
-	tokens := md.Get("auth-token")
-	if len(tokens) != 1 {
-		return nil, status.Error(codes.Unauthenticated, "unauthenticated")
+	return handler(authCtx, req)
+}
+
+// authServerStream подменяет контекст потока на контекст с данными пользователя
+type authServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// StreamAuth авторизует потоковые вызовы так же, как Auth унарные, обработчик получает поток с контекстом,
+// в котором есть пользователь и хеш токена
+func (i *AuthInterceptor) StreamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if publicMethods[info.FullMethod] {
+		return handler(srv, ss)
+	}
+
+	authCtx, err := i.authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+
+	if err = checkScope(info.FullMethod, scopeFromContext(authCtx)); err != nil {
+		return err
+	}
+
+	return handler(srv, &authServerStream{ServerStream: ss, ctx: authCtx})
+}
+
+// authenticate находит пользователя по токену из метаданных, а если токена нет - по клиентскому
+// сертификату, и кладет его в контекст вместе с хешем токена
+func (i *AuthInterceptor) authenticate(ctx context.Context) (context.Context, error) {
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		tokens := md.Get("auth-token")
+		if len(tokens) > 1 {
+			return nil, status.Error(codes.Unauthenticated, "unauthenticated")
+		}
+		if len(tokens) == 1 {
+			token = tokens[0]
+		}
 	}
-	if tokens[0] == "" {
-		return nil, status.Error(codes.Unauthenticated, "unauthenticated")
+
+	if token == "" {
+		username, ok := certUsername(ctx)
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "unauthenticated")
+		}
+
+		user, err := i.s.GetUser(ctx, username)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "unauthenticated")
+		}
+		// the certificate is trusted only for the exact name it was issued to, whatever the storage matches
+		if user.Username != username {
+			return nil, status.Error(codes.Unauthenticated, "unauthenticated")
+		}
+
+		return withUser(ctx, user, ""), nil
 	}
 
-	user, err := i.s.GetUserByToken(ctx, tokens[0], time.Now())
+	tokenHash := i.h.Hash(token)
+	user, err := i.s.GetUserByToken(ctx, tokenHash, time.Now())
 	if err != nil {
 		return nil, status.Error(codes.Internal, "unauthenticated")
 	}
 
-	tokenCtx := context.WithValue(ctx, model.UserID, user.ID)
-	authCtx := context.WithValue(tokenCtx, model.AuthToken, tokens[0])
-	return handler(authCtx, req)
+	if err = i.s.UpdateTokenUsage(ctx, tokenHash, TokenUsage(ctx)); err != nil {
+		log.Err(err).Msg("error updating token usage")
+	}
+
+	return withUser(ctx, user, tokenHash), nil
+}
+
+func withUser(ctx context.Context, user *model.UserData, tokenHash string) context.Context {
+	ctx = context.WithValue(ctx, model.UserID, user.ID)
+	ctx = context.WithValue(ctx, model.Username, user.Username)
+	ctx = context.WithValue(ctx, model.Scope, user.Scope)
+	return context.WithValue(ctx, model.AuthToken, tokenHash)
+}
+
+// certUsername возвращает имя пользователя из CN проверенного клиентского сертификата
+func certUsername(ctx context.Context) (string, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return "", false
+	}
+
+	// only chains verified against the configured client CA count
+	if len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+
+	username := tlsInfo.State.VerifiedChains[0][0].Subject.CommonName
+	return username, username != ""
+}
+
+func scopeFromContext(ctx context.Context) *model.TokenScope {
+	scope, _ := ctx.Value(model.Scope).(*model.TokenScope)
+	return scope
 }
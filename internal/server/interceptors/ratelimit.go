@@ -0,0 +1,174 @@
+package interceptors
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/smakimka/pam/internal/protobuf/pamserver"
+	"github.com/smakimka/pam/internal/server/storage"
+)
+
+// RateLimitConfig ограничения для Authenticate, Register и запросов, проверяющих пароль
+type RateLimitConfig struct {
+	// RequestsPerMinute сколько запросов в минуту можно сделать с одного адреса, 0 - без ограничения
+	RequestsPerMinute int
+	// MaxAttempts сколько неудачных попыток подряд можно сделать без блокировки
+	MaxAttempts int
+	// Lockout блокировка после первой лишней неудачной попытки, каждая следующая удваивает ее
+	Lockout time.Duration
+	// MaxLockout максимальная блокировка
+	MaxLockout time.Duration
+	// Window через сколько после последней неудачной попытки счетчик начинается заново
+	Window time.Duration
+}
+
+// RateLimitInterceptor ограничивает частоту запросов на вход, регистрацию, смену пароля и удаление аккаунта
+// с одного адреса и блокирует адрес и имя пользователя после нескольких неудачных попыток входа, а адрес -
+// после нескольких запросов с неверным паролем. Счетчики неудачных попыток
+// хранятся в storage, поэтому переживают перезапуск сервера
+type RateLimitInterceptor struct {
+	s   storage.Storage
+	cfg RateLimitConfig
+
+	mu          sync.Mutex
+	windowStart time.Time
+	requests    map[string]int
+}
+
+func NewRateLimitInterceptor(s storage.Storage, cfg RateLimitConfig) *RateLimitInterceptor {
+	return &RateLimitInterceptor{s: s, cfg: cfg, requests: make(map[string]int)}
+}
+
+func (i *RateLimitInterceptor) Limit(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	switch info.FullMethod {
+	case "/PamServer/Authenticate", "/PamServer/Register", "/PamServer/ChangePassword", "/PamServer/DeleteAccount",
+		"/PamServer/EnableTwoFactor", "/PamServer/DisableTwoFactor", "/PamServer/RegenerateRecoveryCodes":
+	default:
+		return handler(ctx, req)
+	}
+
+	now := time.Now()
+	ip := peerIP(ctx)
+
+	if retryAfter, ok := i.allowRequest(ip, now); !ok {
+		return nil, tooManyAttempts(retryAfter)
+	}
+
+	keys := []string{"ip:" + ip}
+	authData, isAuth := req.(*pamserver.AuthData)
+	isAuth = isAuth && info.FullMethod == "/PamServer/Authenticate"
+	if isAuth {
+		keys = append(keys, "user:"+authData.Username)
+	}
+
+	for _, key := range keys {
+		lockedUntil, err := i.s.GetLoginLock(ctx, key)
+		if err != nil {
+			log.Err(err).Msg("error getting login lock")
+			return nil, status.Error(codes.Internal, "internal error")
+		}
+		if now.Before(lockedUntil) {
+			return nil, tooManyAttempts(lockedUntil.Sub(now))
+		}
+	}
+
+	resp, err := handler(ctx, req)
+	if info.FullMethod == "/PamServer/Register" {
+		return resp, err
+	}
+
+	switch status.Code(err) {
+	case codes.OK:
+		// a user who mistyped the password a few times isn't left with failures on their address
+		if isAuth {
+			for _, key := range keys {
+				if err := i.s.ResetLoginFailures(ctx, key); err != nil {
+					log.Err(err).Msg("error resetting login failures")
+				}
+			}
+		}
+	case codes.NotFound, codes.PermissionDenied:
+		for _, key := range keys {
+			i.addFailure(ctx, key, now)
+		}
+	}
+
+	return resp, err
+}
+
+// allowRequest учитывает запрос с адреса ip, если лимит превышен, возвращает, через сколько начнется
+// следующая минута
+func (i *RateLimitInterceptor) allowRequest(ip string, now time.Time) (time.Duration, bool) {
+	if i.cfg.RequestsPerMinute <= 0 {
+		return 0, true
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if now.Sub(i.windowStart) >= time.Minute {
+		i.windowStart = now
+		i.requests = make(map[string]int)
+	}
+
+	i.requests[ip]++
+	return time.Minute - now.Sub(i.windowStart), i.requests[ip] <= i.cfg.RequestsPerMinute
+}
+
+func (i *RateLimitInterceptor) addFailure(ctx context.Context, key string, now time.Time) {
+	failures, err := i.s.AddLoginFailure(ctx, key, now, i.cfg.Window)
+	if err != nil {
+		log.Err(err).Msg("error adding login failure")
+		return
+	}
+
+	if failures <= i.cfg.MaxAttempts {
+		return
+	}
+
+	lockout := i.cfg.Lockout
+	for n := failures - i.cfg.MaxAttempts - 1; n > 0 && lockout < i.cfg.MaxLockout; n-- {
+		lockout *= 2
+	}
+	if lockout > i.cfg.MaxLockout {
+		lockout = i.cfg.MaxLockout
+	}
+
+	log.Info().Msgf("locking %s for %s after %d failed attempts", key, lockout, failures)
+	if err = i.s.LockLogin(ctx, key, now.Add(lockout)); err != nil {
+		log.Err(err).Msg("error locking login")
+	}
+}
+
+func tooManyAttempts(retryAfter time.Duration) error {
+	st := status.New(codes.ResourceExhausted, "too many attempts, try again later")
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)}); err == nil {
+		return detailed.Err()
+	}
+
+	return st.Err()
+}
+
+// peerIP адрес клиента без порта
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	ip := p.Addr.String()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		return host
+	}
+	return ip
+}
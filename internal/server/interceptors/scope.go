@@ -0,0 +1,46 @@
+package interceptors
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/smakimka/pam/internal/server/model"
+)
+
+type access int
+
+const (
+	accessRead access = iota
+	accessWrite
+)
+
+// scopedMethods методы, доступные API токенам, и нужный для них доступ. Остальные методы, например,
+// управление аккаунтом и токенами, доступны только с полным доступом
+var scopedMethods = map[string]access{
+	"/PamServer/Get":            accessRead,
+	"/PamServer/GetNames":       accessRead,
+	"/PamServer/ListVersions":   accessRead,
+	"/PamServer/GetVersion":     accessRead,
+	"/PamServer/DownloadFile":   accessRead,
+	"/PamServer/GetVaultParams": accessRead,
+	"/PamServer/Sync":           accessRead,
+	"/PamServer/Logout":         accessRead,
+	"/PamServer/Upload":         accessWrite,
+	"/PamServer/UploadFile":     accessWrite,
+	"/PamServer/Delete":         accessWrite,
+	"/PamServer/Restore":        accessWrite,
+}
+
+// checkScope проверяет, что токен с правами scope может вызвать method, nil scope - полный доступ
+func checkScope(method string, scope *model.TokenScope) error {
+	if scope == nil {
+		return nil
+	}
+
+	need, ok := scopedMethods[method]
+	if !ok || (need == accessWrite && !scope.Write) {
+		return status.Error(codes.PermissionDenied, "token scope does not allow this")
+	}
+
+	return nil
+}
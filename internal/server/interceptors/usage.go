@@ -0,0 +1,22 @@
+package interceptors
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/smakimka/pam/internal/server/model"
+)
+
+// TokenUsage возвращает время запроса, адрес клиента и его user agent
+func TokenUsage(ctx context.Context) model.TokenUsage {
+	usage := model.TokenUsage{UsedAt: time.Now(), IP: peerIP(ctx)}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		usage.UserAgent = strings.Join(md.Get("user-agent"), " ")
+	}
+
+	return usage
+}
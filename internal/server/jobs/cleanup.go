@@ -0,0 +1,36 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/smakimka/pam/internal/server/storage"
+)
+
+// CleanupConfig интервалы задач очистки, 0 - задача не запускается
+type CleanupConfig struct {
+	// TokensInterval как часто удалять истекшие и отозванные токены
+	TokensInterval time.Duration
+	// LoginAttemptsInterval как часто удалять счетчики неудачных попыток входа, которые уже не действуют
+	LoginAttemptsInterval time.Duration
+	// LoginFailureWindow через сколько после последней неудачной попытки ее счетчик больше не учитывается
+	LoginFailureWindow time.Duration
+}
+
+// CleanupJobs задачи, удаляющие из storage строки, которые больше не нужны
+func CleanupJobs(s storage.Storage, cfg CleanupConfig) []Job {
+	return []Job{
+		{
+			Name:     "expired_tokens",
+			Interval: cfg.TokensInterval,
+			Run:      s.DeleteExpiredTokens,
+		},
+		{
+			Name:     "login_attempts",
+			Interval: cfg.LoginAttemptsInterval,
+			Run: func(ctx context.Context, now time.Time) (int, error) {
+				return s.DeleteStaleLoginAttempts(ctx, now.Add(-cfg.LoginFailureWindow), now)
+			},
+		},
+	}
+}
@@ -0,0 +1,74 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/smakimka/pam/internal/server/storage"
+)
+
+// Job периодическая задача сервера. Run возвращает количество обработанных строк, чтобы его можно было записать в лог
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context, now time.Time) (int, error)
+}
+
+// Runner запускает задачи по расписанию. Если сервер запущен в нескольких экземплярах, каждый запуск задачи
+// выполняет только один из них, остальные его пропускают
+type Runner struct {
+	s    storage.Storage
+	jobs []Job
+}
+
+func NewRunner(s storage.Storage, jobs ...Job) *Runner {
+	return &Runner{s: s, jobs: jobs}
+}
+
+// Start запускает задачи с ненулевым интервалом в фоне, они останавливаются с отменой ctx
+func (r *Runner) Start(ctx context.Context) {
+	for _, job := range r.jobs {
+		if job.Interval <= 0 {
+			log.Info().Msgf("job %s is disabled", job.Name)
+			continue
+		}
+
+		go r.loop(ctx, job)
+	}
+}
+
+func (r *Runner) loop(ctx context.Context, job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.run(ctx, job)
+		}
+	}
+}
+
+// run выполняет задачу один раз, если ее сейчас не выполняет другой экземпляр сервера
+func (r *Runner) run(ctx context.Context, job Job) {
+	var n int
+	ran, err := r.s.RunExclusive(ctx, "job:"+job.Name, func(ctx context.Context) error {
+		var err error
+		n, err = job.Run(ctx, time.Now())
+		return err
+	})
+	if err != nil {
+		log.Err(err).Msgf("error running job %s", job.Name)
+		return
+	}
+	if !ran {
+		log.Info().Msgf("job %s is running on another server, skipping", job.Name)
+		return
+	}
+
+	log.Info().Msgf("job %s done, %d rows affected", job.Name, n)
+}
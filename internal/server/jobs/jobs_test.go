@@ -0,0 +1,86 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smakimka/pam/internal/server/storage"
+)
+
+// lockStorage реализует только RunExclusive, busy имитирует задачу, которую выполняет другой сервер
+type lockStorage struct {
+	storage.Storage
+	mu   sync.Mutex
+	busy map[string]bool
+}
+
+func (s *lockStorage) RunExclusive(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error) {
+	s.mu.Lock()
+	busy := s.busy[name]
+	s.mu.Unlock()
+	if busy {
+		return false, nil
+	}
+
+	return true, fn(ctx)
+}
+
+func TestRun(t *testing.T) {
+	s := &lockStorage{busy: map[string]bool{"job:busy": true}}
+	r := NewRunner(s)
+
+	runs := 0
+	job := Job{Name: "free", Run: func(ctx context.Context, now time.Time) (int, error) {
+		runs++
+		return 1, nil
+	}}
+
+	r.run(context.Background(), job)
+	assert.Equal(t, 1, runs)
+
+	job.Name = "busy"
+	r.run(context.Background(), job)
+	assert.Equal(t, 1, runs)
+
+	// errors are only logged
+	r.run(context.Background(), Job{Name: "failing", Run: func(ctx context.Context, now time.Time) (int, error) {
+		return 0, errors.New("failed")
+	}})
+}
+
+func TestStart(t *testing.T) {
+	s := &lockStorage{}
+
+	var mu sync.Mutex
+	runs := map[string]int{}
+	count := func(name string) func(ctx context.Context, now time.Time) (int, error) {
+		return func(ctx context.Context, now time.Time) (int, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			runs[name]++
+			return 0, nil
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	NewRunner(s,
+		Job{Name: "often", Interval: time.Millisecond, Run: count("often")},
+		Job{Name: "disabled", Run: count("disabled")},
+	).Start(ctx)
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return runs["often"] >= 3
+	}, time.Second, time.Millisecond)
+	cancel()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Zero(t, runs["disabled"])
+}
@@ -1,25 +1,151 @@
 package model
 
+import "time"
+
 type TokenData struct {
 	ID    int
 	Value string
 }
 
+// TokenUsage когда и откуда последний раз использовался токен
+type TokenUsage struct {
+	UsedAt    time.Time
+	IP        string
+	UserAgent string
+}
+
+// Session действующий токен пользователя
+type Session struct {
+	ID        int
+	Token     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	TokenUsage
+}
+
+// TwoFactor настройки двухфакторной авторизации пользователя. Secret задан и до подтверждения, но
+// используется только после него
+type TwoFactor struct {
+	Secret  string
+	Enabled bool
+}
+
+// TokenScope права API токена
+type TokenScope struct {
+	// Write разрешает изменять и удалять данные, иначе токен только для чтения
+	Write bool
+	// Prefixes если не пусто, доступны только записи, имена которых начинаются с одного из префиксов
+	Prefixes []string
+}
+
+// ApiToken токен с ограниченными правами для автоматизации, в отличие от сессии не продлевается при
+// использовании. Нулевой ExpiresAt - токен бессрочный
+type ApiToken struct {
+	ID          int
+	Description string
+	TokenScope
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    time.Time
+}
+
 type UserData struct {
 	ID       int
 	Username string
 	Pwd      []byte
+	// Scope права токена, по которому найден пользователь, nil - полный доступ
+	Scope *TokenScope
 }
 
 type Data struct {
-	ID     int
-	UserID int
-	Name   string
-	Kind   int
-	Bytes  []byte
+	ID      int
+	UserID  int
+	Name    string
+	Kind    int
+	Bytes   []byte
+	Version int
+	DataMeta
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// DataMeta метаданные записи, которые задает пользователь. В отличие от самих данных не шифруются,
+// чтобы по ним можно было искать
+type DataMeta struct {
+	Folder string
+	Tags   []string
+}
+
+type DataInfo struct {
+	Name    string
+	Kind    int
+	Version int
+	DataMeta
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Ключи сортировки для ListOptions.Sort
+const (
+	SortFolder  = "folder"
+	SortName    = "name"
+	SortCreated = "created"
+	SortUpdated = "updated"
+)
+
+// ListOptions фильтры, сортировка и пагинация для списка записей. Нулевое значение - все записи,
+// упорядоченные по папке и имени
+type ListOptions struct {
+	Prefix string
+	// Prefixes если не пусто, возвращаются только записи, имена которых начинаются с одного из них
+	Prefixes []string
+	// Kind если не nil, возвращаются только записи этого типа
+	Kind *int
+	Tag  string
+	// Sort один из Sort*, записи по времени сортируются от новых к старым
+	Sort string
+	// Limit максимальное количество записей, 0 - без ограничения
+	Limit int
+	// Cursor курсор страницы, полученный вместе с предыдущей страницей
+	Cursor string
+}
+
+type DataVersion struct {
+	Version    int
+	Kind       int
+	ReplacedAt time.Time
+	Current    bool
+}
+
+// Change последнее изменение записи из журнала изменений, для удаленной записи заполнены только
+// Name, Revision и Deleted
+type Change struct {
+	Name     string
+	Revision int64
+	Deleted  bool
+	Kind     int
+	Bytes    []byte
+	Version  int
+	DataMeta
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// ChangeSet изменения после ревизии синхронизации. Revision - ревизия, до которой клиент получил все
+// изменения, если More, изменений больше, чем поместилось в ответ
+type ChangeSet struct {
+	Changes  []Change
+	Revision int64
+	More     bool
 }
 
 type ContextKey string
 
 var UserID ContextKey = "userID"
+
+// Scope права токена, с которым пришел запрос, *TokenScope, nil - полный доступ
+var Scope ContextKey = "scope"
+
+// AuthToken хеш токена, с которым пришел запрос, пустой, если клиент вошел по сертификату
 var AuthToken ContextKey = "authToken"
+var Username ContextKey = "username"
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/smakimka/pam/internal/protobuf/pamserver"
+	"github.com/smakimka/pam/internal/server/model"
+	"github.com/smakimka/pam/internal/server/storage"
+)
+
+// ChangePassword Отвечает за смену пароля, нужен текущий пароль. Все токены пользователя, кроме того,
+// с которым пришел запрос, отзываются, нужна авторизация
+func (p *PamService) ChangePassword(ctx context.Context, in *pamserver.ChangePasswordRequest) (*pamserver.ChangePasswordResponse, error) {
+	log.Info().Msg("got change password request")
+	resp := &pamserver.ChangePasswordResponse{}
+
+	userID, ok := ctx.Value(model.UserID).(int)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+	authToken, ok := ctx.Value(model.AuthToken).(string)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+
+	err := p.prolongToken(ctx, authToken)
+	if err != nil {
+		return resp, status.Error(codes.Internal, "error prolonging token")
+	}
+
+	if in.NewPwd == "" {
+		return resp, status.Error(codes.InvalidArgument, "new password is empty")
+	}
+
+	if err = p.checkPassword(ctx, userID, in.CurrentPwd); err != nil {
+		return resp, err
+	}
+
+	pwdHash, err := bcrypt.GenerateFromPassword([]byte(in.NewPwd), bcrypt.DefaultCost)
+	if err != nil {
+		return resp, status.Error(codes.Internal, "internal error")
+	}
+
+	if err = p.s.UpdatePassword(ctx, userID, pwdHash, authToken, time.Now()); err != nil {
+		return resp, status.Error(codes.Internal, "internal error")
+	}
+
+	log.Info().Msgf("user %d changed password", userID)
+	return resp, nil
+}
+
+// DeleteAccount Отвечает за удаление аккаунта вместе со всеми данными и токенами, нужен пароль, нужна авторизация
+func (p *PamService) DeleteAccount(ctx context.Context, in *pamserver.DeleteAccountRequest) (*pamserver.DeleteAccountResponse, error) {
+	log.Info().Msg("got delete account request")
+	resp := &pamserver.DeleteAccountResponse{}
+
+	userID, ok := ctx.Value(model.UserID).(int)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+
+	if err := p.checkPassword(ctx, userID, in.Pwd); err != nil {
+		return resp, err
+	}
+
+	if err := p.s.DeleteUser(ctx, userID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return resp, status.Error(codes.NotFound, "this user does not exist")
+		}
+
+		return resp, status.Error(codes.Internal, "internal error")
+	}
+
+	log.Info().Msgf("user %d deleted account", userID)
+	return resp, nil
+}
+
+// checkPassword проверяет пароль пользователя для действий с аккаунтом, одного токена для них недостаточно
+func (p *PamService) checkPassword(ctx context.Context, userID int, pwd string) error {
+	user, err := p.s.GetUserByID(ctx, userID)
+	if err != nil {
+		return status.Error(codes.Internal, "internal error")
+	}
+
+	if err = bcrypt.CompareHashAndPassword(user.Pwd, []byte(pwd)); err != nil {
+		return status.Error(codes.PermissionDenied, "wrong password")
+	}
+
+	return nil
+}
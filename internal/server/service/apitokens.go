@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/smakimka/pam/internal/protobuf/pamserver"
+	"github.com/smakimka/pam/internal/server/model"
+)
+
+// apiTokenPrefix отличает API токены от сессий при просмотре, на проверку не влияет
+const apiTokenPrefix = "pam_"
+
+var errNameNotInScope = status.Error(codes.PermissionDenied, "token scope does not allow this data")
+var errSyncNotInScope = status.Error(codes.PermissionDenied, "token scope does not allow this sync, it is limited to some names")
+
+func scopeFromContext(ctx context.Context) *model.TokenScope {
+	scope, _ := ctx.Value(model.Scope).(*model.TokenScope)
+	return scope
+}
+
+// nameAllowed проверяет, что права токена, с которым пришел запрос, разрешают запись name
+func nameAllowed(ctx context.Context, name string) bool {
+	scope := scopeFromContext(ctx)
+	if scope == nil || len(scope.Prefixes) == 0 {
+		return true
+	}
+
+	for _, prefix := range scope.Prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CreateApiToken Отвечает за создание API токена с ограниченными правами и, если задан, сроком действия.
+// Токен возвращается один раз, на сервере хранится только его хеш, нужна авторизация с полным доступом
+func (p *PamService) CreateApiToken(ctx context.Context, in *pamserver.CreateApiTokenRequest) (*pamserver.CreateApiTokenResponse, error) {
+	log.Info().Msg("got create api token request")
+	resp := &pamserver.CreateApiTokenResponse{}
+
+	userID, ok := ctx.Value(model.UserID).(int)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+	authToken, ok := ctx.Value(model.AuthToken).(string)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+
+	err := p.prolongToken(ctx, authToken)
+	if err != nil {
+		return resp, status.Error(codes.Internal, "error prolonging token")
+	}
+
+	token := model.ApiToken{
+		Description: strings.TrimSpace(in.Description),
+		TokenScope:  model.TokenScope{Write: in.Write},
+	}
+	for _, prefix := range in.Prefixes {
+		if prefix == "" {
+			return resp, status.Error(codes.InvalidArgument, "prefix can't be empty")
+		}
+		token.Prefixes = append(token.Prefixes, prefix)
+	}
+	if in.ExpiresAt != nil {
+		token.ExpiresAt = in.ExpiresAt.AsTime()
+		if !token.ExpiresAt.After(time.Now()) {
+			return resp, status.Error(codes.InvalidArgument, "expiry is in the past")
+		}
+	}
+
+	tokenValue, err := uuid.NewRandom()
+	if err != nil {
+		return resp, status.Error(codes.Internal, "internal error")
+	}
+	value := apiTokenPrefix + tokenValue.String()
+
+	id, err := p.s.CreateApiToken(ctx, userID, p.h.Hash(value), token)
+	if err != nil {
+		return resp, status.Error(codes.Internal, "internal error")
+	}
+
+	resp.Id = int32(id)
+	resp.Token = value
+	return resp, nil
+}
+
+// ListApiTokens Отвечает за получение действующих API токенов пользователя, сами токены не возвращаются,
+// нужна авторизация с полным доступом
+func (p *PamService) ListApiTokens(ctx context.Context, in *pamserver.ListApiTokensRequest) (*pamserver.ListApiTokensResponse, error) {
+	log.Info().Msg("got list api tokens request")
+	resp := &pamserver.ListApiTokensResponse{}
+
+	userID, ok := ctx.Value(model.UserID).(int)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+	authToken, ok := ctx.Value(model.AuthToken).(string)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+
+	err := p.prolongToken(ctx, authToken)
+	if err != nil {
+		return resp, status.Error(codes.Internal, "error prolonging token")
+	}
+
+	tokens, err := p.s.ListApiTokens(ctx, userID, time.Now())
+	if err != nil {
+		return resp, status.Error(codes.Internal, "internal error")
+	}
+
+	for _, token := range tokens {
+		t := &pamserver.ApiToken{
+			Id:          int32(token.ID),
+			Description: token.Description,
+			Write:       token.Write,
+			Prefixes:    token.Prefixes,
+			CreatedAt:   timestamppb.New(token.CreatedAt),
+		}
+		if !token.ExpiresAt.IsZero() {
+			t.ExpiresAt = timestamppb.New(token.ExpiresAt)
+		}
+		if !token.UsedAt.IsZero() {
+			t.LastUsedAt = timestamppb.New(token.UsedAt)
+		}
+
+		resp.Tokens = append(resp.Tokens, t)
+	}
+
+	return resp, nil
+}
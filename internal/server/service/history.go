@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/smakimka/pam/internal/protobuf/pamserver"
+	"github.com/smakimka/pam/internal/server/model"
+	"github.com/smakimka/pam/internal/server/storage"
+)
+
+// ListVersions Отвечает за получение списка версий данных, первой идет текущая версия, нужна авторизация
+func (p *PamService) ListVersions(ctx context.Context, in *pamserver.GetDataVersions) (*pamserver.GetDataVersionsResponse, error) {
+	log.Info().Msg("got list versions request")
+	resp := &pamserver.GetDataVersionsResponse{}
+
+	userID, ok := ctx.Value(model.UserID).(int)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+	authToken, ok := ctx.Value(model.AuthToken).(string)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+
+	err := p.prolongToken(ctx, authToken)
+	if err != nil {
+		return resp, status.Error(codes.Internal, "error prolonging token")
+	}
+
+	if !nameAllowed(ctx, in.Name) {
+		return resp, errNameNotInScope
+	}
+
+	versions, err := p.s.GetDataVersions(ctx, userID, in.Name)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return resp, status.Error(codes.NotFound, "this data does not exist")
+		}
+
+		return resp, status.Error(codes.Internal, "internal error")
+	}
+
+	for _, version := range versions {
+		v := &pamserver.DataVersion{
+			Version: int32(version.Version),
+			Kind:    int32(version.Kind),
+			Current: version.Current,
+		}
+		if !version.Current {
+			v.ReplacedAt = timestamppb.New(version.ReplacedAt)
+		}
+
+		resp.Versions = append(resp.Versions, v)
+	}
+
+	return resp, nil
+}
+
+// GetVersion Отвечает за получение конкретной версии данных, нужна авторизация
+func (p *PamService) GetVersion(ctx context.Context, in *pamserver.GetDataVersion) (*pamserver.GetDataResponse, error) {
+	log.Info().Msg("got get version request")
+	resp := &pamserver.GetDataResponse{}
+
+	userID, ok := ctx.Value(model.UserID).(int)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+	authToken, ok := ctx.Value(model.AuthToken).(string)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+
+	err := p.prolongToken(ctx, authToken)
+	if err != nil {
+		return resp, status.Error(codes.Internal, "error prolonging token")
+	}
+
+	if !nameAllowed(ctx, in.Name) {
+		return resp, errNameNotInScope
+	}
+
+	data, err := p.s.GetDataVersion(ctx, userID, in.Name, int(in.Version))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return resp, status.Error(codes.NotFound, "this version does not exist")
+		}
+
+		return resp, status.Error(codes.Internal, "internal error")
+	}
+
+	resp.Kind = int32(data.Kind)
+	resp.Data = data.Bytes
+	resp.Revision = int32(data.Version)
+
+	return resp, nil
+}
+
+// Restore Отвечает за восстановление версии данных из истории. Восстановленная версия становится новой текущей,
+// а заменяемая уходит в историю, поэтому восстановление тоже можно откатить
+func (p *PamService) Restore(ctx context.Context, in *pamserver.RestoreData) (*pamserver.RestoreDataResponse, error) {
+	log.Info().Msg("got restore request")
+	resp := &pamserver.RestoreDataResponse{}
+
+	userID, ok := ctx.Value(model.UserID).(int)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+	authToken, ok := ctx.Value(model.AuthToken).(string)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+
+	err := p.prolongToken(ctx, authToken)
+	if err != nil {
+		return resp, status.Error(codes.Internal, "error prolonging token")
+	}
+
+	if !nameAllowed(ctx, in.Name) {
+		return resp, errNameNotInScope
+	}
+
+	version, err := p.s.RestoreData(ctx, userID, in.Name, int(in.Version))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return resp, status.Error(codes.NotFound, "this data does not exist")
+		}
+
+		if errors.Is(err, storage.ErrNoSuchVersion) {
+			return resp, status.Error(codes.NotFound, "this version does not exist")
+		}
+
+		return resp, status.Error(codes.Internal, "internal error")
+	}
+
+	resp.Version = int32(version)
+
+	return resp, nil
+}
@@ -4,17 +4,20 @@ import (
 	"github.com/smakimka/pam/internal/protobuf/pamserver"
 	"github.com/smakimka/pam/internal/server/interceptors"
 	"github.com/smakimka/pam/internal/server/storage"
+	"github.com/smakimka/pam/internal/server/tokenhash"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 )
 
-func NewServer(s storage.Storage, tlsCredentials credentials.TransportCredentials, expiryTime int) *grpc.Server {
-	interceptor := interceptors.NewAuthInterceptor(s)
+func NewServer(s storage.Storage, tlsCredentials credentials.TransportCredentials, h *tokenhash.Hasher, expiryTime int, limits interceptors.RateLimitConfig) *grpc.Server {
+	interceptor := interceptors.NewAuthInterceptor(s, h)
+	limiter := interceptors.NewRateLimitInterceptor(s, limits)
 
-	service := newPamSerice(s, expiryTime)
+	service := newPamSerice(s, h, expiryTime)
 	server := grpc.NewServer(
 		grpc.Creds(tlsCredentials),
-		grpc.UnaryInterceptor(interceptor.Auth),
+		grpc.ChainUnaryInterceptor(limiter.Limit, interceptor.Auth),
+		grpc.StreamInterceptor(interceptor.StreamAuth),
 	)
 
 	pamserver.RegisterPamServerServer(server, service)
@@ -4,32 +4,43 @@ package service
 import (
 	"context"
 	"errors"
+	"io"
+	"path"
+	"slices"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/rs/zerolog/log"
+	"github.com/smakimka/pam/internal/datatypes"
 	"github.com/smakimka/pam/internal/protobuf/pamserver"
+	"github.com/smakimka/pam/internal/server/interceptors"
 	"github.com/smakimka/pam/internal/server/model"
 	"github.com/smakimka/pam/internal/server/storage"
+	"github.com/smakimka/pam/internal/server/tokenhash"
 )
 
 type PamService struct {
 	pamserver.UnimplementedPamServerServer
 	s          storage.Storage
+	h          *tokenhash.Hasher
 	expiryTime int
 }
 
-func newPamSerice(s storage.Storage, expiryTime int) *PamService {
-	return &PamService{s: s, expiryTime: expiryTime}
+func newPamSerice(s storage.Storage, h *tokenhash.Hasher, expiryTime int) *PamService {
+	return &PamService{s: s, h: h, expiryTime: expiryTime}
 }
 
 func (p *PamService) prolongToken(ctx context.Context, token string) error {
+	if token == "" {
+		// authenticated by a client certificate, there is no token to prolong
+		return nil
+	}
 	now := time.Now()
 
 	if err := p.s.UpdateTokenExpiry(ctx, token, now.Add(time.Duration(p.expiryTime)*time.Second)); err != nil {
@@ -48,7 +59,9 @@ func (p *PamService) createToken(ctx context.Context, userID int) (*model.TokenD
 	}
 	expiry := time.Now().Add(time.Duration(time.Duration(p.expiryTime) * time.Second))
 
-	tokenID, err := p.s.CreateAuthToken(ctx, userID, tokenValue.String(), expiry)
+	// only the hash is stored, the token itself is returned to the client once
+	tokenHash := p.h.Hash(tokenValue.String())
+	tokenID, err := p.s.CreateAuthToken(ctx, userID, tokenHash, expiry)
 	if err != nil {
 		return token, err
 	}
@@ -56,6 +69,10 @@ func (p *PamService) createToken(ctx context.Context, userID int) (*model.TokenD
 	token.ID = tokenID
 	token.Value = tokenValue.String()
 
+	if err = p.s.UpdateTokenUsage(ctx, tokenHash, interceptors.TokenUsage(ctx)); err != nil {
+		return token, err
+	}
+
 	return token, err
 }
 
@@ -71,13 +88,10 @@ func (p *PamService) Register(ctx context.Context, in *pamserver.AuthData) (*pam
 
 	id, err := p.s.CreateUser(ctx, in.Username, pwdHash)
 	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) {
-			if pgErr.Code == "23505" {
-				resp.Error = "user already exists"
-				log.Info().Msg("user already exists, returning error")
-				return resp, nil
-			}
+		if errors.Is(err, storage.ErrUserExists) {
+			resp.Error = "user already exists"
+			log.Info().Msg("user already exists, returning error")
+			return resp, nil
 		}
 
 		log.Err(err).Msg("error creating user")
@@ -93,7 +107,8 @@ func (p *PamService) Register(ctx context.Context, in *pamserver.AuthData) (*pam
 	return &pamserver.AuthResponse{Token: token.Value}, nil
 }
 
-// Authenticate Отечает за авторизацию, возвращает токен авторизации
+// Authenticate Отечает за авторизацию, возвращает токен авторизации. Если у пользователя включена 2FA,
+// нужен еще одноразовый код или код восстановления
 func (p *PamService) Authenticate(ctx context.Context, in *pamserver.AuthData) (*pamserver.AuthResponse, error) {
 	log.Info().Msg("got an auth request")
 	resp := &pamserver.AuthResponse{}
@@ -107,6 +122,10 @@ func (p *PamService) Authenticate(ctx context.Context, in *pamserver.AuthData) (
 		return resp, status.Error(codes.NotFound, "wrong username or password")
 	}
 
+	if err = p.checkSecondFactor(ctx, user.ID, in.Otp); err != nil {
+		return resp, err
+	}
+
 	token, err := p.createToken(ctx, user.ID)
 	if err != nil {
 		return resp, status.Error(codes.Internal, err.Error())
@@ -116,7 +135,8 @@ func (p *PamService) Authenticate(ctx context.Context, in *pamserver.AuthData) (
 }
 
 // Upload Отвечает за загрузку данных на сервер, name является уникальным параметром и идентифицирует данные.
-// При повторном вызове с тем же именем данные будут перезаписаны
+// При повторном вызове с тем же именем данные будут перезаписаны. Если передана ожидаемая ревизия, а текущая
+// ревизия данных другая (0 - данных еще нет), данные не перезаписываются и возвращается codes.Aborted
 func (p *PamService) Upload(ctx context.Context, in *pamserver.UploadData) (*pamserver.UploadResponse, error) {
 	log.Info().Msg("got upload request")
 	resp := &pamserver.UploadResponse{}
@@ -135,11 +155,26 @@ func (p *PamService) Upload(ctx context.Context, in *pamserver.UploadData) (*pam
 		return resp, status.Error(codes.Internal, "error prolonging token")
 	}
 
-	_, err = p.s.UpsertData(ctx, userID, in.Name, int(in.Type), in.Data)
+	if !nameAllowed(ctx, in.Name) {
+		return resp, errNameNotInScope
+	}
+
+	expectedRevision := storage.AnyVersion
+	if in.ExpectedRevision != nil {
+		expectedRevision = int(*in.ExpectedRevision)
+	}
+
+	revision, err := p.s.UpsertData(ctx, userID, in.Name, int(in.Type), in.Data, newDataMeta(in.Folder, in.Tags), expectedRevision)
 	if err != nil {
+		if errors.Is(err, storage.ErrVersionConflict) {
+			return resp, status.Error(codes.Aborted, "revision conflict")
+		}
+
 		return resp, status.Error(codes.Internal, "error upserting data")
 	}
 
+	resp.Revision = int32(revision)
+
 	return resp, nil
 }
 
@@ -162,9 +197,13 @@ func (p *PamService) Get(ctx context.Context, in *pamserver.GetData) (*pamserver
 		return resp, status.Error(codes.Internal, "error prolonging token")
 	}
 
+	if !nameAllowed(ctx, in.Name) {
+		return resp, errNameNotInScope
+	}
+
 	data, err := p.s.GetData(ctx, userID, in.Name)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
+		if errors.Is(err, storage.ErrNotFound) {
 			return resp, status.Error(codes.NotFound, "this data does not exist")
 		}
 
@@ -173,11 +212,17 @@ func (p *PamService) Get(ctx context.Context, in *pamserver.GetData) (*pamserver
 
 	resp.Kind = int32(data.Kind)
 	resp.Data = data.Bytes
+	resp.Revision = int32(data.Version)
+	resp.Folder = data.Folder
+	resp.Tags = data.Tags
+	resp.CreatedAt = timestamppb.New(data.CreatedAt)
+	resp.UpdatedAt = timestamppb.New(data.UpdatedAt)
 
 	return resp, nil
 }
 
-// GetNames Отвечает за получение имен всех сохраненных данных пользователя, нужна авторизация
+// GetNames Отвечает за получение имен сохраненных данных пользователя вместе с метаданными, с фильтрами,
+// сортировкой и постраничной выдачей, нужна авторизация
 func (p *PamService) GetNames(ctx context.Context, in *pamserver.GetDataNames) (*pamserver.GetDataNamesResponse, error) {
 	log.Info().Msg("got get data names request")
 	resp := &pamserver.GetDataNamesResponse{}
@@ -196,16 +241,228 @@ func (p *PamService) GetNames(ctx context.Context, in *pamserver.GetDataNames) (
 		return resp, status.Error(codes.Internal, "error prolonging token")
 	}
 
-	data, err := p.s.GetDataNames(ctx, userID)
+	if in.Limit < 0 {
+		return resp, status.Error(codes.InvalidArgument, "limit can't be negative")
+	}
+
+	opts := model.ListOptions{
+		Prefix: in.Prefix,
+		Tag:    strings.TrimSpace(in.Tag),
+		Sort:   in.Sort,
+		Limit:  int(in.Limit),
+		Cursor: in.Cursor,
+	}
+	if in.Type != nil {
+		kind := int(*in.Type)
+		opts.Kind = &kind
+	}
+	if scope := scopeFromContext(ctx); scope != nil {
+		opts.Prefixes = scope.Prefixes
+	}
+
+	data, next, err := p.s.ListData(ctx, userID, opts)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
+		if errors.Is(err, storage.ErrInvalidSort) {
+			return resp, status.Error(codes.InvalidArgument, "unknown sort key")
+		}
+		if errors.Is(err, storage.ErrInvalidCursor) {
+			return resp, status.Error(codes.InvalidArgument, "invalid cursor")
+		}
+		if errors.Is(err, storage.ErrNotFound) {
 			return resp, status.Error(codes.NotFound, "this data does not exist")
 		}
 
 		return resp, status.Error(codes.Internal, "internal error")
 	}
 
-	resp.Names = data
+	resp.NextCursor = next
+
+	for _, info := range data {
+		resp.Names = append(resp.Names, info.Name)
+		resp.Items = append(resp.Items, &pamserver.DataInfo{
+			Name:      info.Name,
+			Kind:      int32(info.Kind),
+			Revision:  int32(info.Version),
+			Folder:    info.Folder,
+			Tags:      info.Tags,
+			CreatedAt: timestamppb.New(info.CreatedAt),
+			UpdatedAt: timestamppb.New(info.UpdatedAt),
+		})
+	}
+
+	return resp, nil
+}
+
+// newDataMeta приводит папку к виду "a/b" без лишних слешей, а теги очищает от пробелов, пустых значений и повторов
+func newDataMeta(folder string, tags []string) model.DataMeta {
+	meta := model.DataMeta{Tags: []string{}}
+
+	if folder = strings.Trim(folder, "/ "); folder != "" {
+		meta.Folder = strings.TrimPrefix(path.Clean("/"+folder), "/")
+	}
+
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.Contains(meta.Tags, tag) {
+			meta.Tags = append(meta.Tags, tag)
+		}
+	}
+
+	return meta
+}
+
+// Delete Отвечает за удаление данных по имени, нужна авторизация. Ожидаемая ревизия проверяется так же, как в Upload
+func (p *PamService) Delete(ctx context.Context, in *pamserver.DeleteData) (*pamserver.DeleteDataResponse, error) {
+	log.Info().Msg("got delete data request")
+	resp := &pamserver.DeleteDataResponse{}
+
+	userID, ok := ctx.Value(model.UserID).(int)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+	authToken, ok := ctx.Value(model.AuthToken).(string)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+
+	err := p.prolongToken(ctx, authToken)
+	if err != nil {
+		return resp, status.Error(codes.Internal, "error prolonging token")
+	}
+
+	if !nameAllowed(ctx, in.Name) {
+		return resp, errNameNotInScope
+	}
+
+	expectedRevision := storage.AnyVersion
+	if in.ExpectedRevision != nil {
+		expectedRevision = int(*in.ExpectedRevision)
+	}
+
+	err = p.s.DeleteData(ctx, userID, in.Name, expectedRevision)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return resp, status.Error(codes.NotFound, "this data does not exist")
+		}
+		if errors.Is(err, storage.ErrVersionConflict) {
+			return resp, status.Error(codes.Aborted, "revision conflict")
+		}
+
+		return resp, status.Error(codes.Internal, "internal error")
+	}
 
 	return resp, nil
 }
+
+// UploadFile Отвечает за потоковую загрузку файла. В первом сообщении передаются имя, описание файла и ожидаемая ревизия,
+// содержимое передается чанками во всех сообщениях. Ревизия проверяется так же, как в Upload
+func (p *PamService) UploadFile(stream pamserver.PamServer_UploadFileServer) error {
+	log.Info().Msg("got upload file request")
+	ctx := stream.Context()
+
+	userID, ok := ctx.Value(model.UserID).(int)
+	if !ok {
+		return status.Error(codes.Internal, "internal ctx error")
+	}
+	authToken, ok := ctx.Value(model.AuthToken).(string)
+	if !ok {
+		return status.Error(codes.Internal, "internal ctx error")
+	}
+
+	err := p.prolongToken(ctx, authToken)
+	if err != nil {
+		return status.Error(codes.Internal, "error prolonging token")
+	}
+
+	first, err := stream.Recv()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return status.Error(codes.InvalidArgument, "empty upload")
+		}
+		return err
+	}
+	if first.Name == "" {
+		return status.Error(codes.InvalidArgument, "name is required")
+	}
+	if !nameAllowed(ctx, first.Name) {
+		return errNameNotInScope
+	}
+
+	pending := first.Chunk
+	next := func() ([]byte, error) {
+		if pending != nil {
+			chunk := pending
+			pending = nil
+			return chunk, nil
+		}
+
+		msg, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+
+		return msg.Chunk, nil
+	}
+
+	expectedRevision := storage.AnyVersion
+	if first.ExpectedRevision != nil {
+		expectedRevision = int(*first.ExpectedRevision)
+	}
+
+	revision, err := p.s.UpsertFile(ctx, userID, first.Name, datatypes.File, first.Info, newDataMeta(first.Folder, first.Tags), expectedRevision, next)
+	if err != nil {
+		if errors.Is(err, storage.ErrVersionConflict) {
+			return status.Error(codes.Aborted, "revision conflict")
+		}
+
+		return status.Error(codes.Internal, "error upserting file")
+	}
+
+	return stream.SendAndClose(&pamserver.UploadResponse{Revision: int32(revision)})
+}
+
+// DownloadFile Отвечает за потоковую выдачу содержимого файла по имени, описание файла отдает Get
+func (p *PamService) DownloadFile(in *pamserver.GetData, stream pamserver.PamServer_DownloadFileServer) error {
+	log.Info().Msg("got download file request")
+	ctx := stream.Context()
+
+	userID, ok := ctx.Value(model.UserID).(int)
+	if !ok {
+		return status.Error(codes.Internal, "internal ctx error")
+	}
+	authToken, ok := ctx.Value(model.AuthToken).(string)
+	if !ok {
+		return status.Error(codes.Internal, "internal ctx error")
+	}
+
+	err := p.prolongToken(ctx, authToken)
+	if err != nil {
+		return status.Error(codes.Internal, "error prolonging token")
+	}
+
+	if !nameAllowed(ctx, in.Name) {
+		return errNameNotInScope
+	}
+
+	data, err := p.s.GetData(ctx, userID, in.Name)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return status.Error(codes.NotFound, "this data does not exist")
+		}
+
+		return status.Error(codes.Internal, "internal error")
+	}
+
+	if data.Kind != datatypes.File {
+		return status.Error(codes.FailedPrecondition, "this data is not a file")
+	}
+
+	err = p.s.GetFileChunks(ctx, data.ID, func(chunk []byte) error {
+		return stream.Send(&pamserver.FileChunk{Chunk: chunk})
+	})
+	if err != nil {
+		return status.Error(codes.Internal, "error sending file")
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/smakimka/pam/internal/protobuf/pamserver"
+	"github.com/smakimka/pam/internal/server/model"
+)
+
+// MaxSyncChanges максимальное количество изменений в одном ответе Sync
+const MaxSyncChanges = 500
+
+// MaxSyncBytes сколько байт данных помещается в один ответ Sync, с запасом до предела gRPC в 4МБ на сообщение
+const MaxSyncBytes = 2 << 20
+
+// Sync Отвечает за получение изменений данных после ревизии since_revision для синхронизации локальной копии,
+// нужна авторизация. Токенам, ограниченным префиксами имен, синхронизация недоступна
+func (p *PamService) Sync(ctx context.Context, in *pamserver.SyncRequest) (*pamserver.SyncResponse, error) {
+	log.Info().Msg("got sync request")
+	resp := &pamserver.SyncResponse{}
+
+	userID, ok := ctx.Value(model.UserID).(int)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+	authToken, ok := ctx.Value(model.AuthToken).(string)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+
+	err := p.prolongToken(ctx, authToken)
+	if err != nil {
+		return resp, status.Error(codes.Internal, "error prolonging token")
+	}
+
+	// the revision covers the whole journal, a token that can't see all of it would skip the rest for good
+	if scope := scopeFromContext(ctx); scope != nil && len(scope.Prefixes) > 0 {
+		return resp, errSyncNotInScope
+	}
+
+	if in.SinceRevision < 0 {
+		return resp, status.Error(codes.InvalidArgument, "revision can't be negative")
+	}
+
+	limit := int(in.Limit)
+	if limit <= 0 || limit > MaxSyncChanges {
+		limit = MaxSyncChanges
+	}
+
+	set, err := p.s.GetChanges(ctx, userID, in.SinceRevision, limit, MaxSyncBytes)
+	if err != nil {
+		return resp, status.Error(codes.Internal, "internal error")
+	}
+
+	resp.Revision = set.Revision
+	resp.More = set.More
+	for _, change := range set.Changes {
+		c := &pamserver.Change{
+			Name:     change.Name,
+			Revision: change.Revision,
+			Deleted:  change.Deleted,
+		}
+		if !change.Deleted {
+			c.Kind = int32(change.Kind)
+			c.Data = change.Bytes
+			c.Version = int32(change.Version)
+			c.Folder = change.Folder
+			c.Tags = change.Tags
+			c.CreatedAt = timestamppb.New(change.CreatedAt)
+			c.UpdatedAt = timestamppb.New(change.UpdatedAt)
+		}
+
+		resp.Changes = append(resp.Changes, c)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/smakimka/pam/internal/protobuf/pamserver"
+	"github.com/smakimka/pam/internal/server/model"
+	"github.com/smakimka/pam/internal/server/storage"
+)
+
+// Logout Отвечает за выход, отзывает токен, с которым пришел запрос, нужна авторизация
+func (p *PamService) Logout(ctx context.Context, in *pamserver.LogoutRequest) (*pamserver.LogoutResponse, error) {
+	log.Info().Msg("got logout request")
+	resp := &pamserver.LogoutResponse{}
+
+	userID, ok := ctx.Value(model.UserID).(int)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+	authToken, ok := ctx.Value(model.AuthToken).(string)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+	if authToken == "" {
+		return resp, status.Error(codes.FailedPrecondition, "authenticated by a client certificate, there is no token to revoke")
+	}
+
+	if err := p.s.RevokeToken(ctx, userID, authToken, time.Now()); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return resp, status.Error(codes.NotFound, "this token does not exist")
+		}
+
+		return resp, status.Error(codes.Internal, "internal error")
+	}
+
+	return resp, nil
+}
+
+// RevokeToken Отвечает за отзыв другого токена того же пользователя по значению или по id сессии, нужна авторизация
+func (p *PamService) RevokeToken(ctx context.Context, in *pamserver.RevokeTokenRequest) (*pamserver.RevokeTokenResponse, error) {
+	log.Info().Msg("got revoke token request")
+	resp := &pamserver.RevokeTokenResponse{}
+
+	userID, ok := ctx.Value(model.UserID).(int)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+	authToken, ok := ctx.Value(model.AuthToken).(string)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+
+	err := p.prolongToken(ctx, authToken)
+	if err != nil {
+		return resp, status.Error(codes.Internal, "error prolonging token")
+	}
+
+	if in.Token == "" && in.SessionId == 0 {
+		return resp, status.Error(codes.InvalidArgument, "token or session id is required")
+	}
+
+	if in.Token != "" {
+		err = p.s.RevokeToken(ctx, userID, p.h.Hash(in.Token), time.Now())
+	} else {
+		err = p.s.RevokeSession(ctx, userID, int(in.SessionId), time.Now())
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return resp, status.Error(codes.NotFound, "this token does not exist")
+		}
+
+		return resp, status.Error(codes.Internal, "internal error")
+	}
+
+	return resp, nil
+}
+
+// ListSessions Отвечает за получение действующих токенов пользователя, нужна авторизация
+func (p *PamService) ListSessions(ctx context.Context, in *pamserver.ListSessionsRequest) (*pamserver.ListSessionsResponse, error) {
+	log.Info().Msg("got list sessions request")
+	resp := &pamserver.ListSessionsResponse{}
+
+	userID, ok := ctx.Value(model.UserID).(int)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+	authToken, ok := ctx.Value(model.AuthToken).(string)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+
+	err := p.prolongToken(ctx, authToken)
+	if err != nil {
+		return resp, status.Error(codes.Internal, "error prolonging token")
+	}
+
+	sessions, err := p.s.ListSessions(ctx, userID, time.Now())
+	if err != nil {
+		return resp, status.Error(codes.Internal, "internal error")
+	}
+
+	// token values never leave the server
+	for _, session := range sessions {
+		resp.Sessions = append(resp.Sessions, &pamserver.Session{
+			Id:         int32(session.ID),
+			CreatedAt:  timestamppb.New(session.CreatedAt),
+			LastUsedAt: timestamppb.New(session.UsedAt),
+			ExpiresAt:  timestamppb.New(session.ExpiresAt),
+			Ip:         session.IP,
+			UserAgent:  session.UserAgent,
+			Current:    session.Token == authToken,
+		})
+	}
+
+	return resp, nil
+}
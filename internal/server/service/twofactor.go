@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/smakimka/pam/internal/datatypes"
+	"github.com/smakimka/pam/internal/protobuf/pamserver"
+	"github.com/smakimka/pam/internal/server/model"
+	"github.com/smakimka/pam/internal/server/storage"
+)
+
+const (
+	// TwoFactorIssuer имя сервиса в приложении-аутентификаторе
+	TwoFactorIssuer = "pam"
+	// RecoveryCodesCount сколько кодов восстановления выдается при включении 2FA
+	RecoveryCodesCount = 10
+	// totpSkew на сколько периодов могут расходиться часы клиента и сервера
+	totpSkew = 1
+)
+
+// EnableTwoFactor Отвечает за начало включения 2FA, создает новый секрет TOTP, который нужно подтвердить кодом
+// через ConfirmTwoFactor, нужен пароль, нужна авторизация
+func (p *PamService) EnableTwoFactor(ctx context.Context, in *pamserver.EnableTwoFactorRequest) (*pamserver.EnableTwoFactorResponse, error) {
+	log.Info().Msg("got enable two-factor request")
+	resp := &pamserver.EnableTwoFactorResponse{}
+
+	userID, ok := ctx.Value(model.UserID).(int)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+	username, ok := ctx.Value(model.Username).(string)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+	authToken, ok := ctx.Value(model.AuthToken).(string)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+
+	err := p.prolongToken(ctx, authToken)
+	if err != nil {
+		return resp, status.Error(codes.Internal, "error prolonging token")
+	}
+
+	if err = p.checkPassword(ctx, userID, in.Pwd); err != nil {
+		return resp, err
+	}
+
+	totp, err := datatypes.GenerateTOTP(TwoFactorIssuer, username)
+	if err != nil {
+		return resp, status.Error(codes.Internal, "internal error")
+	}
+
+	if err = p.s.SetTwoFactorSecret(ctx, userID, totp.Secret); err != nil {
+		if errors.Is(err, storage.ErrTwoFactorEnabled) {
+			return resp, status.Error(codes.FailedPrecondition, "two-factor authentication is already enabled")
+		}
+
+		return resp, status.Error(codes.Internal, "internal error")
+	}
+
+	resp.Secret = totp.Secret
+	resp.Uri = totp.URI()
+	return resp, nil
+}
+
+// ConfirmTwoFactor Отвечает за подтверждение секрета TOTP кодом из приложения, включает 2FA и возвращает
+// одноразовые коды восстановления, нужна авторизация
+func (p *PamService) ConfirmTwoFactor(ctx context.Context, in *pamserver.ConfirmTwoFactorRequest) (*pamserver.ConfirmTwoFactorResponse, error) {
+	log.Info().Msg("got confirm two-factor request")
+	resp := &pamserver.ConfirmTwoFactorResponse{}
+
+	userID, ok := ctx.Value(model.UserID).(int)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+	authToken, ok := ctx.Value(model.AuthToken).(string)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+
+	err := p.prolongToken(ctx, authToken)
+	if err != nil {
+		return resp, status.Error(codes.Internal, "error prolonging token")
+	}
+
+	tf, err := p.s.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return resp, status.Error(codes.Internal, "internal error")
+	}
+	if tf.Enabled {
+		return resp, status.Error(codes.FailedPrecondition, "two-factor authentication is already enabled")
+	}
+	if tf.Secret == "" {
+		return resp, status.Error(codes.FailedPrecondition, "two-factor authentication is not being enabled")
+	}
+
+	counter, ok := datatypes.NewTOTP(tf.Secret).Verify(in.Code, time.Now(), totpSkew)
+	if !ok {
+		return resp, status.Error(codes.InvalidArgument, "wrong code")
+	}
+
+	recoveryCodes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return resp, status.Error(codes.Internal, "internal error")
+	}
+
+	if err = p.s.EnableTwoFactor(ctx, userID, counter, hashes); err != nil {
+		if errors.Is(err, storage.ErrTwoFactorEnabled) {
+			return resp, status.Error(codes.FailedPrecondition, "two-factor authentication is already enabled")
+		}
+
+		return resp, status.Error(codes.Internal, "internal error")
+	}
+
+	resp.RecoveryCodes = recoveryCodes
+	return resp, nil
+}
+
+// DisableTwoFactor Отвечает за выключение 2FA, нужны пароль и одноразовый код или код восстановления,
+// нужна авторизация
+func (p *PamService) DisableTwoFactor(ctx context.Context, in *pamserver.DisableTwoFactorRequest) (*pamserver.DisableTwoFactorResponse, error) {
+	log.Info().Msg("got disable two-factor request")
+	resp := &pamserver.DisableTwoFactorResponse{}
+
+	userID, ok := ctx.Value(model.UserID).(int)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+	authToken, ok := ctx.Value(model.AuthToken).(string)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+
+	err := p.prolongToken(ctx, authToken)
+	if err != nil {
+		return resp, status.Error(codes.Internal, "error prolonging token")
+	}
+
+	if err = p.checkPassword(ctx, userID, in.Pwd); err != nil {
+		return resp, err
+	}
+	if err = p.checkSecondFactor(ctx, userID, in.Code); err != nil {
+		return resp, err
+	}
+
+	if err = p.s.DisableTwoFactor(ctx, userID); err != nil {
+		if errors.Is(err, storage.ErrTwoFactorDisabled) {
+			return resp, status.Error(codes.FailedPrecondition, "two-factor authentication is not enabled")
+		}
+
+		return resp, status.Error(codes.Internal, "internal error")
+	}
+
+	log.Info().Msgf("user %d disabled two-factor authentication", userID)
+	return resp, nil
+}
+
+// RegenerateRecoveryCodes Отвечает за выпуск новых кодов восстановления взамен всех старых, нужны пароль и
+// одноразовый код или код восстановления, нужна авторизация
+func (p *PamService) RegenerateRecoveryCodes(ctx context.Context, in *pamserver.RegenerateRecoveryCodesRequest) (*pamserver.RegenerateRecoveryCodesResponse, error) {
+	log.Info().Msg("got regenerate recovery codes request")
+	resp := &pamserver.RegenerateRecoveryCodesResponse{}
+
+	userID, ok := ctx.Value(model.UserID).(int)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+	authToken, ok := ctx.Value(model.AuthToken).(string)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+
+	err := p.prolongToken(ctx, authToken)
+	if err != nil {
+		return resp, status.Error(codes.Internal, "error prolonging token")
+	}
+
+	if err = p.checkPassword(ctx, userID, in.Pwd); err != nil {
+		return resp, err
+	}
+	if err = p.checkSecondFactor(ctx, userID, in.Code); err != nil {
+		return resp, err
+	}
+
+	recoveryCodes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return resp, status.Error(codes.Internal, "internal error")
+	}
+
+	if err = p.s.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		if errors.Is(err, storage.ErrTwoFactorDisabled) {
+			return resp, status.Error(codes.FailedPrecondition, "two-factor authentication is not enabled")
+		}
+
+		return resp, status.Error(codes.Internal, "internal error")
+	}
+
+	resp.RecoveryCodes = recoveryCodes
+	return resp, nil
+}
+
+// checkSecondFactor проверяет одноразовый код или код восстановления, если у пользователя включена 2FA.
+// Каждый код принимается только один раз
+func (p *PamService) checkSecondFactor(ctx context.Context, userID int, code string) error {
+	tf, err := p.s.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return status.Error(codes.Internal, "internal error")
+	}
+	if !tf.Enabled {
+		return nil
+	}
+
+	if code == "" {
+		return status.Error(codes.Unauthenticated, "second factor required")
+	}
+
+	if counter, ok := datatypes.NewTOTP(tf.Secret).Verify(code, time.Now(), totpSkew); ok {
+		err = p.s.UseTOTPCounter(ctx, userID, counter)
+		if errors.Is(err, storage.ErrCodeReused) {
+			return status.Error(codes.PermissionDenied, "wrong second factor code")
+		}
+		if err != nil {
+			return status.Error(codes.Internal, "internal error")
+		}
+
+		return nil
+	}
+
+	err = p.s.UseRecoveryCode(ctx, userID, hashRecoveryCode(code), time.Now())
+	if errors.Is(err, storage.ErrNotFound) {
+		return status.Error(codes.PermissionDenied, "wrong second factor code")
+	}
+	if err != nil {
+		return status.Error(codes.Internal, "internal error")
+	}
+
+	log.Info().Msgf("user %d used a recovery code", userID)
+	return nil
+}
+
+// newRecoveryCodes возвращает RecoveryCodesCount новых кодов восстановления и их хеши
+func newRecoveryCodes() ([]string, [][]byte, error) {
+	recoveryCodes := make([]string, 0, RecoveryCodesCount)
+	hashes := make([][]byte, 0, RecoveryCodesCount)
+	for i := 0; i < RecoveryCodesCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		recoveryCodes = append(recoveryCodes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	return recoveryCodes, hashes, nil
+}
+
+// newRecoveryCode возвращает случайный код вида xxxx-xxxx-xxxx-xxxx
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+
+	return code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16], nil
+}
+
+// hashRecoveryCode хеширует код восстановления без учета регистра и разделителей. У кода 80 бит энтропии,
+// поэтому медленный хеш не нужен
+func hashRecoveryCode(code string) []byte {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+
+	return sum[:]
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/smakimka/pam/internal/protobuf/pamserver"
+	"github.com/smakimka/pam/internal/server/model"
+	"github.com/smakimka/pam/internal/server/storage"
+)
+
+// GetVaultParams Отвечает за получение параметров KDF, с которыми клиент получает ключ шифрования из мастер пароля.
+// Сервер их не интерпретирует, данные хранятся уже зашифрованными
+func (p *PamService) GetVaultParams(ctx context.Context, in *pamserver.VaultParamsRequest) (*pamserver.VaultParams, error) {
+	log.Info().Msg("got get vault params request")
+	resp := &pamserver.VaultParams{}
+
+	userID, ok := ctx.Value(model.UserID).(int)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+	authToken, ok := ctx.Value(model.AuthToken).(string)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+
+	err := p.prolongToken(ctx, authToken)
+	if err != nil {
+		return resp, status.Error(codes.Internal, "error prolonging token")
+	}
+
+	params, err := p.s.GetVaultParams(ctx, userID)
+	if err != nil {
+		return resp, status.Error(codes.Internal, "internal error")
+	}
+	if len(params) == 0 {
+		return resp, status.Error(codes.NotFound, "vault is not initialized")
+	}
+
+	resp.Params = params
+
+	return resp, nil
+}
+
+// SetVaultParams Отвечает за сохранение параметров KDF, сохранить их можно только один раз
+func (p *PamService) SetVaultParams(ctx context.Context, in *pamserver.VaultParams) (*pamserver.SetVaultParamsResponse, error) {
+	log.Info().Msg("got set vault params request")
+	resp := &pamserver.SetVaultParamsResponse{}
+
+	userID, ok := ctx.Value(model.UserID).(int)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+	authToken, ok := ctx.Value(model.AuthToken).(string)
+	if !ok {
+		return resp, status.Error(codes.Internal, "internal ctx error")
+	}
+
+	err := p.prolongToken(ctx, authToken)
+	if err != nil {
+		return resp, status.Error(codes.Internal, "error prolonging token")
+	}
+
+	if len(in.Params) == 0 {
+		return resp, status.Error(codes.InvalidArgument, "params are required")
+	}
+
+	err = p.s.SetVaultParams(ctx, userID, in.Params)
+	if err != nil {
+		if errors.Is(err, storage.ErrVaultParamsExist) {
+			return resp, status.Error(codes.AlreadyExists, "vault is already initialized")
+		}
+
+		return resp, status.Error(codes.Internal, "internal error")
+	}
+
+	return resp, nil
+}
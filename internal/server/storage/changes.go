@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"github.com/smakimka/pam/internal/server/model"
+)
+
+// changesPage страница изменений GetChanges: не больше limit изменений и не больше maxBytes байт,
+// но хотя бы одно изменение, иначе клиент с большой записью никогда не получит ее
+type changesPage struct {
+	set      *model.ChangeSet
+	limit    int
+	maxBytes int
+	size     int
+}
+
+func newChangesPage(set *model.ChangeSet, limit int, maxBytes int) *changesPage {
+	return &changesPage{set: set, limit: limit, maxBytes: maxBytes}
+}
+
+// add добавляет изменение, следующее по ревизии, если оно помещается на страницу. Если не помещается,
+// отмечает, что есть следующая страница, и возвращает false, тогда остальные изменения добавлять не нужно
+func (p *changesPage) add(change model.Change) bool {
+	p.size += changeSize(change)
+
+	if n := len(p.set.Changes); n > 0 && (n >= p.limit || p.size > p.maxBytes) {
+		p.set.Revision = p.set.Changes[n-1].Revision
+		p.set.More = true
+		return false
+	}
+
+	p.set.Changes = append(p.set.Changes, change)
+	return true
+}
+
+// changeSize примерный размер изменения в ответе
+func changeSize(change model.Change) int {
+	size := len(change.Name) + len(change.Bytes) + len(change.Folder)
+	for _, tag := range change.Tags {
+		size += len(tag)
+	}
+
+	return size
+}
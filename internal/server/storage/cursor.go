@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/smakimka/pam/internal/server/model"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+var ErrInvalidSort = errors.New("invalid sort key")
+
+// listCursor позиция последней записи страницы. Имя записи уникально для пользователя,
+// поэтому пара (ключ сортировки, имя) однозначно задает место, с которого начинается следующая страница
+type listCursor struct {
+	Sort   string    `json:"s"`
+	Folder string    `json:"f,omitempty"`
+	Time   time.Time `json:"t,omitempty"`
+	Name   string    `json:"n"`
+}
+
+func newListCursor(sort string, info model.DataInfo) string {
+	c := listCursor{Sort: sort, Name: info.Name}
+
+	switch sort {
+	case model.SortFolder:
+		c.Folder = info.Folder
+	case model.SortCreated:
+		c.Time = info.CreatedAt
+	case model.SortUpdated:
+		c.Time = info.UpdatedAt
+	}
+
+	// marshaling of this struct can't fail
+	data, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func parseListCursor(sort string, cursor string) (*listCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	c := &listCursor{}
+	if err = json.Unmarshal(data, c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	// a cursor from a differently sorted list points nowhere
+	if c.Sort != sort {
+		return nil, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// listSort возвращает ключ сортировки с учетом значения по умолчанию
+func listSort(opts model.ListOptions) (string, error) {
+	switch opts.Sort {
+	case "":
+		return model.SortFolder, nil
+	case model.SortFolder, model.SortName, model.SortCreated, model.SortUpdated:
+		return opts.Sort, nil
+	default:
+		return "", ErrInvalidSort
+	}
+}
@@ -0,0 +1,1089 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/smakimka/pam/internal/server/model"
+)
+
+// MemStorage хранилище в памяти процесса, например, для тестов, которым не нужна настоящая база.
+// Ведет себя так же, как PGStorage, в том числе возвращает ErrNotFound, когда строки нет.
+// Все методы можно вызывать из разных горутин, данные теряются при остановке сервера
+type MemStorage struct {
+	mu sync.Mutex
+
+	users     map[int]*memUser
+	usernames map[string]int
+	tokens    map[int]*memToken
+	byToken   map[string]int
+	data      map[int]*memData
+	attempts  map[string]*memLoginAttempt
+	jobs      map[string]bool
+
+	lastUserID  int
+	lastTokenID int
+	lastDataID  int
+	lastNow     time.Time
+}
+
+type memUser struct {
+	id       int
+	username string
+	pwd      []byte
+
+	vaultParams     []byte
+	totpSecret      string
+	totpEnabled     bool
+	totpLastCounter int64
+	// recoveryCodes хеши кодов восстановления, true - код уже использован
+	recoveryCodes map[string]bool
+
+	// data записи пользователя по имени
+	data map[string]*memData
+	// changes журнал изменений, последняя ревизия изменения каждой записи, в том числе удаленной
+	changes      map[string]int64
+	syncRevision int64
+}
+
+type memToken struct {
+	id     int
+	userID int
+	token  string
+	api    bool
+	scope  model.TokenScope
+	// description только для API токенов
+	description string
+	createdAt   time.Time
+	// expiresAt нулевое - токен бессрочный
+	expiresAt time.Time
+	revokedAt time.Time
+	usage     model.TokenUsage
+}
+
+type memData struct {
+	id      int
+	name    string
+	kind    int
+	bytes   []byte
+	version int
+	meta    model.DataMeta
+	chunks  [][]byte
+
+	createdAt time.Time
+	updatedAt time.Time
+
+	// history предыдущие версии от старых к новым
+	history []memVersion
+}
+
+type memVersion struct {
+	version    int
+	kind       int
+	bytes      []byte
+	chunks     [][]byte
+	replacedAt time.Time
+}
+
+type memLoginAttempt struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+func NewMemStorage() *MemStorage {
+	return &MemStorage{
+		users:     make(map[int]*memUser),
+		usernames: make(map[string]int),
+		tokens:    make(map[int]*memToken),
+		byToken:   make(map[string]int),
+		data:      make(map[int]*memData),
+		attempts:  make(map[string]*memLoginAttempt),
+		jobs:      make(map[string]bool),
+	}
+}
+
+// now текущее время с той же точностью, с которой его хранят базы. Время каждого следующего изменения
+// больше предыдущего, чтобы порядок по времени совпадал с порядком изменений. Вызывается под mu
+func (s *MemStorage) now() time.Time {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	if !now.After(s.lastNow) {
+		now = s.lastNow.Add(time.Microsecond)
+	}
+	s.lastNow = now
+
+	return now
+}
+
+func cloneChunks(chunks [][]byte) [][]byte {
+	if chunks == nil {
+		return nil
+	}
+
+	res := make([][]byte, 0, len(chunks))
+	for _, chunk := range chunks {
+		res = append(res, bytes.Clone(chunk))
+	}
+
+	return res
+}
+
+// cloneStrings копирует список, nil становится пустым списком, как при чтении из базы
+func cloneStrings(list []string) []string {
+	return append([]string{}, list...)
+}
+
+func cloneMeta(meta model.DataMeta) model.DataMeta {
+	return model.DataMeta{Folder: meta.Folder, Tags: cloneStrings(meta.Tags)}
+}
+
+// active действует ли токен в момент now
+func (t *memToken) active(now time.Time) bool {
+	return t.revokedAt.IsZero() && (t.expiresAt.IsZero() || !t.expiresAt.Before(now))
+}
+
+func (s *MemStorage) Init(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemStorage) GetUser(ctx context.Context, username string) (*model.UserData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, ok := s.usernames[username]
+	if !ok {
+		return &model.UserData{}, ErrNotFound
+	}
+	u := s.users[id]
+
+	return &model.UserData{ID: u.id, Username: u.username, Pwd: bytes.Clone(u.pwd)}, nil
+}
+
+func (s *MemStorage) GetUserByID(ctx context.Context, userID int) (*model.UserData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return &model.UserData{}, ErrNotFound
+	}
+
+	return &model.UserData{ID: u.id, Username: u.username, Pwd: bytes.Clone(u.pwd)}, nil
+}
+
+func (s *MemStorage) CreateUser(ctx context.Context, username string, pwd []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.usernames[username]; ok {
+		return 0, ErrUserExists
+	}
+
+	s.lastUserID++
+	u := &memUser{
+		id:            s.lastUserID,
+		username:      username,
+		pwd:           bytes.Clone(pwd),
+		recoveryCodes: make(map[string]bool),
+		data:          make(map[string]*memData),
+		changes:       make(map[string]int64),
+	}
+	s.users[u.id] = u
+	s.usernames[username] = u.id
+
+	return u.id, nil
+}
+
+func (s *MemStorage) GetVaultParams(ctx context.Context, userID int) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return bytes.Clone(u.vaultParams), nil
+}
+
+func (s *MemStorage) SetVaultParams(ctx context.Context, userID int, params []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok || u.vaultParams != nil {
+		return ErrVaultParamsExist
+	}
+
+	u.vaultParams = bytes.Clone(params)
+	return nil
+}
+
+func (s *MemStorage) GetTwoFactor(ctx context.Context, userID int) (*model.TwoFactor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return &model.TwoFactor{}, ErrNotFound
+	}
+
+	return &model.TwoFactor{Secret: u.totpSecret, Enabled: u.totpEnabled}, nil
+}
+
+func (s *MemStorage) SetTwoFactorSecret(ctx context.Context, userID int, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok || u.totpEnabled {
+		return ErrTwoFactorEnabled
+	}
+
+	u.totpSecret = secret
+	return nil
+}
+
+func (s *MemStorage) EnableTwoFactor(ctx context.Context, userID int, counter int64, recoveryCodes [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok || u.totpEnabled || u.totpSecret == "" {
+		return ErrTwoFactorEnabled
+	}
+
+	u.totpEnabled = true
+	u.totpLastCounter = counter
+
+	u.recoveryCodes = make(map[string]bool, len(recoveryCodes))
+	for _, code := range recoveryCodes {
+		u.recoveryCodes[string(code)] = false
+	}
+
+	return nil
+}
+
+func (s *MemStorage) DisableTwoFactor(ctx context.Context, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok || !u.totpEnabled {
+		return ErrTwoFactorDisabled
+	}
+
+	u.totpSecret = ""
+	u.totpEnabled = false
+	u.totpLastCounter = 0
+	u.recoveryCodes = make(map[string]bool)
+
+	return nil
+}
+
+func (s *MemStorage) ReplaceRecoveryCodes(ctx context.Context, userID int, recoveryCodes [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	if !u.totpEnabled {
+		return ErrTwoFactorDisabled
+	}
+
+	u.recoveryCodes = make(map[string]bool, len(recoveryCodes))
+	for _, code := range recoveryCodes {
+		u.recoveryCodes[string(code)] = false
+	}
+
+	return nil
+}
+
+func (s *MemStorage) UseTOTPCounter(ctx context.Context, userID int, counter int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok || u.totpLastCounter >= counter {
+		return ErrCodeReused
+	}
+
+	u.totpLastCounter = counter
+	return nil
+}
+
+func (s *MemStorage) UseRecoveryCode(ctx context.Context, userID int, codeHash []byte, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	used, ok := u.recoveryCodes[string(codeHash)]
+	if !ok || used {
+		return ErrNotFound
+	}
+
+	u.recoveryCodes[string(codeHash)] = true
+	return nil
+}
+
+func (s *MemStorage) GetLoginLock(ctx context.Context, key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.attempts[key]
+	if !ok {
+		return time.Time{}, nil
+	}
+
+	return attempt.lockedUntil, nil
+}
+
+func (s *MemStorage) AddLoginFailure(ctx context.Context, key string, now time.Time, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.attempts[key]
+	if !ok {
+		attempt = &memLoginAttempt{}
+		s.attempts[key] = attempt
+	}
+
+	if attempt.lastFailure.Before(now.Add(-window)) {
+		attempt.failures = 1
+	} else {
+		attempt.failures++
+	}
+	attempt.lastFailure = now
+
+	return attempt.failures, nil
+}
+
+func (s *MemStorage) LockLogin(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if attempt, ok := s.attempts[key]; ok {
+		attempt.lockedUntil = until
+	}
+
+	return nil
+}
+
+func (s *MemStorage) ResetLoginFailures(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+func (s *MemStorage) DeleteStaleLoginAttempts(ctx context.Context, before time.Time, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for key, attempt := range s.attempts {
+		if attempt.lastFailure.Before(before) && attempt.lockedUntil.Before(now) {
+			delete(s.attempts, key)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func (s *MemStorage) GetUserByToken(ctx context.Context, token string, now time.Time) (*model.UserData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[s.byToken[token]]
+	if !ok || !t.active(now) {
+		log.Info().Msg("no active token found")
+		return &model.UserData{}, ErrNoActiveToken
+	}
+
+	u := s.users[t.userID]
+	userData := &model.UserData{ID: u.id, Username: u.username}
+	if t.api {
+		userData.Scope = &model.TokenScope{Write: t.scope.Write, Prefixes: cloneStrings(t.scope.Prefixes)}
+	}
+
+	return userData, nil
+}
+
+// addToken сохраняет токен, как и в базе, значение токена должно быть уникальным
+func (s *MemStorage) addToken(t *memToken) (int, error) {
+	if _, ok := s.users[t.userID]; !ok {
+		return 0, fmt.Errorf("user %d does not exist", t.userID)
+	}
+	if _, ok := s.byToken[t.token]; ok {
+		return 0, errors.New("token already exists")
+	}
+
+	s.lastTokenID++
+	t.id = s.lastTokenID
+	t.createdAt = s.now()
+
+	s.tokens[t.id] = t
+	s.byToken[t.token] = t.id
+
+	return t.id, nil
+}
+
+func (s *MemStorage) CreateAuthToken(ctx context.Context, userID int, value string, expiry time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addToken(&memToken{userID: userID, token: value, expiresAt: expiry})
+}
+
+func (s *MemStorage) CreateApiToken(ctx context.Context, userID int, value string, token model.ApiToken) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addToken(&memToken{
+		userID:      userID,
+		token:       value,
+		api:         true,
+		scope:       model.TokenScope{Write: token.Write, Prefixes: cloneStrings(token.Prefixes)},
+		description: token.Description,
+		expiresAt:   token.ExpiresAt,
+	})
+}
+
+// userTokens возвращает токены пользователя, подходящие под filter, в порядке создания
+func (s *MemStorage) userTokens(userID int, filter func(t *memToken) bool) []*memToken {
+	res := []*memToken{}
+	for _, t := range s.tokens {
+		if t.userID == userID && filter(t) {
+			res = append(res, t)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].id < res[j].id })
+	return res
+}
+
+func (s *MemStorage) ListApiTokens(ctx context.Context, userID int, now time.Time) ([]model.ApiToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := []model.ApiToken{}
+	for _, t := range s.userTokens(userID, func(t *memToken) bool { return t.api && t.active(now) }) {
+		res = append(res, model.ApiToken{
+			ID:          t.id,
+			Description: t.description,
+			TokenScope:  model.TokenScope{Write: t.scope.Write, Prefixes: cloneStrings(t.scope.Prefixes)},
+			CreatedAt:   t.createdAt,
+			ExpiresAt:   t.expiresAt,
+			UsedAt:      t.usage.UsedAt,
+		})
+	}
+
+	return res, nil
+}
+
+func (s *MemStorage) ListSessions(ctx context.Context, userID int, now time.Time) ([]model.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := []model.Session{}
+	for _, t := range s.userTokens(userID, func(t *memToken) bool { return !t.api && t.active(now) }) {
+		session := model.Session{
+			ID:         t.id,
+			Token:      t.token,
+			CreatedAt:  t.createdAt,
+			ExpiresAt:  t.expiresAt,
+			TokenUsage: t.usage,
+		}
+		if session.UsedAt.IsZero() {
+			session.UsedAt = t.createdAt
+		}
+
+		res = append(res, session)
+	}
+
+	// recently used first, then newer tokens first
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].UsedAt.Equal(res[j].UsedAt) {
+			return res[i].UsedAt.After(res[j].UsedAt)
+		}
+		return res[i].ID > res[j].ID
+	})
+
+	return res, nil
+}
+
+func (s *MemStorage) DeleteExpiredTokens(ctx context.Context, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for id, t := range s.tokens {
+		if (!t.expiresAt.IsZero() && t.expiresAt.Before(now)) || !t.revokedAt.IsZero() {
+			s.deleteToken(id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func (s *MemStorage) deleteToken(id int) {
+	delete(s.byToken, s.tokens[id].token)
+	delete(s.tokens, id)
+}
+
+// MigrateTokens в памяти нет токенов, сохраненных до хеширования, поэтому мигрировать нечего
+func (s *MemStorage) MigrateTokens(ctx context.Context, hash func(token string) string) (int, error) {
+	return 0, nil
+}
+
+func (s *MemStorage) UpdateTokenExpiry(ctx context.Context, token string, newExpiry time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.tokens[s.byToken[token]]; ok && !t.api {
+		t.expiresAt = newExpiry
+	}
+
+	return nil
+}
+
+func (s *MemStorage) UpdateTokenUsage(ctx context.Context, token string, usage model.TokenUsage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.tokens[s.byToken[token]]; ok {
+		t.usage = usage
+	}
+
+	return nil
+}
+
+func (s *MemStorage) DeleteUser(ctx context.Context, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	for _, d := range u.data {
+		delete(s.data, d.id)
+	}
+	for id, t := range s.tokens {
+		if t.userID == userID {
+			s.deleteToken(id)
+		}
+	}
+	delete(s.usernames, u.username)
+	delete(s.users, userID)
+
+	return nil
+}
+
+func (s *MemStorage) UpdatePassword(ctx context.Context, userID int, pwd []byte, keepToken string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	u.pwd = bytes.Clone(pwd)
+	for _, t := range s.tokens {
+		if t.userID == userID && t.token != keepToken && t.revokedAt.IsZero() {
+			t.revokedAt = now
+		}
+	}
+
+	return nil
+}
+
+func (s *MemStorage) RevokeToken(ctx context.Context, userID int, token string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[s.byToken[token]]
+	if !ok || t.userID != userID || !t.active(now) {
+		return ErrNotFound
+	}
+
+	t.revokedAt = now
+	return nil
+}
+
+func (s *MemStorage) RevokeSession(ctx context.Context, userID int, sessionID int, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[sessionID]
+	if !ok || t.userID != userID || !t.active(now) {
+		return ErrNotFound
+	}
+
+	t.revokedAt = now
+	return nil
+}
+
+// journalChange записывает в журнал изменений, что запись изменилась или была удалена
+func (u *memUser) journalChange(name string) {
+	u.syncRevision++
+	u.changes[name] = u.syncRevision
+}
+
+// archive переносит текущую версию записи вместе с чанками в историю
+func (d *memData) archive(now time.Time) {
+	d.history = append(d.history, memVersion{
+		version:    d.version,
+		kind:       d.kind,
+		bytes:      d.bytes,
+		chunks:     d.chunks,
+		replacedAt: now,
+	})
+}
+
+// checkVersion проверяет текущую версию записи так же, как UpsertData
+func (u *memUser) checkVersion(name string, expectedVersion int) (int, error) {
+	version := 0
+	if d, ok := u.data[name]; ok {
+		version = d.version
+	}
+
+	if expectedVersion != AnyVersion && version != expectedVersion {
+		return version, ErrVersionConflict
+	}
+
+	return version, nil
+}
+
+// upsertData сохраняет новую версию записи с содержимым chunks, предыдущая версия остается в истории.
+// Возвращает номер новой версии
+func (s *MemStorage) upsertData(userID int, name string, kind int, data []byte, meta model.DataMeta, expectedVersion int, chunks [][]byte) (int, error) {
+	u, ok := s.users[userID]
+	if !ok {
+		return 0, fmt.Errorf("user %d does not exist", userID)
+	}
+
+	version, err := u.checkVersion(name, expectedVersion)
+	if err != nil {
+		return version, err
+	}
+
+	now := s.now()
+
+	d, ok := u.data[name]
+	if ok {
+		d.archive(now)
+		d.version++
+	} else {
+		s.lastDataID++
+		d = &memData{id: s.lastDataID, name: name, version: 1, createdAt: now}
+		u.data[name] = d
+		s.data[d.id] = d
+	}
+
+	d.kind = kind
+	d.bytes = bytes.Clone(data)
+	d.meta = cloneMeta(meta)
+	d.chunks = chunks
+	d.updatedAt = now
+
+	u.journalChange(name)
+
+	return d.version, nil
+}
+
+func (s *MemStorage) UpsertData(ctx context.Context, userID int, name string, kind int, data []byte, meta model.DataMeta, expectedVersion int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.upsertData(userID, name, kind, data, meta, expectedVersion, nil)
+}
+
+func (s *MemStorage) UpsertFile(ctx context.Context, userID int, name string, kind int, info []byte, meta model.DataMeta, expectedVersion int, next func() ([]byte, error)) (int, error) {
+	// a conflict is reported before the content is read, as the database backends do
+	s.mu.Lock()
+	u, ok := s.users[userID]
+	if ok {
+		if version, err := u.checkVersion(name, expectedVersion); err != nil {
+			s.mu.Unlock()
+			return version, err
+		}
+	}
+	s.mu.Unlock()
+
+	// the content comes from the network, it is read without holding the lock
+	chunks := [][]byte{}
+	for {
+		chunk, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		chunks = append(chunks, bytes.Clone(chunk))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the version is checked again, the record might have changed while the content was read
+	return s.upsertData(userID, name, kind, info, meta, expectedVersion, chunks)
+}
+
+func (s *MemStorage) GetFileChunks(ctx context.Context, dataID int, send func([]byte) error) error {
+	s.mu.Lock()
+	var chunks [][]byte
+	if d, ok := s.data[dataID]; ok {
+		chunks = cloneChunks(d.chunks)
+	}
+	s.mu.Unlock()
+
+	for _, chunk := range chunks {
+		if err := send(chunk); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *MemStorage) getData(userID int, name string) (*memData, bool) {
+	u, ok := s.users[userID]
+	if !ok {
+		return nil, false
+	}
+
+	d, ok := u.data[name]
+	return d, ok
+}
+
+func (s *MemStorage) GetData(ctx context.Context, userID int, name string) (*model.Data, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.getData(userID, name)
+	if !ok {
+		return &model.Data{UserID: userID, Name: name}, ErrNotFound
+	}
+
+	return &model.Data{
+		ID:        d.id,
+		UserID:    userID,
+		Name:      name,
+		Kind:      d.kind,
+		Bytes:     bytes.Clone(d.bytes),
+		Version:   d.version,
+		DataMeta:  cloneMeta(d.meta),
+		CreatedAt: d.createdAt,
+		UpdatedAt: d.updatedAt,
+	}, nil
+}
+
+func (s *MemStorage) GetDataVersions(ctx context.Context, userID int, name string) ([]model.DataVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := []model.DataVersion{}
+
+	d, ok := s.getData(userID, name)
+	if !ok {
+		return res, ErrNotFound
+	}
+
+	res = append(res, model.DataVersion{Version: d.version, Kind: d.kind, Current: true})
+	for i := len(d.history) - 1; i >= 0; i-- {
+		h := d.history[i]
+		res = append(res, model.DataVersion{Version: h.version, Kind: h.kind, ReplacedAt: h.replacedAt})
+	}
+
+	return res, nil
+}
+
+func (s *MemStorage) GetDataVersion(ctx context.Context, userID int, name string, version int) (*model.Data, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := &model.Data{UserID: userID, Name: name, Version: version}
+
+	d, ok := s.getData(userID, name)
+	if !ok {
+		return data, ErrNotFound
+	}
+	data.ID = d.id
+
+	if d.version == version {
+		data.Kind, data.Bytes = d.kind, bytes.Clone(d.bytes)
+		return data, nil
+	}
+
+	for _, h := range d.history {
+		if h.version == version {
+			data.Kind, data.Bytes = h.kind, bytes.Clone(h.bytes)
+			return data, nil
+		}
+	}
+
+	return data, ErrNotFound
+}
+
+func (s *MemStorage) RestoreData(ctx context.Context, userID int, name string, version int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.getData(userID, name)
+	if !ok {
+		return 0, ErrNotFound
+	}
+
+	if d.version == version {
+		return d.version, nil
+	}
+
+	i := slices.IndexFunc(d.history, func(h memVersion) bool { return h.version == version })
+	if i < 0 {
+		return d.version, ErrNoSuchVersion
+	}
+	h := d.history[i]
+
+	now := s.now()
+	d.archive(now)
+	d.version++
+	d.kind = h.kind
+	d.bytes = bytes.Clone(h.bytes)
+	d.chunks = cloneChunks(h.chunks)
+	d.updatedAt = now
+
+	s.users[userID].journalChange(name)
+
+	return d.version, nil
+}
+
+func (s *MemStorage) DeleteData(ctx context.Context, userID int, name string, expectedVersion int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.getData(userID, name)
+	if !ok {
+		return ErrNotFound
+	}
+	if expectedVersion != AnyVersion && d.version != expectedVersion {
+		return ErrVersionConflict
+	}
+
+	u := s.users[userID]
+	delete(u.data, name)
+	delete(s.data, d.id)
+	u.journalChange(name)
+
+	return nil
+}
+
+func (d *memData) info() model.DataInfo {
+	return model.DataInfo{
+		Name:      d.name,
+		Kind:      d.kind,
+		Version:   d.version,
+		DataMeta:  cloneMeta(d.meta),
+		CreatedAt: d.createdAt,
+		UpdatedAt: d.updatedAt,
+	}
+}
+
+// listTime время, по которому сортируется список
+func listTime(sort string, info model.DataInfo) time.Time {
+	if sort == model.SortCreated {
+		return info.CreatedAt
+	}
+	return info.UpdatedAt
+}
+
+// listLess идет ли a перед b в списке, отсортированном по sort. Строки сравниваются побайтово,
+// как collate "C" в Postgres
+func listLess(sort string, a, b model.DataInfo) bool {
+	switch sort {
+	case model.SortFolder:
+		if a.Folder != b.Folder {
+			return a.Folder < b.Folder
+		}
+	case model.SortCreated, model.SortUpdated:
+		ta, tb := listTime(sort, a), listTime(sort, b)
+		if !ta.Equal(tb) {
+			return ta.After(tb)
+		}
+	}
+
+	return a.Name < b.Name
+}
+
+func (s *MemStorage) ListData(ctx context.Context, userID int, opts model.ListOptions) ([]model.DataInfo, string, error) {
+	res := []model.DataInfo{}
+
+	sortKey, err := listSort(opts)
+	if err != nil {
+		return res, "", err
+	}
+
+	// records after the cursor are the ones a record with the cursor's keys would precede
+	var after *model.DataInfo
+	if opts.Cursor != "" {
+		cursor, err := parseListCursor(sortKey, opts.Cursor)
+		if err != nil {
+			return res, "", err
+		}
+
+		after = &model.DataInfo{
+			Name:      cursor.Name,
+			DataMeta:  model.DataMeta{Folder: cursor.Folder},
+			CreatedAt: cursor.Time,
+			UpdatedAt: cursor.Time,
+		}
+	}
+
+	s.mu.Lock()
+	if u, ok := s.users[userID]; ok {
+		for _, d := range u.data {
+			if !strings.HasPrefix(d.name, opts.Prefix) {
+				continue
+			}
+			if len(opts.Prefixes) > 0 && !slices.ContainsFunc(opts.Prefixes, func(prefix string) bool {
+				return strings.HasPrefix(d.name, prefix)
+			}) {
+				continue
+			}
+			if opts.Kind != nil && d.kind != *opts.Kind {
+				continue
+			}
+			if opts.Tag != "" && !slices.Contains(d.meta.Tags, opts.Tag) {
+				continue
+			}
+
+			info := d.info()
+			if after != nil && !listLess(sortKey, *after, info) {
+				continue
+			}
+
+			res = append(res, info)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(res, func(i, j int) bool { return listLess(sortKey, res[i], res[j]) })
+
+	next := ""
+	if opts.Limit > 0 && len(res) > opts.Limit {
+		res = res[:opts.Limit]
+		next = newListCursor(sortKey, res[len(res)-1])
+	}
+
+	return res, next, nil
+}
+
+func (s *MemStorage) GetDataNames(ctx context.Context, userID int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := []string{}
+	if u, ok := s.users[userID]; ok {
+		for name := range u.data {
+			res = append(res, name)
+		}
+	}
+
+	sort.Strings(res)
+	return res, nil
+}
+
+func (s *MemStorage) GetChanges(ctx context.Context, userID int, since int64, limit int, maxBytes int) (*model.ChangeSet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set := &model.ChangeSet{Changes: []model.Change{}}
+	changes := []model.Change{}
+
+	u, ok := s.users[userID]
+	if !ok {
+		return set, ErrNotFound
+	}
+	set.Revision = u.syncRevision
+
+	for name, revision := range u.changes {
+		if revision <= since {
+			continue
+		}
+
+		change := model.Change{Name: name, Revision: revision}
+
+		d, ok := u.data[name]
+		if !ok {
+			change.Deleted = true
+			change.Tags = []string{}
+			change.CreatedAt, change.UpdatedAt = time.Unix(0, 0).UTC(), time.Unix(0, 0).UTC()
+		} else {
+			change.Kind = d.kind
+			change.Bytes = bytes.Clone(d.bytes)
+			change.Version = d.version
+			change.DataMeta = cloneMeta(d.meta)
+			change.CreatedAt, change.UpdatedAt = d.createdAt, d.updatedAt
+		}
+
+		changes = append(changes, change)
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Revision < changes[j].Revision })
+
+	page := newChangesPage(set, limit, maxBytes)
+	for _, change := range changes {
+		if !page.add(change) {
+			break
+		}
+	}
+
+	if set.Revision < since {
+		set.Revision = since
+	}
+
+	return set, nil
+}
+
+// RunExclusive MemStorage не разделяется между экземплярами сервера, поэтому задачи исключают
+// друг друга только внутри процесса
+func (s *MemStorage) RunExclusive(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error) {
+	s.mu.Lock()
+	if s.jobs[name] {
+		s.mu.Unlock()
+		return false, nil
+	}
+	s.jobs[name] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.jobs, name)
+		s.mu.Unlock()
+	}()
+
+	return true, fn(ctx)
+}
@@ -0,0 +1,23 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/smakimka/pam/internal/server/storage"
+	"github.com/smakimka/pam/internal/server/storage/storagetest"
+)
+
+// MemStorageTestSuite те же сценарии на хранилище в памяти, каждый со своим пустым хранилищем
+type MemStorageTestSuite struct {
+	storagetest.Suite
+}
+
+func (s *MemStorageTestSuite) SetupTest() {
+	s.Storage = storage.NewMemStorage()
+}
+
+func TestMemStorageTestSuite(t *testing.T) {
+	suite.Run(t, new(MemStorageTestSuite))
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// migrationFiles миграции схемы, для каждой базы своя директория
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationName имя файла миграции: версия, подчеркивание и описание, например 0002_add_folders.sql
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.sql$`)
+
+// createSchemaVersion таблица с примененными миграциями, одинаковая для всех баз
+const createSchemaVersion = `create table if not exists schema_version (
+    version int primary key,
+    name text not null,
+    applied_timestamp timestamp not null
+)`
+
+// Migration изменение схемы базы. Миграции применяются по порядку версий, каждая ровно один раз
+type Migration struct {
+	Version int
+	Name    string
+	// AppliedAt когда миграция была применена, нулевое - еще не применена
+	AppliedAt time.Time
+
+	sql string
+}
+
+// Migrator хранилище, схема которого обновляется миграциями. Init таких хранилищ применяет новые миграции
+type Migrator interface {
+	// Migrations возвращает все миграции по порядку версий, в том числе примененные миграции, которых
+	// этот сервер не знает, потому что база обновлена более новым сервером
+	Migrations(ctx context.Context) ([]Migration, error)
+	// Migrate применяет еще не примененные миграции и возвращает их количество. Если база обновлена
+	// более новым сервером, ничего не делает и возвращает ErrUnknownMigration
+	Migrate(ctx context.Context) (int, error)
+}
+
+var ErrUnknownMigration = errors.New("the database schema is newer than this server")
+
+// loadMigrations читает миграции базы db из migrationFiles, версии должны идти подряд, начиная с 1
+func loadMigrations(db string) ([]Migration, error) {
+	dir := path.Join("migrations", db)
+
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// entries are sorted by name, zero padded versions keep them in order
+	migrations := make([]Migration, 0, len(entries))
+	for _, entry := range entries {
+		match := migrationName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("bad migration file name %s/%s", dir, entry.Name())
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, err
+		}
+		if version != len(migrations)+1 {
+			return nil, fmt.Errorf("migration %s/%s is out of order, want version %d", dir, entry.Name(), len(migrations)+1)
+		}
+
+		sql, err := fs.ReadFile(migrationFiles, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, Migration{Version: version, Name: match[2], sql: string(sql)})
+	}
+
+	return migrations, nil
+}
+
+// mergeMigrations отмечает в known примененные миграции из applied, строк schema_version по порядку версий,
+// и добавляет в конец примененные миграции, которых нет в known
+func mergeMigrations(known []Migration, applied []Migration) []Migration {
+	res := append([]Migration{}, known...)
+
+	for _, m := range applied {
+		if m.Version > len(known) {
+			res = append(res, m)
+			continue
+		}
+		res[m.Version-1].AppliedAt = m.AppliedAt
+	}
+
+	return res
+}
+
+// pendingMigrations возвращает миграции из known, которых нет в applied
+func pendingMigrations(known []Migration, applied []Migration) ([]Migration, error) {
+	done := make(map[int]bool, len(applied))
+	for _, m := range applied {
+		if m.Version > len(known) {
+			return nil, fmt.Errorf("%w: migration %d_%s", ErrUnknownMigration, m.Version, m.Name)
+		}
+		done[m.Version] = true
+	}
+
+	pending := []Migration{}
+	for _, m := range known {
+		if !done[m.Version] {
+			pending = append(pending, m)
+		}
+	}
+
+	return pending, nil
+}
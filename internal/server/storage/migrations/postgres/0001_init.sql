@@ -0,0 +1,108 @@
+-- the schema as it was created before versioned migrations, every statement is idempotent, so databases
+-- created back then are adopted as they are
+
+create table if not exists users (
+    id serial primary key,
+    username text,
+    pwd bytea,
+    constraint c_username_uq unique (username)
+);
+
+alter table users add column if not exists vault_params bytea;
+
+alter table users
+    add column if not exists totp_secret text,
+    add column if not exists totp_enabled bool not null default false,
+    add column if not exists totp_last_counter bigint not null default 0;
+
+create table if not exists recovery_codes (
+    user_id int references users(id),
+    code_hash bytea,
+    used_timestamp timestamp,
+    primary key (user_id, code_hash)
+);
+
+create table if not exists auths (
+    id serial primary key,
+    user_id int references users(id),
+    token text,
+    creation_timestamp timestamp default current_timestamp,
+    expiry_timestamp timestamp,
+    constraint c_token_uq unique (token)
+);
+
+alter table auths add column if not exists revoked_timestamp timestamp;
+
+-- rows created before tokens were hashed keep false until MigrateTokens
+alter table auths add column if not exists token_hashed bool not null default false;
+
+-- api tokens may have no expiry, then expiry_timestamp is null
+alter table auths
+    add column if not exists api_token bool not null default false,
+    add column if not exists scope_write bool not null default false,
+    add column if not exists scope_prefixes text[] not null default '{}',
+    add column if not exists description text not null default '';
+
+alter table auths
+    add column if not exists last_used_timestamp timestamp,
+    add column if not exists client_ip text not null default '',
+    add column if not exists user_agent text not null default '';
+
+create table if not exists user_data (
+    id serial primary key,
+    user_id int references users(id),
+    name text,
+    type int,
+    data bytea,
+    constraint c_name_uq unique (user_id, name)
+);
+
+alter table user_data add column if not exists version int not null default 1;
+
+alter table user_data
+    add column if not exists folder text not null default '',
+    add column if not exists tags text[] not null default '{}',
+    add column if not exists created_timestamp timestamp not null default current_timestamp,
+    add column if not exists updated_timestamp timestamp not null default current_timestamp;
+
+create table if not exists user_data_chunks (
+    data_id int references user_data(id) on delete cascade,
+    idx int,
+    chunk bytea,
+    primary key (data_id, idx)
+);
+
+create table if not exists user_data_history (
+    id serial primary key,
+    data_id int references user_data(id) on delete cascade,
+    version int,
+    type int,
+    data bytea,
+    replaced_timestamp timestamp default current_timestamp,
+    constraint c_version_uq unique (data_id, version)
+);
+
+create table if not exists user_data_history_chunks (
+    history_id int references user_data_history(id) on delete cascade,
+    idx int,
+    chunk bytea,
+    primary key (history_id, idx)
+);
+
+alter table users add column if not exists sync_revision bigint not null default 0;
+
+create table if not exists user_data_changes (
+    user_id int references users(id),
+    name text,
+    revision bigint not null,
+    primary key (user_id, name)
+);
+
+create index if not exists i_changes_revision on user_data_changes (user_id, revision);
+
+create table if not exists login_attempts (
+    key text primary key,
+    failures int not null default 0,
+    last_failure_timestamp timestamp,
+    locked_until_timestamp timestamp
+);
@@ -0,0 +1,101 @@
+-- the schema matches the postgres one as of 0001_init, times default to the same text format as the driver
+-- writes, but every query passes its times explicitly. Statements are idempotent, as databases created
+-- before versioned migrations already have these tables
+
+create table if not exists users (
+    id integer primary key,
+    username text,
+    pwd blob,
+    vault_params blob,
+    totp_secret text,
+    totp_enabled bool not null default false,
+    totp_last_counter integer not null default 0,
+    sync_revision integer not null default 0,
+    constraint c_username_uq unique (username)
+);
+
+create table if not exists recovery_codes (
+    user_id integer references users(id),
+    code_hash blob,
+    used_timestamp timestamp,
+    primary key (user_id, code_hash)
+);
+
+create table if not exists auths (
+    id integer primary key,
+    user_id integer references users(id),
+    token text,
+    creation_timestamp timestamp default (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    expiry_timestamp timestamp,
+    revoked_timestamp timestamp,
+    token_hashed bool not null default false,
+    api_token bool not null default false,
+    scope_write bool not null default false,
+    scope_prefixes text not null default '[]',
+    description text not null default '',
+    last_used_timestamp timestamp,
+    client_ip text not null default '',
+    user_agent text not null default '',
+    constraint c_token_uq unique (token)
+);
+
+create table if not exists user_data (
+    id integer primary key,
+    user_id integer references users(id),
+    name text,
+    type integer,
+    data blob,
+    version integer not null default 1,
+    folder text not null default '',
+    tags text not null default '[]',
+    created_timestamp timestamp not null default (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    updated_timestamp timestamp not null default (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    constraint c_name_uq unique (user_id, name)
+);
+
+create table if not exists user_data_chunks (
+    data_id integer references user_data(id) on delete cascade,
+    idx integer,
+    chunk blob,
+    primary key (data_id, idx)
+);
+
+create table if not exists user_data_history (
+    id integer primary key,
+    data_id integer references user_data(id) on delete cascade,
+    version integer,
+    type integer,
+    data blob,
+    replaced_timestamp timestamp default (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    constraint c_version_uq unique (data_id, version)
+);
+
+create table if not exists user_data_history_chunks (
+    history_id integer references user_data_history(id) on delete cascade,
+    idx integer,
+    chunk blob,
+    primary key (history_id, idx)
+);
+
+create table if not exists user_data_changes (
+    user_id integer references users(id),
+    name text,
+    revision integer not null,
+    primary key (user_id, name)
+);
+
+create index if not exists i_changes_revision on user_data_changes (user_id, revision);
+
+create table if not exists login_attempts (
+    key text primary key,
+    failures integer not null default 0,
+    last_failure_timestamp timestamp,
+    locked_until_timestamp timestamp
+);
+
+-- postgres has advisory locks for RunExclusive, here it is a lease
+create table if not exists job_locks (
+    name text primary key,
+    owner text not null,
+    expiry_timestamp timestamp not null
+);
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	for _, db := range []string{"postgres", "sqlite"} {
+		migrations, err := loadMigrations(db)
+		require.NoError(t, err, db)
+		require.NotEmpty(t, migrations, db)
+
+		for i, m := range migrations {
+			assert.Equal(t, i+1, m.Version, db)
+			assert.NotEmpty(t, m.Name, db)
+			assert.NotEmpty(t, m.sql, db)
+			assert.True(t, m.AppliedAt.IsZero(), db)
+		}
+	}
+
+	_, err := loadMigrations("oracle")
+	assert.Error(t, err)
+}
+
+func TestPendingMigrations(t *testing.T) {
+	now := time.Now()
+	known := []Migration{{Version: 1, Name: "init"}, {Version: 2, Name: "folders"}, {Version: 3, Name: "tags"}}
+
+	pending, err := pendingMigrations(known, nil)
+	require.NoError(t, err)
+	assert.Equal(t, known, pending)
+
+	applied := []Migration{{Version: 1, Name: "init", AppliedAt: now}, {Version: 2, Name: "folders", AppliedAt: now}}
+	pending, err = pendingMigrations(known, applied)
+	require.NoError(t, err)
+	assert.Equal(t, known[2:], pending)
+
+	merged := mergeMigrations(known, applied)
+	assert.Equal(t, now, merged[1].AppliedAt)
+	assert.True(t, merged[2].AppliedAt.IsZero())
+	assert.True(t, known[1].AppliedAt.IsZero())
+
+	// the database was migrated by a newer server
+	applied = append(applied, Migration{Version: 4, Name: "future", AppliedAt: now})
+	_, err = pendingMigrations(known[:3], applied)
+	assert.ErrorIs(t, err, ErrUnknownMigration)
+
+	merged = mergeMigrations(known, applied)
+	require.Len(t, merged, 4)
+	assert.Equal(t, "future", merged[3].Name)
+}
+
+// TestInitMigrationIsIdempotent databases created before versioned migrations get 0001 over the schema
+// they already have. For sqlite the suite runs it for real, postgres needs docker, so the statements are
+// checked here as well
+func TestInitMigrationIsIdempotent(t *testing.T) {
+	comment := regexp.MustCompile(`--[^\n]*`)
+	space := regexp.MustCompile(`\s+`)
+	idempotent := regexp.MustCompile(`^(create table if not exists|create index if not exists|alter table \w+ add column if not exists) `)
+
+	for _, db := range []string{"postgres", "sqlite"} {
+		migrations, err := loadMigrations(db)
+		require.NoError(t, err, db)
+
+		sql := comment.ReplaceAllString(migrations[0].sql, "")
+		for _, statement := range strings.Split(sql, ";") {
+			statement = strings.ToLower(strings.TrimSpace(space.ReplaceAllString(statement, " ")))
+			if statement == "" {
+				continue
+			}
+
+			assert.Regexp(t, idempotent, statement, db)
+
+			// every clause of an alter table has to skip columns that already exist
+			if strings.HasPrefix(statement, "alter table") {
+				for _, clause := range strings.Split(statement, ",")[1:] {
+					assert.True(t, strings.HasPrefix(strings.TrimSpace(clause), "add column if not exists "), "%s: %s", db, clause)
+				}
+			}
+		}
+	}
+}
@@ -3,9 +3,13 @@ package storage
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog/log"
 
@@ -13,11 +17,28 @@ import (
 )
 
 var ErrNoActiveToken = errors.New("no active token")
+var ErrVaultParamsExist = errors.New("vault params are already set")
+var ErrNoSuchVersion = errors.New("no such version")
+var ErrVersionConflict = errors.New("version conflict")
+var ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+var ErrTwoFactorDisabled = errors.New("two-factor authentication is not enabled")
+var ErrCodeReused = errors.New("one-time code was already used")
+var ErrUserExists = errors.New("user already exists")
+
+// ErrNotFound нужной строки нет, например, пользователя или записи. Хранилища возвращают ее вместо
+// ошибок своих драйверов
+var ErrNotFound = errors.New("not found")
+
+// AnyVersion передается в UpsertData, UpsertFile и DeleteData, чтобы изменить данные без проверки текущей версии
+const AnyVersion = -1
 
 type PGStorage struct {
 	p *pgxpool.Pool
 }
 
+// advisoryLockSpace первый ключ advisory блокировок сервера, чтобы не пересекаться с чужими блокировками в той же базе
+const advisoryLockSpace = 0x70616d
+
 func NewPGStorage(p *pgxpool.Pool) (*PGStorage, error) {
 	s := &PGStorage{
 		p: p,
@@ -31,61 +52,169 @@ func NewPGStorage(p *pgxpool.Pool) (*PGStorage, error) {
 	return s, nil
 }
 
+// notFound заменяет pgx.ErrNoRows на ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+// Init применяет новые миграции схемы
 func (s *PGStorage) Init(ctx context.Context) error {
-	tx, err := s.p.Begin(ctx)
+	_, err := s.Migrate(ctx)
+	return err
+}
+
+// migrationsLock имя advisory блокировки, под которой применяются миграции
+const migrationsLock = "migrations"
+
+// pgQuerier пул или одно соединение
+type pgQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// pgAppliedMigrations возвращает строки schema_version по порядку версий, пока ни одна миграция
+// не применена, таблицы может не быть
+func pgAppliedMigrations(ctx context.Context, q pgQuerier) ([]Migration, error) {
+	applied := []Migration{}
+
+	var exists bool
+	row := q.QueryRow(ctx, `select to_regclass('schema_version') is not null`)
+	if err := row.Scan(&exists); err != nil {
+		return applied, err
+	}
+	if !exists {
+		return applied, nil
+	}
+
+	rows, err := q.Query(ctx, `select version, name, applied_timestamp from schema_version order by version`)
 	if err != nil {
-		return err
+		return applied, err
 	}
-	defer tx.Rollback(ctx)
+	defer rows.Close()
+
+	for rows.Next() {
+		var m Migration
+
+		if err = rows.Scan(&m.Version, &m.Name, &m.AppliedAt); err != nil {
+			return applied, err
+		}
 
-	_, err = tx.Exec(ctx, `create table if not exists users (
-        id serial primary key,
-        username text,
-        pwd bytea,
-        constraint c_username_uq unique (username)
-    )`)
+		applied = append(applied, m)
+	}
+
+	if rows.Err() != nil {
+		return applied, rows.Err()
+	}
+
+	return applied, nil
+}
+
+func (s *PGStorage) Migrations(ctx context.Context) ([]Migration, error) {
+	known, err := loadMigrations("postgres")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = tx.Exec(ctx, `create table if not exists auths (
-        id serial primary key,
-        user_id int references users(id),
-        token text,
-        creation_timestamp timestamp default current_timestamp,
-        expiry_timestamp timestamp,
-        constraint c_token_uq unique (token)
-    )`)
+	applied, err := pgAppliedMigrations(ctx, s.p)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	return mergeMigrations(known, applied), nil
+}
+
+func (s *PGStorage) Migrate(ctx context.Context) (int, error) {
+	known, err := loadMigrations("postgres")
+	if err != nil {
+		return 0, err
+	}
+
+	// session level lock is held by this connection, servers started together wait here for each other,
+	// and the later ones find nothing to apply
+	conn, err := s.p.Acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Release()
+
+	if _, err = conn.Exec(ctx, `select pg_advisory_lock($1, hashtext($2))`, advisoryLockSpace, migrationsLock); err != nil {
+		return 0, err
+	}
+	defer func() {
+		// ctx may be already canceled, the lock must be released anyway
+		if _, err := conn.Exec(context.Background(), `select pg_advisory_unlock($1, hashtext($2))`, advisoryLockSpace, migrationsLock); err != nil {
+			// a connection with a dangling lock must not go back to the pool
+			conn.Conn().Close(context.Background())
+		}
+	}()
+
+	if _, err = conn.Exec(ctx, createSchemaVersion); err != nil {
+		return 0, err
+	}
+
+	applied, err := pgAppliedMigrations(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+
+	pending, err := pendingMigrations(known, applied)
+	if err != nil {
+		return 0, err
 	}
 
-	_, err = tx.Exec(ctx, `create table if not exists user_data (
-        id serial primary key,
-        user_id int references users(id),
-        name text,
-        type int,
-        data bytea,
-        constraint c_name_uq unique (user_id, name)
-    )`)
+	for i, m := range pending {
+		if err = applyPGMigration(ctx, conn, m); err != nil {
+			return i, fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		log.Info().Msgf("applied migration %d_%s", m.Version, m.Name)
+	}
+
+	return len(pending), nil
+}
+
+// applyPGMigration применяет миграцию и записывает ее в schema_version в одной транзакции
+func applyPGMigration(ctx context.Context, conn *pgxpool.Conn, m Migration) error {
+	tx, err := conn.Begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
+
+	// without arguments the file is sent as is, so it may hold several statements
+	if _, err = tx.Exec(ctx, m.sql); err != nil {
+		return err
+	}
 
-	err = tx.Commit(ctx)
+	_, err = tx.Exec(ctx, `insert into schema_version (version, name, applied_timestamp) values ($1, $2, $3)`,
+		m.Version, m.Name, time.Now().UTC())
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return tx.Commit(ctx)
 }
 
 func (s *PGStorage) GetUser(ctx context.Context, username string) (*model.UserData, error) {
 	user := &model.UserData{}
 
-	row := s.p.QueryRow(ctx, `select id, username, pwd from users where username like $1`, username)
+	row := s.p.QueryRow(ctx, `select id, username, pwd from users where username = $1`, username)
+	if err := row.Scan(&user.ID, &user.Username, &user.Pwd); err != nil {
+		return user, notFound(err)
+	}
+
+	return user, nil
+}
+
+func (s *PGStorage) GetUserByID(ctx context.Context, userID int) (*model.UserData, error) {
+	user := &model.UserData{}
+
+	row := s.p.QueryRow(ctx, `select id, username, pwd from users where id = $1`, userID)
 	if err := row.Scan(&user.ID, &user.Username, &user.Pwd); err != nil {
-		return user, err
+		return user, notFound(err)
 	}
 
 	return user, nil
@@ -102,6 +231,11 @@ func (s *PGStorage) CreateUser(ctx context.Context, username string, pwd []byte)
 
 	row := tx.QueryRow(ctx, `insert into users as u (username, pwd) values ($1, $2) returning u.id`, username, pwd)
 	if err = row.Scan(&newUserID); err != nil {
+		var pgErr *pgconn.PgError
+		// 23505 - unique_violation
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return newUserID, ErrUserExists
+		}
 		return newUserID, err
 	}
 
@@ -112,57 +246,154 @@ func (s *PGStorage) CreateUser(ctx context.Context, username string, pwd []byte)
 	return newUserID, nil
 }
 
-func (s *PGStorage) GetUserByToken(ctx context.Context, token string, now time.Time) (*model.UserData, error) {
-	userData := &model.UserData{}
+func (s *PGStorage) GetVaultParams(ctx context.Context, userID int) ([]byte, error) {
+	var params []byte
 
-	row := s.p.QueryRow(ctx, `select u.id, u.username from users as u 
-    join auths as a on a.user_id = u.id
-    where a.token = $1 and a.expiry_timestamp >= $2`, token, now)
-	if err := row.Scan(&userData.ID, &userData.Username); err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			log.Info().Msg("no active token found")
-			return userData, ErrNoActiveToken
-		}
+	row := s.p.QueryRow(ctx, `select vault_params from users where id = $1`, userID)
+	if err := row.Scan(&params); err != nil {
+		return params, notFound(err)
+	}
 
-		return userData, err
+	return params, nil
+}
+
+func (s *PGStorage) SetVaultParams(ctx context.Context, userID int, params []byte) error {
+	tx, err := s.p.Begin(ctx)
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback(ctx)
 
-	return userData, nil
+	tag, err := tx.Exec(ctx, `update users set vault_params = $1 where id = $2 and vault_params is null`, params, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrVaultParamsExist
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	return nil
 }
 
-func (s *PGStorage) CreateAuthToken(ctx context.Context, userID int, value string, expiry time.Time) (int, error) {
-	var newTokenID int
+func (s *PGStorage) GetTwoFactor(ctx context.Context, userID int) (*model.TwoFactor, error) {
+	tf := &model.TwoFactor{}
+
+	row := s.p.QueryRow(ctx, `select coalesce(totp_secret, ''), totp_enabled from users where id = $1`, userID)
+	if err := row.Scan(&tf.Secret, &tf.Enabled); err != nil {
+		return tf, notFound(err)
+	}
+
+	return tf, nil
+}
+
+func (s *PGStorage) SetTwoFactorSecret(ctx context.Context, userID int, secret string) error {
+	tag, err := s.p.Exec(ctx, `update users set totp_secret = $1 where id = $2 and not totp_enabled`, secret, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTwoFactorEnabled
+	}
 
+	return nil
+}
+
+func (s *PGStorage) EnableTwoFactor(ctx context.Context, userID int, counter int64, recoveryCodes [][]byte) error {
 	tx, err := s.p.Begin(ctx)
 	if err != nil {
-		return newTokenID, err
+		return err
 	}
 	defer tx.Rollback(ctx)
 
-	row := s.p.QueryRow(ctx, `insert into auths as a (user_id, token, expiry_timestamp) values ($1, $2, $3) returning a.id`, userID, value, expiry)
-	if err = row.Scan(&newTokenID); err != nil {
-		return newTokenID, err
+	tag, err := tx.Exec(ctx, `update users set totp_enabled = true, totp_last_counter = $1
+    where id = $2 and not totp_enabled and totp_secret is not null`, counter, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTwoFactorEnabled
+	}
+
+	_, err = tx.Exec(ctx, `delete from recovery_codes where user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, code := range recoveryCodes {
+		_, err = tx.Exec(ctx, `insert into recovery_codes (user_id, code_hash) values ($1, $2)`, userID, code)
+		if err != nil {
+			return err
+		}
 	}
 
 	if err = tx.Commit(ctx); err != nil {
-		return newTokenID, err
+		return err
 	}
 
-	return newTokenID, err
+	return nil
 }
 
-func (s *PGStorage) UpdateTokenExpiry(ctx context.Context, token string, newExpiry time.Time) error {
+func (s *PGStorage) DisableTwoFactor(ctx context.Context, userID int) error {
+	tx, err := s.p.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `update users set totp_secret = null, totp_enabled = false, totp_last_counter = 0
+    where id = $1 and totp_enabled`, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTwoFactorDisabled
+	}
+
+	_, err = tx.Exec(ctx, `delete from recovery_codes where user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *PGStorage) ReplaceRecoveryCodes(ctx context.Context, userID int, recoveryCodes [][]byte) error {
 	tx, err := s.p.Begin(ctx)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback(ctx)
 
-	_, err = tx.Exec(ctx, `update auths set expiry_timestamp = $1 where token = $2`, newExpiry, token)
+	// the user row is locked so that 2FA can't be disabled in between
+	var enabled bool
+	row := tx.QueryRow(ctx, `select totp_enabled from users where id = $1 for update`, userID)
+	if err = row.Scan(&enabled); err != nil {
+		return notFound(err)
+	}
+	if !enabled {
+		return ErrTwoFactorDisabled
+	}
+
+	_, err = tx.Exec(ctx, `delete from recovery_codes where user_id = $1`, userID)
 	if err != nil {
 		return err
 	}
 
+	for _, code := range recoveryCodes {
+		_, err = tx.Exec(ctx, `insert into recovery_codes (user_id, code_hash) values ($1, $2)`, userID, code)
+		if err != nil {
+			return err
+		}
+	}
+
 	if err = tx.Commit(ctx); err != nil {
 		return err
 	}
@@ -170,58 +401,186 @@ func (s *PGStorage) UpdateTokenExpiry(ctx context.Context, token string, newExpi
 	return nil
 }
 
-func (s *PGStorage) UpsertData(ctx context.Context, userID int, name string, kind int, data []byte) (int, error) {
-	var DataID int
+func (s *PGStorage) UseTOTPCounter(ctx context.Context, userID int, counter int64) error {
+	tag, err := s.p.Exec(ctx, `update users set totp_last_counter = $1 where id = $2 and totp_last_counter < $1`, counter, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCodeReused
+	}
+
+	return nil
+}
+
+func (s *PGStorage) UseRecoveryCode(ctx context.Context, userID int, codeHash []byte, now time.Time) error {
+	tag, err := s.p.Exec(ctx, `update recovery_codes set used_timestamp = $1
+    where user_id = $2 and code_hash = $3 and used_timestamp is null`, now, userID, codeHash)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *PGStorage) GetLoginLock(ctx context.Context, key string) (time.Time, error) {
+	var lockedUntil *time.Time
+
+	row := s.p.QueryRow(ctx, `select locked_until_timestamp from login_attempts where key = $1`, key)
+	if err := row.Scan(&lockedUntil); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return time.Time{}, nil
+		}
+
+		return time.Time{}, err
+	}
+
+	if lockedUntil == nil {
+		return time.Time{}, nil
+	}
+	return *lockedUntil, nil
+}
+
+func (s *PGStorage) AddLoginFailure(ctx context.Context, key string, now time.Time, window time.Duration) (int, error) {
+	var failures int
+
+	row := s.p.QueryRow(ctx, `insert into login_attempts (key, failures, last_failure_timestamp) values ($1, 1, $2)
+    on conflict (key) do update set
+        failures = case when login_attempts.last_failure_timestamp < $3 then 1 else login_attempts.failures + 1 end,
+        last_failure_timestamp = excluded.last_failure_timestamp
+    returning failures`, key, now, now.Add(-window))
+	if err := row.Scan(&failures); err != nil {
+		return 0, err
+	}
+
+	return failures, nil
+}
+
+func (s *PGStorage) LockLogin(ctx context.Context, key string, until time.Time) error {
+	_, err := s.p.Exec(ctx, `update login_attempts set locked_until_timestamp = $1 where key = $2`, until, key)
+	return err
+}
+
+func (s *PGStorage) ResetLoginFailures(ctx context.Context, key string) error {
+	_, err := s.p.Exec(ctx, `delete from login_attempts where key = $1`, key)
+	return err
+}
+
+func (s *PGStorage) DeleteStaleLoginAttempts(ctx context.Context, before time.Time, now time.Time) (int, error) {
+	tag, err := s.p.Exec(ctx, `delete from login_attempts
+    where (last_failure_timestamp is null or last_failure_timestamp < $1)
+    and (locked_until_timestamp is null or locked_until_timestamp < $2)`, before, now)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+func (s *PGStorage) GetUserByToken(ctx context.Context, token string, now time.Time) (*model.UserData, error) {
+	userData := &model.UserData{}
+
+	var apiToken bool
+	scope := &model.TokenScope{}
+
+	row := s.p.QueryRow(ctx, `select u.id, u.username, a.api_token, a.scope_write, a.scope_prefixes from users as u 
+    join auths as a on a.user_id = u.id
+    where a.token = $1 and (a.expiry_timestamp is null or a.expiry_timestamp >= $2) and a.revoked_timestamp is null`, token, now)
+	if err := row.Scan(&userData.ID, &userData.Username, &apiToken, &scope.Write, &scope.Prefixes); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Info().Msg("no active token found")
+			return userData, ErrNoActiveToken
+		}
+
+		return userData, err
+	}
+
+	if apiToken {
+		userData.Scope = scope
+	}
+
+	return userData, nil
+}
+
+func (s *PGStorage) CreateAuthToken(ctx context.Context, userID int, value string, expiry time.Time) (int, error) {
+	var newTokenID int
 
 	tx, err := s.p.Begin(ctx)
 	if err != nil {
-		return DataID, err
+		return newTokenID, err
 	}
 	defer tx.Rollback(ctx)
 
-	row := tx.QueryRow(ctx, `insert into user_data as ud (user_id, name, type, data)
-    values ($1, $2, $3, $4) on conflict on constraint c_name_uq do 
-    update set type = $3, data = $4 returning ud.id`, userID, name, kind, data)
-	if err = row.Scan(&DataID); err != nil {
-		return DataID, err
+	row := s.p.QueryRow(ctx, `insert into auths as a (user_id, token, expiry_timestamp, token_hashed) values ($1, $2, $3, true) returning a.id`, userID, value, expiry)
+	if err = row.Scan(&newTokenID); err != nil {
+		return newTokenID, err
 	}
 
 	if err = tx.Commit(ctx); err != nil {
-		return DataID, err
+		return newTokenID, err
 	}
 
-	return DataID, err
+	return newTokenID, err
 }
 
-func (s *PGStorage) GetData(ctx context.Context, userID int, name string) (*model.Data, error) {
-	data := &model.Data{UserID: userID, Name: name}
+func (s *PGStorage) CreateApiToken(ctx context.Context, userID int, value string, token model.ApiToken) (int, error) {
+	var newTokenID int
 
-	row := s.p.QueryRow(ctx, `select id, type, data from user_data where user_id = $1 and name = $2`, userID, name)
-	if err := row.Scan(&data.ID, &data.Kind, &data.Bytes); err != nil {
-		return data, err
+	var expiry *time.Time
+	if !token.ExpiresAt.IsZero() {
+		expiry = &token.ExpiresAt
 	}
 
-	return data, nil
+	prefixes := token.Prefixes
+	if prefixes == nil {
+		prefixes = []string{}
+	}
+
+	row := s.p.QueryRow(ctx, `insert into auths as a
+    (user_id, token, expiry_timestamp, token_hashed, api_token, scope_write, scope_prefixes, description)
+    values ($1, $2, $3, true, true, $4, $5, $6) returning a.id`,
+		userID, value, expiry, token.Write, prefixes, token.Description)
+	if err := row.Scan(&newTokenID); err != nil {
+		return newTokenID, err
+	}
+
+	return newTokenID, nil
 }
 
-func (s *PGStorage) GetDataNames(ctx context.Context, userID int) ([]string, error) {
-	res := []string{}
+func (s *PGStorage) ListApiTokens(ctx context.Context, userID int, now time.Time) ([]model.ApiToken, error) {
+	res := []model.ApiToken{}
 
-	rows, err := s.p.Query(ctx, `select name from user_data where user_id = $1`, userID)
+	rows, err := s.p.Query(ctx, `select id, description, scope_write, scope_prefixes, creation_timestamp,
+    expiry_timestamp, last_used_timestamp
+    from auths where user_id = $1 and api_token and (expiry_timestamp is null or expiry_timestamp >= $2)
+    and revoked_timestamp is null
+    order by id`, userID, now)
 	if err != nil {
 		return res, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var name string
+		var token model.ApiToken
+		var expiresAt, usedAt *time.Time
 
-		err = rows.Scan(&name)
+		err = rows.Scan(&token.ID, &token.Description, &token.Write, &token.Prefixes, &token.CreatedAt,
+			&expiresAt, &usedAt)
 		if err != nil {
 			return res, err
 		}
 
-		res = append(res, name)
+		if expiresAt != nil {
+			token.ExpiresAt = *expiresAt
+		}
+		if usedAt != nil {
+			token.UsedAt = *usedAt
+		}
+
+		res = append(res, token)
 	}
 
 	if rows.Err() != nil {
@@ -230,3 +589,785 @@ func (s *PGStorage) GetDataNames(ctx context.Context, userID int) ([]string, err
 
 	return res, nil
 }
+
+func (s *PGStorage) DeleteExpiredTokens(ctx context.Context, now time.Time) (int, error) {
+	tag, err := s.p.Exec(ctx, `delete from auths where expiry_timestamp < $1 or revoked_timestamp is not null`, now)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+func (s *PGStorage) MigrateTokens(ctx context.Context, hash func(token string) string) (int, error) {
+	tx, err := s.p.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `select id, token from auths where not token_hashed for update`)
+	if err != nil {
+		return 0, err
+	}
+
+	plain := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var token string
+		if err = rows.Scan(&id, &token); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		plain[id] = token
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for id, token := range plain {
+		_, err = tx.Exec(ctx, `update auths set token = $1, token_hashed = true where id = $2`, hash(token), id)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return len(plain), nil
+}
+
+func (s *PGStorage) UpdateTokenExpiry(ctx context.Context, token string, newExpiry time.Time) error {
+	tx, err := s.p.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `update auths set expiry_timestamp = $1 where token = $2 and not api_token`, newExpiry, token)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *PGStorage) DeleteUser(ctx context.Context, userID int) error {
+	tx, err := s.p.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// chunks and history go away with user_data by cascade
+	for _, query := range []string{
+		`delete from user_data where user_id = $1`,
+		`delete from user_data_changes where user_id = $1`,
+		`delete from recovery_codes where user_id = $1`,
+		`delete from auths where user_id = $1`,
+	} {
+		if _, err = tx.Exec(ctx, query, userID); err != nil {
+			return err
+		}
+	}
+
+	tag, err := tx.Exec(ctx, `delete from users where id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *PGStorage) UpdatePassword(ctx context.Context, userID int, pwd []byte, keepToken string, now time.Time) error {
+	tx, err := s.p.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `update users set pwd = $1 where id = $2`, pwd, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	_, err = tx.Exec(ctx, `update auths set revoked_timestamp = $1
+    where user_id = $2 and token <> $3 and revoked_timestamp is null`, now, userID, keepToken)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *PGStorage) RevokeToken(ctx context.Context, userID int, token string, now time.Time) error {
+	tx, err := s.p.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `update auths set revoked_timestamp = $1
+    where user_id = $2 and token = $3 and (expiry_timestamp is null or expiry_timestamp >= $1)
+    and revoked_timestamp is null`, now, userID, token)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *PGStorage) RevokeSession(ctx context.Context, userID int, sessionID int, now time.Time) error {
+	tx, err := s.p.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `update auths set revoked_timestamp = $1
+    where user_id = $2 and id = $3 and (expiry_timestamp is null or expiry_timestamp >= $1)
+    and revoked_timestamp is null`, now, userID, sessionID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *PGStorage) UpdateTokenUsage(ctx context.Context, token string, usage model.TokenUsage) error {
+	_, err := s.p.Exec(ctx, `update auths set last_used_timestamp = $1, client_ip = $2, user_agent = $3 where token = $4`,
+		usage.UsedAt, usage.IP, usage.UserAgent, token)
+
+	return err
+}
+
+func (s *PGStorage) ListSessions(ctx context.Context, userID int, now time.Time) ([]model.Session, error) {
+	res := []model.Session{}
+
+	rows, err := s.p.Query(ctx, `select id, token, creation_timestamp, expiry_timestamp,
+    coalesce(last_used_timestamp, creation_timestamp), client_ip, user_agent
+    from auths where user_id = $1 and not api_token and expiry_timestamp >= $2 and revoked_timestamp is null
+    order by coalesce(last_used_timestamp, creation_timestamp) desc, id desc`, userID, now)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var session model.Session
+
+		err = rows.Scan(&session.ID, &session.Token, &session.CreatedAt, &session.ExpiresAt,
+			&session.UsedAt, &session.IP, &session.UserAgent)
+		if err != nil {
+			return res, err
+		}
+
+		res = append(res, session)
+	}
+
+	if rows.Err() != nil {
+		return res, rows.Err()
+	}
+
+	return res, nil
+}
+
+// archiveData переносит текущую версию записи вместе с чанками в историю
+func archiveData(ctx context.Context, tx pgx.Tx, userID int, name string) error {
+	_, err := tx.Exec(ctx, `with archived as (
+        insert into user_data_history as h (data_id, version, type, data)
+        select id, version, type, data from user_data where user_id = $1 and name = $2
+        returning h.id, h.data_id
+    )
+    insert into user_data_history_chunks (history_id, idx, chunk)
+    select a.id, c.idx, c.chunk from archived as a join user_data_chunks as c on c.data_id = a.data_id`, userID, name)
+
+	return err
+}
+
+// journalChange записывает в журнал изменений, что запись изменилась или была удалена.
+// Ревизия пользователя увеличивается под блокировкой его строки, поэтому изменения одного пользователя
+// фиксируются в порядке ревизий и синхронизация не пропустит изменение из еще не зафиксированной транзакции
+func journalChange(ctx context.Context, tx pgx.Tx, userID int, name string) error {
+	var revision int64
+
+	row := tx.QueryRow(ctx, `update users set sync_revision = sync_revision + 1 where id = $1 returning sync_revision`, userID)
+	if err := row.Scan(&revision); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(ctx, `insert into user_data_changes (user_id, name, revision) values ($1, $2, $3)
+    on conflict (user_id, name) do update set revision = $3`, userID, name, revision)
+
+	return err
+}
+
+// upsertData сохраняет новую версию записи, предыдущая версия остается в истории.
+// Возвращает id записи и номер новой версии
+func upsertData(ctx context.Context, tx pgx.Tx, userID int, name string, kind int, data []byte, meta model.DataMeta, expectedVersion int) (int, int, error) {
+	var dataID, version int
+
+	if meta.Tags == nil {
+		meta.Tags = []string{}
+	}
+
+	switch {
+	case expectedVersion == 0:
+		// the record must not exist, a concurrent insert is caught by the unique constraint
+		row := tx.QueryRow(ctx, `insert into user_data as ud (user_id, name, type, data, folder, tags)
+        values ($1, $2, $3, $4, $5, $6) on conflict on constraint c_name_uq do nothing
+        returning ud.id, ud.version`, userID, name, kind, data, meta.Folder, meta.Tags)
+		if err := row.Scan(&dataID, &version); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return dataID, version, ErrVersionConflict
+			}
+			return dataID, version, err
+		}
+
+		if err := journalChange(ctx, tx, userID, name); err != nil {
+			return dataID, version, err
+		}
+
+		return dataID, version, nil
+	}
+
+	// the row is locked before it is archived, otherwise a concurrent upsert could archive the same version twice
+	row := tx.QueryRow(ctx, `select version from user_data where user_id = $1 and name = $2 for update`, userID, name)
+	if err := row.Scan(&version); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return dataID, version, err
+	}
+
+	if expectedVersion != AnyVersion && version != expectedVersion {
+		return dataID, version, ErrVersionConflict
+	}
+
+	if err := archiveData(ctx, tx, userID, name); err != nil {
+		return dataID, version, err
+	}
+
+	row = tx.QueryRow(ctx, `insert into user_data as ud (user_id, name, type, data, folder, tags)
+    values ($1, $2, $3, $4, $5, $6) on conflict on constraint c_name_uq do 
+    update set type = $3, data = $4, folder = $5, tags = $6, version = ud.version + 1, updated_timestamp = current_timestamp
+    returning ud.id, ud.version`, userID, name, kind, data, meta.Folder, meta.Tags)
+	if err := row.Scan(&dataID, &version); err != nil {
+		return dataID, version, err
+	}
+
+	// the record might have been a file before
+	_, err := tx.Exec(ctx, `delete from user_data_chunks where data_id = $1`, dataID)
+	if err != nil {
+		return dataID, version, err
+	}
+
+	if err = journalChange(ctx, tx, userID, name); err != nil {
+		return dataID, version, err
+	}
+
+	return dataID, version, nil
+}
+
+func (s *PGStorage) UpsertData(ctx context.Context, userID int, name string, kind int, data []byte, meta model.DataMeta, expectedVersion int) (int, error) {
+	var version int
+
+	tx, err := s.p.Begin(ctx)
+	if err != nil {
+		return version, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, version, err = upsertData(ctx, tx, userID, name, kind, data, meta, expectedVersion)
+	if err != nil {
+		return version, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return version, err
+	}
+
+	return version, err
+}
+
+func (s *PGStorage) UpsertFile(ctx context.Context, userID int, name string, kind int, info []byte, meta model.DataMeta, expectedVersion int, next func() ([]byte, error)) (int, error) {
+	// a conflict is reported before the content is read
+	version, err := s.checkVersion(ctx, userID, name, expectedVersion)
+	if err != nil {
+		return version, err
+	}
+
+	staged, err := stageChunks(next)
+	if err != nil {
+		return version, err
+	}
+	defer staged.Close()
+
+	tx, err := s.p.Begin(ctx)
+	if err != nil {
+		return version, err
+	}
+	defer tx.Rollback(ctx)
+
+	// the version is checked again, the record might have changed while the content was read
+	dataID, version, err := upsertData(ctx, tx, userID, name, kind, info, meta, expectedVersion)
+	if err != nil {
+		return version, err
+	}
+
+	for idx := 0; ; idx++ {
+		chunk, err := staged.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return version, err
+		}
+
+		_, err = tx.Exec(ctx, `insert into user_data_chunks (data_id, idx, chunk) values ($1, $2, $3)`, dataID, idx, chunk)
+		if err != nil {
+			return version, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return version, err
+	}
+
+	return version, nil
+}
+
+// checkVersion сверяет текущую версию записи с expectedVersion так же, как upsertData, но без блокировок
+func (s *PGStorage) checkVersion(ctx context.Context, userID int, name string, expectedVersion int) (int, error) {
+	var version int
+
+	if expectedVersion == AnyVersion {
+		return version, nil
+	}
+
+	row := s.p.QueryRow(ctx, `select version from user_data where user_id = $1 and name = $2`, userID, name)
+	if err := row.Scan(&version); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return version, err
+	}
+	if version != expectedVersion {
+		return version, ErrVersionConflict
+	}
+
+	return version, nil
+}
+
+func (s *PGStorage) GetFileChunks(ctx context.Context, dataID int, send func([]byte) error) error {
+	rows, err := s.p.Query(ctx, `select chunk from user_data_chunks where data_id = $1 order by idx`, dataID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var chunk []byte
+
+		if err = rows.Scan(&chunk); err != nil {
+			return err
+		}
+
+		if err = send(chunk); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (s *PGStorage) GetData(ctx context.Context, userID int, name string) (*model.Data, error) {
+	data := &model.Data{UserID: userID, Name: name}
+
+	row := s.p.QueryRow(ctx, `select id, type, data, version, folder, tags, created_timestamp, updated_timestamp
+    from user_data where user_id = $1 and name = $2`, userID, name)
+	if err := row.Scan(&data.ID, &data.Kind, &data.Bytes, &data.Version, &data.Folder, &data.Tags, &data.CreatedAt, &data.UpdatedAt); err != nil {
+		return data, notFound(err)
+	}
+
+	return data, nil
+}
+
+func (s *PGStorage) GetDataVersions(ctx context.Context, userID int, name string) ([]model.DataVersion, error) {
+	res := []model.DataVersion{}
+
+	current := model.DataVersion{Current: true}
+	row := s.p.QueryRow(ctx, `select version, type from user_data where user_id = $1 and name = $2`, userID, name)
+	if err := row.Scan(&current.Version, &current.Kind); err != nil {
+		return res, notFound(err)
+	}
+	res = append(res, current)
+
+	rows, err := s.p.Query(ctx, `select h.version, h.type, h.replaced_timestamp from user_data_history as h
+    join user_data as ud on ud.id = h.data_id
+    where ud.user_id = $1 and ud.name = $2 order by h.version desc`, userID, name)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version model.DataVersion
+
+		err = rows.Scan(&version.Version, &version.Kind, &version.ReplacedAt)
+		if err != nil {
+			return res, err
+		}
+
+		res = append(res, version)
+	}
+
+	if rows.Err() != nil {
+		return res, rows.Err()
+	}
+
+	return res, nil
+}
+
+func (s *PGStorage) GetDataVersion(ctx context.Context, userID int, name string, version int) (*model.Data, error) {
+	data := &model.Data{UserID: userID, Name: name, Version: version}
+
+	row := s.p.QueryRow(ctx, `select id, type, data from user_data where user_id = $1 and name = $2 and version = $3
+    union all
+    select ud.id, h.type, h.data from user_data_history as h
+    join user_data as ud on ud.id = h.data_id
+    where ud.user_id = $1 and ud.name = $2 and h.version = $3`, userID, name, version)
+	if err := row.Scan(&data.ID, &data.Kind, &data.Bytes); err != nil {
+		return data, notFound(err)
+	}
+
+	return data, nil
+}
+
+func (s *PGStorage) RestoreData(ctx context.Context, userID int, name string, version int) (int, error) {
+	var dataID, currentVersion, historyID, kind int
+	var data []byte
+
+	tx, err := s.p.Begin(ctx)
+	if err != nil {
+		return currentVersion, err
+	}
+	defer tx.Rollback(ctx)
+
+	row := tx.QueryRow(ctx, `select id, version from user_data where user_id = $1 and name = $2 for update`, userID, name)
+	if err = row.Scan(&dataID, &currentVersion); err != nil {
+		return currentVersion, notFound(err)
+	}
+
+	if version == currentVersion {
+		return currentVersion, nil
+	}
+
+	row = tx.QueryRow(ctx, `select id, type, data from user_data_history where data_id = $1 and version = $2`, dataID, version)
+	if err = row.Scan(&historyID, &kind, &data); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return currentVersion, ErrNoSuchVersion
+		}
+		return currentVersion, err
+	}
+
+	if err = archiveData(ctx, tx, userID, name); err != nil {
+		return currentVersion, err
+	}
+
+	row = tx.QueryRow(ctx, `update user_data set type = $1, data = $2, version = version + 1, updated_timestamp = current_timestamp
+    where id = $3 returning version`, kind, data, dataID)
+	if err = row.Scan(&currentVersion); err != nil {
+		return currentVersion, err
+	}
+
+	_, err = tx.Exec(ctx, `delete from user_data_chunks where data_id = $1`, dataID)
+	if err != nil {
+		return currentVersion, err
+	}
+
+	_, err = tx.Exec(ctx, `insert into user_data_chunks (data_id, idx, chunk)
+    select $1, idx, chunk from user_data_history_chunks where history_id = $2`, dataID, historyID)
+	if err != nil {
+		return currentVersion, err
+	}
+
+	if err = journalChange(ctx, tx, userID, name); err != nil {
+		return currentVersion, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return currentVersion, err
+	}
+
+	return currentVersion, nil
+}
+
+func (s *PGStorage) DeleteData(ctx context.Context, userID int, name string, expectedVersion int) error {
+	tx, err := s.p.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var version int
+	row := tx.QueryRow(ctx, `select version from user_data where user_id = $1 and name = $2 for update`, userID, name)
+	if err = row.Scan(&version); err != nil {
+		return notFound(err)
+	}
+	if expectedVersion != AnyVersion && version != expectedVersion {
+		return ErrVersionConflict
+	}
+
+	_, err = tx.Exec(ctx, `delete from user_data where user_id = $1 and name = $2`, userID, name)
+	if err != nil {
+		return err
+	}
+
+	if err = journalChange(ctx, tx, userID, name); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *PGStorage) ListData(ctx context.Context, userID int, opts model.ListOptions) ([]model.DataInfo, string, error) {
+	res := []model.DataInfo{}
+
+	sort, err := listSort(opts)
+	if err != nil {
+		return res, "", err
+	}
+
+	query := `select name, type, version, folder, tags, created_timestamp, updated_timestamp
+    from user_data where user_id = $1`
+	args := []any{userID}
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if opts.Prefix != "" {
+		query += ` and name like ` + arg(likePrefix(opts.Prefix)) + ` escape '\'`
+	}
+	if len(opts.Prefixes) > 0 {
+		patterns := make([]string, 0, len(opts.Prefixes))
+		for _, prefix := range opts.Prefixes {
+			patterns = append(patterns, likePrefix(prefix))
+		}
+		// backslash is the default escape character
+		query += ` and name like any(` + arg(patterns) + `)`
+	}
+	if opts.Kind != nil {
+		query += ` and type = ` + arg(*opts.Kind)
+	}
+	if opts.Tag != "" {
+		query += ` and ` + arg(opts.Tag) + ` = any(tags)`
+	}
+
+	if opts.Cursor != "" {
+		cursor, err := parseListCursor(sort, opts.Cursor)
+		if err != nil {
+			return res, "", err
+		}
+
+		switch sort {
+		case model.SortName:
+			query += ` and name collate "C" > ` + arg(cursor.Name)
+		case model.SortFolder:
+			query += ` and (folder collate "C", name collate "C") > (` + arg(cursor.Folder) + `, ` + arg(cursor.Name) + `)`
+		case model.SortCreated, model.SortUpdated:
+			column := sort + `_timestamp`
+			t := arg(cursor.Time)
+			query += ` and (` + column + ` < ` + t + ` or (` + column + ` = ` + t + ` and name collate "C" > ` + arg(cursor.Name) + `))`
+		}
+	}
+
+	// byte order doesn't depend on the database locale, so pages are the same on any server
+	switch sort {
+	case model.SortName:
+		query += ` order by name collate "C"`
+	case model.SortFolder:
+		query += ` order by folder collate "C", name collate "C"`
+	case model.SortCreated, model.SortUpdated:
+		query += ` order by ` + sort + `_timestamp desc, name collate "C"`
+	}
+
+	// one extra row tells whether there is a next page
+	if opts.Limit > 0 {
+		query += ` limit ` + arg(opts.Limit+1)
+	}
+
+	rows, err := s.p.Query(ctx, query, args...)
+	if err != nil {
+		return res, "", err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var info model.DataInfo
+
+		err = rows.Scan(&info.Name, &info.Kind, &info.Version, &info.Folder, &info.Tags, &info.CreatedAt, &info.UpdatedAt)
+		if err != nil {
+			return res, "", err
+		}
+
+		res = append(res, info)
+	}
+
+	if rows.Err() != nil {
+		return res, "", rows.Err()
+	}
+
+	next := ""
+	if opts.Limit > 0 && len(res) > opts.Limit {
+		res = res[:opts.Limit]
+		next = newListCursor(sort, res[len(res)-1])
+	}
+
+	return res, next, nil
+}
+
+// likePrefix экранирует спецсимволы like, чтобы префикс искался буквально
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
+}
+
+func (s *PGStorage) GetDataNames(ctx context.Context, userID int) ([]string, error) {
+	res := []string{}
+
+	rows, err := s.p.Query(ctx, `select name from user_data where user_id = $1 order by name`, userID)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+
+		err = rows.Scan(&name)
+		if err != nil {
+			return res, err
+		}
+
+		res = append(res, name)
+	}
+
+	if rows.Err() != nil {
+		return res, rows.Err()
+	}
+
+	return res, nil
+}
+
+func (s *PGStorage) GetChanges(ctx context.Context, userID int, since int64, limit int, maxBytes int) (*model.ChangeSet, error) {
+	set := &model.ChangeSet{Changes: []model.Change{}}
+
+	// every change up to the committed user revision is committed too, later ones go to the next sync
+	row := s.p.QueryRow(ctx, `select sync_revision from users where id = $1`, userID)
+	if err := row.Scan(&set.Revision); err != nil {
+		return set, notFound(err)
+	}
+
+	// a deleted record has a journal entry but no row in user_data
+	rows, err := s.p.Query(ctx, `select c.name, c.revision, d.name is null, coalesce(d.type, 0), d.data,
+    coalesce(d.version, 0), coalesce(d.folder, ''), coalesce(d.tags, '{}'),
+    coalesce(d.created_timestamp, 'epoch'), coalesce(d.updated_timestamp, 'epoch')
+    from user_data_changes as c
+    left join user_data as d on d.user_id = c.user_id and d.name = c.name
+    where c.user_id = $1 and c.revision > $2 and c.revision <= $3
+    order by c.revision limit $4`, userID, since, set.Revision, limit+1)
+	if err != nil {
+		return set, err
+	}
+	defer rows.Close()
+
+	page := newChangesPage(set, limit, maxBytes)
+	for rows.Next() {
+		var change model.Change
+
+		err = rows.Scan(&change.Name, &change.Revision, &change.Deleted, &change.Kind, &change.Bytes,
+			&change.Version, &change.Folder, &change.Tags, &change.CreatedAt, &change.UpdatedAt)
+		if err != nil {
+			return set, err
+		}
+
+		if !page.add(change) {
+			break
+		}
+	}
+
+	if rows.Err() != nil {
+		return set, rows.Err()
+	}
+
+	if set.Revision < since {
+		set.Revision = since
+	}
+
+	return set, nil
+}
+
+func (s *PGStorage) RunExclusive(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error) {
+	// session level lock is held by this connection, so fn may use the pool freely
+	conn, err := s.p.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Release()
+
+	var locked bool
+	row := conn.QueryRow(ctx, `select pg_try_advisory_lock($1, hashtext($2))`, advisoryLockSpace, name)
+	if err = row.Scan(&locked); err != nil {
+		return false, err
+	}
+	if !locked {
+		return false, nil
+	}
+
+	fnErr := fn(ctx)
+
+	// ctx may be already canceled, the lock must be released anyway
+	if _, err = conn.Exec(context.Background(), `select pg_advisory_unlock($1, hashtext($2))`, advisoryLockSpace, name); err != nil {
+		// a connection with a dangling lock must not go back to the pool
+		conn.Conn().Close(context.Background())
+		if fnErr == nil {
+			fnErr = err
+		}
+	}
+
+	return true, fnErr
+}
@@ -0,0 +1,1337 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"github.com/smakimka/pam/internal/server/model"
+)
+
+// sqliteLockLease через сколько блокировка RunExclusive считается брошенной, если сервер упал, не сняв ее
+const sqliteLockLease = time.Hour
+
+// SQLiteStorage хранилище в файле SQLite для небольших установок, где отдельный Postgres не нужен.
+// Ведет себя так же, как PGStorage, в том числе возвращает ErrNotFound, когда строки нет
+type SQLiteStorage struct {
+	db *sql.DB
+	// owner отличает блокировки этого экземпляра сервера в job_locks от чужих
+	owner string
+}
+
+// OpenSQLite открывает базу по адресу вида sqlite:///абсолютный/путь или sqlite:относительный/путь
+func OpenSQLite(url string) (*sql.DB, error) {
+	path, ok := strings.CutPrefix(url, "sqlite:")
+	if !ok {
+		return nil, fmt.Errorf("not a sqlite url: %q", url)
+	}
+	path = strings.TrimPrefix(path, "//")
+
+	// - foreign keys are off by default in sqlite, user_data children rely on cascades
+	// - like must be case sensitive as in postgres
+	// - writing transactions take the lock at begin, otherwise two of them deadlock upgrading their locks
+	// - times are stored in one format, so they compare as text in utc
+	params := "_pragma=foreign_keys(1)&_pragma=case_sensitive_like(1)&_pragma=busy_timeout(10000)" +
+		"&_pragma=journal_mode(wal)&_txlock=immediate&_time_format=sqlite"
+
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+
+	return sql.Open("sqlite", "file:"+path+sep+params)
+}
+
+func NewSQLiteStorage(db *sql.DB) (*SQLiteStorage, error) {
+	s := &SQLiteStorage{
+		db:    db,
+		owner: uuid.New().String(),
+	}
+
+	err := s.db.Ping()
+	if err != nil {
+		return s, err
+	}
+
+	return s, nil
+}
+
+// sqliteNow текущее время в том виде, в котором SQLiteStorage хранит время
+func sqliteNow() time.Time {
+	return time.Now().UTC()
+}
+
+// noRows заменяет sql.ErrNoRows на ErrNotFound
+func noRows(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+// stringList список строк, например, тегов, в SQLite хранится как JSON массив
+type stringList []string
+
+func (l stringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+
+	data, err := json.Marshal([]string(l))
+	if err != nil {
+		return nil, err
+	}
+
+	return string(data), nil
+}
+
+func (l *stringList) Scan(src any) error {
+	*l = stringList{}
+
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(src), l)
+	case []byte:
+		return json.Unmarshal(src, l)
+	default:
+		return fmt.Errorf("can't scan %T into a string list", src)
+	}
+}
+
+// Init применяет новые миграции схемы
+func (s *SQLiteStorage) Init(ctx context.Context) error {
+	_, err := s.Migrate(ctx)
+	return err
+}
+
+// sqliteQuerier база или транзакция
+type sqliteQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// sqliteAppliedMigrations возвращает строки schema_version по порядку версий, пока ни одна миграция
+// не применена, таблицы может не быть
+func sqliteAppliedMigrations(ctx context.Context, q sqliteQuerier) ([]Migration, error) {
+	applied := []Migration{}
+
+	var exists bool
+	row := q.QueryRowContext(ctx, `select count(*) > 0 from sqlite_master where type = 'table' and name = 'schema_version'`)
+	if err := row.Scan(&exists); err != nil {
+		return applied, err
+	}
+	if !exists {
+		return applied, nil
+	}
+
+	rows, err := q.QueryContext(ctx, `select version, name, applied_timestamp from schema_version order by version`)
+	if err != nil {
+		return applied, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m Migration
+
+		if err = rows.Scan(&m.Version, &m.Name, &m.AppliedAt); err != nil {
+			return applied, err
+		}
+
+		applied = append(applied, m)
+	}
+
+	if rows.Err() != nil {
+		return applied, rows.Err()
+	}
+
+	return applied, nil
+}
+
+func (s *SQLiteStorage) Migrations(ctx context.Context) ([]Migration, error) {
+	known, err := loadMigrations("sqlite")
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := sqliteAppliedMigrations(ctx, s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeMigrations(known, applied), nil
+}
+
+func (s *SQLiteStorage) Migrate(ctx context.Context) (int, error) {
+	known, err := loadMigrations("sqlite")
+	if err != nil {
+		return 0, err
+	}
+
+	// the write lock taken at begin is the migrations lock, servers sharing the file apply them one after
+	// another, and the later ones find nothing to apply
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, createSchemaVersion); err != nil {
+		return 0, err
+	}
+
+	applied, err := sqliteAppliedMigrations(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	pending, err := pendingMigrations(known, applied)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, m := range pending {
+		if _, err = tx.ExecContext(ctx, m.sql); err != nil {
+			return 0, fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+		}
+
+		_, err = tx.ExecContext(ctx, `insert into schema_version (version, name, applied_timestamp) values ($1, $2, $3)`,
+			m.Version, m.Name, sqliteNow())
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	for _, m := range pending {
+		log.Info().Msgf("applied migration %d_%s", m.Version, m.Name)
+	}
+
+	return len(pending), nil
+}
+
+func (s *SQLiteStorage) GetUser(ctx context.Context, username string) (*model.UserData, error) {
+	user := &model.UserData{}
+
+	row := s.db.QueryRowContext(ctx, `select id, username, pwd from users where username = $1`, username)
+	if err := row.Scan(&user.ID, &user.Username, &user.Pwd); err != nil {
+		return user, noRows(err)
+	}
+
+	return user, nil
+}
+
+func (s *SQLiteStorage) GetUserByID(ctx context.Context, userID int) (*model.UserData, error) {
+	user := &model.UserData{}
+
+	row := s.db.QueryRowContext(ctx, `select id, username, pwd from users where id = $1`, userID)
+	if err := row.Scan(&user.ID, &user.Username, &user.Pwd); err != nil {
+		return user, noRows(err)
+	}
+
+	return user, nil
+}
+
+func (s *SQLiteStorage) CreateUser(ctx context.Context, username string, pwd []byte) (int, error) {
+	var newUserID int
+
+	row := s.db.QueryRowContext(ctx, `insert into users (username, pwd) values ($1, $2) returning id`, username, pwd)
+	if err := row.Scan(&newUserID); err != nil {
+		var sqliteErr *sqlite.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+			return newUserID, ErrUserExists
+		}
+		return newUserID, err
+	}
+
+	return newUserID, nil
+}
+
+func (s *SQLiteStorage) GetVaultParams(ctx context.Context, userID int) ([]byte, error) {
+	var params []byte
+
+	row := s.db.QueryRowContext(ctx, `select vault_params from users where id = $1`, userID)
+	if err := row.Scan(&params); err != nil {
+		return params, noRows(err)
+	}
+
+	return params, nil
+}
+
+func (s *SQLiteStorage) SetVaultParams(ctx context.Context, userID int, params []byte) error {
+	res, err := s.db.ExecContext(ctx, `update users set vault_params = $1 where id = $2 and vault_params is null`, params, userID)
+	if err != nil {
+		return err
+	}
+
+	return affectedOr(res, ErrVaultParamsExist)
+}
+
+func (s *SQLiteStorage) GetTwoFactor(ctx context.Context, userID int) (*model.TwoFactor, error) {
+	tf := &model.TwoFactor{}
+
+	row := s.db.QueryRowContext(ctx, `select coalesce(totp_secret, ''), totp_enabled from users where id = $1`, userID)
+	if err := row.Scan(&tf.Secret, &tf.Enabled); err != nil {
+		return tf, noRows(err)
+	}
+
+	return tf, nil
+}
+
+func (s *SQLiteStorage) SetTwoFactorSecret(ctx context.Context, userID int, secret string) error {
+	res, err := s.db.ExecContext(ctx, `update users set totp_secret = $1 where id = $2 and not totp_enabled`, secret, userID)
+	if err != nil {
+		return err
+	}
+
+	return affectedOr(res, ErrTwoFactorEnabled)
+}
+
+func (s *SQLiteStorage) EnableTwoFactor(ctx context.Context, userID int, counter int64, recoveryCodes [][]byte) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `update users set totp_enabled = true, totp_last_counter = $1
+    where id = $2 and not totp_enabled and totp_secret is not null`, counter, userID)
+	if err != nil {
+		return err
+	}
+	if err = affectedOr(res, ErrTwoFactorEnabled); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from recovery_codes where user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, code := range recoveryCodes {
+		_, err = tx.ExecContext(ctx, `insert into recovery_codes (user_id, code_hash) values ($1, $2)`, userID, code)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *SQLiteStorage) DisableTwoFactor(ctx context.Context, userID int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `update users set totp_secret = null, totp_enabled = false, totp_last_counter = 0
+    where id = $1 and totp_enabled`, userID)
+	if err != nil {
+		return err
+	}
+	if err = affectedOr(res, ErrTwoFactorDisabled); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from recovery_codes where user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *SQLiteStorage) ReplaceRecoveryCodes(ctx context.Context, userID int, recoveryCodes [][]byte) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// a no-op update takes the write lock before the check, so 2FA can't be disabled in between
+	res, err := tx.ExecContext(ctx, `update users set totp_enabled = totp_enabled where id = $1 and totp_enabled`, userID)
+	if err != nil {
+		return err
+	}
+	if err = affectedOr(res, ErrTwoFactorDisabled); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from recovery_codes where user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, code := range recoveryCodes {
+		_, err = tx.ExecContext(ctx, `insert into recovery_codes (user_id, code_hash) values ($1, $2)`, userID, code)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *SQLiteStorage) UseTOTPCounter(ctx context.Context, userID int, counter int64) error {
+	res, err := s.db.ExecContext(ctx, `update users set totp_last_counter = $1 where id = $2 and totp_last_counter < $1`, counter, userID)
+	if err != nil {
+		return err
+	}
+
+	return affectedOr(res, ErrCodeReused)
+}
+
+func (s *SQLiteStorage) UseRecoveryCode(ctx context.Context, userID int, codeHash []byte, now time.Time) error {
+	res, err := s.db.ExecContext(ctx, `update recovery_codes set used_timestamp = $1
+    where user_id = $2 and code_hash = $3 and used_timestamp is null`, now.UTC(), userID, codeHash)
+	if err != nil {
+		return err
+	}
+
+	return affectedOr(res, ErrNotFound)
+}
+
+func (s *SQLiteStorage) GetLoginLock(ctx context.Context, key string) (time.Time, error) {
+	var lockedUntil *time.Time
+
+	row := s.db.QueryRowContext(ctx, `select locked_until_timestamp from login_attempts where key = $1`, key)
+	if err := row.Scan(&lockedUntil); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, nil
+		}
+
+		return time.Time{}, err
+	}
+
+	if lockedUntil == nil {
+		return time.Time{}, nil
+	}
+	return *lockedUntil, nil
+}
+
+func (s *SQLiteStorage) AddLoginFailure(ctx context.Context, key string, now time.Time, window time.Duration) (int, error) {
+	var failures int
+
+	row := s.db.QueryRowContext(ctx, `insert into login_attempts (key, failures, last_failure_timestamp) values ($1, 1, $2)
+    on conflict (key) do update set
+        failures = case when login_attempts.last_failure_timestamp < $3 then 1 else login_attempts.failures + 1 end,
+        last_failure_timestamp = excluded.last_failure_timestamp
+    returning failures`, key, now.UTC(), now.Add(-window).UTC())
+	if err := row.Scan(&failures); err != nil {
+		return 0, err
+	}
+
+	return failures, nil
+}
+
+func (s *SQLiteStorage) LockLogin(ctx context.Context, key string, until time.Time) error {
+	_, err := s.db.ExecContext(ctx, `update login_attempts set locked_until_timestamp = $1 where key = $2`, until.UTC(), key)
+	return err
+}
+
+func (s *SQLiteStorage) ResetLoginFailures(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `delete from login_attempts where key = $1`, key)
+	return err
+}
+
+func (s *SQLiteStorage) DeleteStaleLoginAttempts(ctx context.Context, before time.Time, now time.Time) (int, error) {
+	res, err := s.db.ExecContext(ctx, `delete from login_attempts
+    where (last_failure_timestamp is null or last_failure_timestamp < $1)
+    and (locked_until_timestamp is null or locked_until_timestamp < $2)`, before.UTC(), now.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return rowsAffected(res)
+}
+
+func (s *SQLiteStorage) GetUserByToken(ctx context.Context, token string, now time.Time) (*model.UserData, error) {
+	userData := &model.UserData{}
+
+	var apiToken bool
+	scope := &model.TokenScope{}
+
+	row := s.db.QueryRowContext(ctx, `select u.id, u.username, a.api_token, a.scope_write, a.scope_prefixes from users as u
+    join auths as a on a.user_id = u.id
+    where a.token = $1 and (a.expiry_timestamp is null or a.expiry_timestamp >= $2) and a.revoked_timestamp is null`, token, now.UTC())
+	if err := row.Scan(&userData.ID, &userData.Username, &apiToken, &scope.Write, (*stringList)(&scope.Prefixes)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Info().Msg("no active token found")
+			return userData, ErrNoActiveToken
+		}
+
+		return userData, err
+	}
+
+	if apiToken {
+		userData.Scope = scope
+	}
+
+	return userData, nil
+}
+
+func (s *SQLiteStorage) CreateAuthToken(ctx context.Context, userID int, value string, expiry time.Time) (int, error) {
+	var newTokenID int
+
+	row := s.db.QueryRowContext(ctx, `insert into auths (user_id, token, creation_timestamp, expiry_timestamp, token_hashed)
+    values ($1, $2, $3, $4, true) returning id`, userID, value, sqliteNow(), expiry.UTC())
+	if err := row.Scan(&newTokenID); err != nil {
+		return newTokenID, err
+	}
+
+	return newTokenID, nil
+}
+
+func (s *SQLiteStorage) CreateApiToken(ctx context.Context, userID int, value string, token model.ApiToken) (int, error) {
+	var newTokenID int
+
+	var expiry *time.Time
+	if !token.ExpiresAt.IsZero() {
+		utc := token.ExpiresAt.UTC()
+		expiry = &utc
+	}
+
+	row := s.db.QueryRowContext(ctx, `insert into auths
+    (user_id, token, creation_timestamp, expiry_timestamp, token_hashed, api_token, scope_write, scope_prefixes, description)
+    values ($1, $2, $3, $4, true, true, $5, $6, $7) returning id`,
+		userID, value, sqliteNow(), expiry, token.Write, stringList(token.Prefixes), token.Description)
+	if err := row.Scan(&newTokenID); err != nil {
+		return newTokenID, err
+	}
+
+	return newTokenID, nil
+}
+
+func (s *SQLiteStorage) ListApiTokens(ctx context.Context, userID int, now time.Time) ([]model.ApiToken, error) {
+	res := []model.ApiToken{}
+
+	rows, err := s.db.QueryContext(ctx, `select id, description, scope_write, scope_prefixes, creation_timestamp,
+    expiry_timestamp, last_used_timestamp
+    from auths where user_id = $1 and api_token and (expiry_timestamp is null or expiry_timestamp >= $2)
+    and revoked_timestamp is null
+    order by id`, userID, now.UTC())
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var token model.ApiToken
+		var expiresAt, usedAt *time.Time
+
+		err = rows.Scan(&token.ID, &token.Description, &token.Write, (*stringList)(&token.Prefixes), &token.CreatedAt,
+			&expiresAt, &usedAt)
+		if err != nil {
+			return res, err
+		}
+
+		if expiresAt != nil {
+			token.ExpiresAt = *expiresAt
+		}
+		if usedAt != nil {
+			token.UsedAt = *usedAt
+		}
+
+		res = append(res, token)
+	}
+
+	if rows.Err() != nil {
+		return res, rows.Err()
+	}
+
+	return res, nil
+}
+
+func (s *SQLiteStorage) DeleteExpiredTokens(ctx context.Context, now time.Time) (int, error) {
+	res, err := s.db.ExecContext(ctx, `delete from auths where expiry_timestamp < $1 or revoked_timestamp is not null`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return rowsAffected(res)
+}
+
+func (s *SQLiteStorage) MigrateTokens(ctx context.Context, hash func(token string) string) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `select id, token from auths where not token_hashed`)
+	if err != nil {
+		return 0, err
+	}
+
+	plain := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var token string
+		if err = rows.Scan(&id, &token); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		plain[id] = token
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for id, token := range plain {
+		_, err = tx.ExecContext(ctx, `update auths set token = $1, token_hashed = true where id = $2`, hash(token), id)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(plain), nil
+}
+
+func (s *SQLiteStorage) UpdateTokenExpiry(ctx context.Context, token string, newExpiry time.Time) error {
+	_, err := s.db.ExecContext(ctx, `update auths set expiry_timestamp = $1 where token = $2 and not api_token`, newExpiry.UTC(), token)
+	return err
+}
+
+func (s *SQLiteStorage) DeleteUser(ctx context.Context, userID int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// chunks and history go away with user_data by cascade
+	for _, query := range []string{
+		`delete from user_data where user_id = $1`,
+		`delete from user_data_changes where user_id = $1`,
+		`delete from recovery_codes where user_id = $1`,
+		`delete from auths where user_id = $1`,
+	} {
+		if _, err = tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, `delete from users where id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	if err = affectedOr(res, ErrNotFound); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *SQLiteStorage) UpdatePassword(ctx context.Context, userID int, pwd []byte, keepToken string, now time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `update users set pwd = $1 where id = $2`, pwd, userID)
+	if err != nil {
+		return err
+	}
+	if err = affectedOr(res, ErrNotFound); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `update auths set revoked_timestamp = $1
+    where user_id = $2 and token <> $3 and revoked_timestamp is null`, now.UTC(), userID, keepToken)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *SQLiteStorage) RevokeToken(ctx context.Context, userID int, token string, now time.Time) error {
+	res, err := s.db.ExecContext(ctx, `update auths set revoked_timestamp = $1
+    where user_id = $2 and token = $3 and (expiry_timestamp is null or expiry_timestamp >= $1)
+    and revoked_timestamp is null`, now.UTC(), userID, token)
+	if err != nil {
+		return err
+	}
+
+	return affectedOr(res, ErrNotFound)
+}
+
+func (s *SQLiteStorage) RevokeSession(ctx context.Context, userID int, sessionID int, now time.Time) error {
+	res, err := s.db.ExecContext(ctx, `update auths set revoked_timestamp = $1
+    where user_id = $2 and id = $3 and (expiry_timestamp is null or expiry_timestamp >= $1)
+    and revoked_timestamp is null`, now.UTC(), userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	return affectedOr(res, ErrNotFound)
+}
+
+func (s *SQLiteStorage) UpdateTokenUsage(ctx context.Context, token string, usage model.TokenUsage) error {
+	_, err := s.db.ExecContext(ctx, `update auths set last_used_timestamp = $1, client_ip = $2, user_agent = $3 where token = $4`,
+		usage.UsedAt.UTC(), usage.IP, usage.UserAgent, token)
+
+	return err
+}
+
+func (s *SQLiteStorage) ListSessions(ctx context.Context, userID int, now time.Time) ([]model.Session, error) {
+	res := []model.Session{}
+
+	rows, err := s.db.QueryContext(ctx, `select id, token, creation_timestamp, expiry_timestamp,
+    last_used_timestamp, client_ip, user_agent
+    from auths where user_id = $1 and not api_token and expiry_timestamp >= $2 and revoked_timestamp is null
+    order by coalesce(last_used_timestamp, creation_timestamp) desc, id desc`, userID, now.UTC())
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var session model.Session
+		var usedAt *time.Time
+
+		err = rows.Scan(&session.ID, &session.Token, &session.CreatedAt, &session.ExpiresAt,
+			&usedAt, &session.IP, &session.UserAgent)
+		if err != nil {
+			return res, err
+		}
+
+		// coalesce in the query would lose the column type, so the driver couldn't parse the time
+		session.UsedAt = session.CreatedAt
+		if usedAt != nil {
+			session.UsedAt = *usedAt
+		}
+
+		res = append(res, session)
+	}
+
+	if rows.Err() != nil {
+		return res, rows.Err()
+	}
+
+	return res, nil
+}
+
+// archiveSQLiteData переносит текущую версию записи вместе с чанками в историю
+func archiveSQLiteData(ctx context.Context, tx *sql.Tx, userID int, name string, now time.Time) error {
+	var historyID, dataID int
+
+	row := tx.QueryRowContext(ctx, `insert into user_data_history (data_id, version, type, data, replaced_timestamp)
+    select id, version, type, data, $3 from user_data where user_id = $1 and name = $2
+    returning id, data_id`, userID, name, now)
+	if err := row.Scan(&historyID, &dataID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, `insert into user_data_history_chunks (history_id, idx, chunk)
+    select $1, idx, chunk from user_data_chunks where data_id = $2`, historyID, dataID)
+
+	return err
+}
+
+// journalSQLiteChange записывает в журнал изменений, что запись изменилась или была удалена.
+// Транзакции записи в SQLite идут по одной, поэтому изменения фиксируются в порядке ревизий
+func journalSQLiteChange(ctx context.Context, tx *sql.Tx, userID int, name string) error {
+	var revision int64
+
+	row := tx.QueryRowContext(ctx, `update users set sync_revision = sync_revision + 1 where id = $1 returning sync_revision`, userID)
+	if err := row.Scan(&revision); err != nil {
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, `insert into user_data_changes (user_id, name, revision) values ($1, $2, $3)
+    on conflict (user_id, name) do update set revision = excluded.revision`, userID, name, revision)
+
+	return err
+}
+
+// upsertSQLiteData сохраняет новую версию записи, предыдущая версия остается в истории.
+// Возвращает id записи и номер новой версии
+func upsertSQLiteData(ctx context.Context, tx *sql.Tx, userID int, name string, kind int, data []byte, meta model.DataMeta, expectedVersion int) (int, int, error) {
+	var dataID, version int
+	now := sqliteNow()
+
+	switch {
+	case expectedVersion == 0:
+		row := tx.QueryRowContext(ctx, `insert into user_data (user_id, name, type, data, folder, tags, created_timestamp, updated_timestamp)
+        values ($1, $2, $3, $4, $5, $6, $7, $7) on conflict (user_id, name) do nothing
+        returning id, version`, userID, name, kind, data, meta.Folder, stringList(meta.Tags), now)
+		if err := row.Scan(&dataID, &version); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return dataID, version, ErrVersionConflict
+			}
+			return dataID, version, err
+		}
+
+		if err := journalSQLiteChange(ctx, tx, userID, name); err != nil {
+			return dataID, version, err
+		}
+
+		return dataID, version, nil
+	case expectedVersion != AnyVersion:
+		row := tx.QueryRowContext(ctx, `select version from user_data where user_id = $1 and name = $2`, userID, name)
+		if err := row.Scan(&version); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return dataID, version, err
+		}
+
+		if version != expectedVersion {
+			return dataID, version, ErrVersionConflict
+		}
+	}
+
+	if err := archiveSQLiteData(ctx, tx, userID, name, now); err != nil {
+		return dataID, version, err
+	}
+
+	row := tx.QueryRowContext(ctx, `insert into user_data (user_id, name, type, data, folder, tags, created_timestamp, updated_timestamp)
+    values ($1, $2, $3, $4, $5, $6, $7, $7) on conflict (user_id, name) do
+    update set type = excluded.type, data = excluded.data, folder = excluded.folder, tags = excluded.tags,
+        version = user_data.version + 1, updated_timestamp = excluded.updated_timestamp
+    returning id, version`, userID, name, kind, data, meta.Folder, stringList(meta.Tags), now)
+	if err := row.Scan(&dataID, &version); err != nil {
+		return dataID, version, err
+	}
+
+	// the record might have been a file before
+	_, err := tx.ExecContext(ctx, `delete from user_data_chunks where data_id = $1`, dataID)
+	if err != nil {
+		return dataID, version, err
+	}
+
+	if err = journalSQLiteChange(ctx, tx, userID, name); err != nil {
+		return dataID, version, err
+	}
+
+	return dataID, version, nil
+}
+
+func (s *SQLiteStorage) UpsertData(ctx context.Context, userID int, name string, kind int, data []byte, meta model.DataMeta, expectedVersion int) (int, error) {
+	var version int
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return version, err
+	}
+	defer tx.Rollback()
+
+	_, version, err = upsertSQLiteData(ctx, tx, userID, name, kind, data, meta, expectedVersion)
+	if err != nil {
+		return version, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return version, err
+	}
+
+	return version, nil
+}
+
+func (s *SQLiteStorage) UpsertFile(ctx context.Context, userID int, name string, kind int, info []byte, meta model.DataMeta, expectedVersion int, next func() ([]byte, error)) (int, error) {
+	// a conflict is reported before the content is read
+	version, err := s.checkVersion(ctx, userID, name, expectedVersion)
+	if err != nil {
+		return version, err
+	}
+
+	staged, err := stageChunks(next)
+	if err != nil {
+		return version, err
+	}
+	defer staged.Close()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return version, err
+	}
+	defer tx.Rollback()
+
+	// the version is checked again, the record might have changed while the content was read
+	dataID, version, err := upsertSQLiteData(ctx, tx, userID, name, kind, info, meta, expectedVersion)
+	if err != nil {
+		return version, err
+	}
+
+	for idx := 0; ; idx++ {
+		chunk, err := staged.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return version, err
+		}
+
+		_, err = tx.ExecContext(ctx, `insert into user_data_chunks (data_id, idx, chunk) values ($1, $2, $3)`, dataID, idx, chunk)
+		if err != nil {
+			return version, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return version, err
+	}
+
+	return version, nil
+}
+
+// checkVersion сверяет текущую версию записи с expectedVersion так же, как upsertSQLiteData, но без блокировок
+func (s *SQLiteStorage) checkVersion(ctx context.Context, userID int, name string, expectedVersion int) (int, error) {
+	var version int
+
+	if expectedVersion == AnyVersion {
+		return version, nil
+	}
+
+	row := s.db.QueryRowContext(ctx, `select version from user_data where user_id = $1 and name = $2`, userID, name)
+	if err := row.Scan(&version); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return version, err
+	}
+	if version != expectedVersion {
+		return version, ErrVersionConflict
+	}
+
+	return version, nil
+}
+
+func (s *SQLiteStorage) GetFileChunks(ctx context.Context, dataID int, send func([]byte) error) error {
+	rows, err := s.db.QueryContext(ctx, `select chunk from user_data_chunks where data_id = $1 order by idx`, dataID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var chunk []byte
+
+		if err = rows.Scan(&chunk); err != nil {
+			return err
+		}
+
+		if err = send(chunk); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (s *SQLiteStorage) GetData(ctx context.Context, userID int, name string) (*model.Data, error) {
+	data := &model.Data{UserID: userID, Name: name}
+
+	row := s.db.QueryRowContext(ctx, `select id, type, data, version, folder, tags, created_timestamp, updated_timestamp
+    from user_data where user_id = $1 and name = $2`, userID, name)
+	if err := row.Scan(&data.ID, &data.Kind, &data.Bytes, &data.Version, &data.Folder, (*stringList)(&data.Tags), &data.CreatedAt, &data.UpdatedAt); err != nil {
+		return data, noRows(err)
+	}
+
+	return data, nil
+}
+
+func (s *SQLiteStorage) GetDataVersions(ctx context.Context, userID int, name string) ([]model.DataVersion, error) {
+	res := []model.DataVersion{}
+
+	current := model.DataVersion{Current: true}
+	row := s.db.QueryRowContext(ctx, `select version, type from user_data where user_id = $1 and name = $2`, userID, name)
+	if err := row.Scan(&current.Version, &current.Kind); err != nil {
+		return res, noRows(err)
+	}
+	res = append(res, current)
+
+	rows, err := s.db.QueryContext(ctx, `select h.version, h.type, h.replaced_timestamp from user_data_history as h
+    join user_data as ud on ud.id = h.data_id
+    where ud.user_id = $1 and ud.name = $2 order by h.version desc`, userID, name)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version model.DataVersion
+
+		err = rows.Scan(&version.Version, &version.Kind, &version.ReplacedAt)
+		if err != nil {
+			return res, err
+		}
+
+		res = append(res, version)
+	}
+
+	if rows.Err() != nil {
+		return res, rows.Err()
+	}
+
+	return res, nil
+}
+
+func (s *SQLiteStorage) GetDataVersion(ctx context.Context, userID int, name string, version int) (*model.Data, error) {
+	data := &model.Data{UserID: userID, Name: name, Version: version}
+
+	row := s.db.QueryRowContext(ctx, `select id, type, data from user_data where user_id = $1 and name = $2 and version = $3
+    union all
+    select ud.id, h.type, h.data from user_data_history as h
+    join user_data as ud on ud.id = h.data_id
+    where ud.user_id = $1 and ud.name = $2 and h.version = $3`, userID, name, version)
+	if err := row.Scan(&data.ID, &data.Kind, &data.Bytes); err != nil {
+		return data, noRows(err)
+	}
+
+	return data, nil
+}
+
+func (s *SQLiteStorage) RestoreData(ctx context.Context, userID int, name string, version int) (int, error) {
+	var dataID, currentVersion, historyID, kind int
+	var data []byte
+	now := sqliteNow()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return currentVersion, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, `select id, version from user_data where user_id = $1 and name = $2`, userID, name)
+	if err = row.Scan(&dataID, &currentVersion); err != nil {
+		return currentVersion, noRows(err)
+	}
+
+	if version == currentVersion {
+		return currentVersion, nil
+	}
+
+	row = tx.QueryRowContext(ctx, `select id, type, data from user_data_history where data_id = $1 and version = $2`, dataID, version)
+	if err = row.Scan(&historyID, &kind, &data); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return currentVersion, ErrNoSuchVersion
+		}
+		return currentVersion, err
+	}
+
+	if err = archiveSQLiteData(ctx, tx, userID, name, now); err != nil {
+		return currentVersion, err
+	}
+
+	row = tx.QueryRowContext(ctx, `update user_data set type = $1, data = $2, version = version + 1, updated_timestamp = $3
+    where id = $4 returning version`, kind, data, now, dataID)
+	if err = row.Scan(&currentVersion); err != nil {
+		return currentVersion, err
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from user_data_chunks where data_id = $1`, dataID)
+	if err != nil {
+		return currentVersion, err
+	}
+
+	_, err = tx.ExecContext(ctx, `insert into user_data_chunks (data_id, idx, chunk)
+    select $1, idx, chunk from user_data_history_chunks where history_id = $2`, dataID, historyID)
+	if err != nil {
+		return currentVersion, err
+	}
+
+	if err = journalSQLiteChange(ctx, tx, userID, name); err != nil {
+		return currentVersion, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return currentVersion, err
+	}
+
+	return currentVersion, nil
+}
+
+func (s *SQLiteStorage) DeleteData(ctx context.Context, userID int, name string, expectedVersion int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var version int
+	row := tx.QueryRowContext(ctx, `select version from user_data where user_id = $1 and name = $2`, userID, name)
+	if err = row.Scan(&version); err != nil {
+		return noRows(err)
+	}
+	if expectedVersion != AnyVersion && version != expectedVersion {
+		return ErrVersionConflict
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from user_data where user_id = $1 and name = $2`, userID, name)
+	if err != nil {
+		return err
+	}
+
+	if err = journalSQLiteChange(ctx, tx, userID, name); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *SQLiteStorage) ListData(ctx context.Context, userID int, opts model.ListOptions) ([]model.DataInfo, string, error) {
+	res := []model.DataInfo{}
+
+	sort, err := listSort(opts)
+	if err != nil {
+		return res, "", err
+	}
+
+	query := `select name, type, version, folder, tags, created_timestamp, updated_timestamp
+    from user_data where user_id = $1`
+	args := []any{userID}
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if opts.Prefix != "" {
+		query += ` and name like ` + arg(likePrefix(opts.Prefix)) + ` escape '\'`
+	}
+	if len(opts.Prefixes) > 0 {
+		patterns := make([]string, 0, len(opts.Prefixes))
+		for _, prefix := range opts.Prefixes {
+			patterns = append(patterns, `name like `+arg(likePrefix(prefix))+` escape '\'`)
+		}
+		query += ` and (` + strings.Join(patterns, ` or `) + `)`
+	}
+	if opts.Kind != nil {
+		query += ` and type = ` + arg(*opts.Kind)
+	}
+	if opts.Tag != "" {
+		query += ` and exists (select 1 from json_each(tags) where value = ` + arg(opts.Tag) + `)`
+	}
+
+	// the default binary collation compares bytes, as collate "C" does in postgres
+	if opts.Cursor != "" {
+		cursor, err := parseListCursor(sort, opts.Cursor)
+		if err != nil {
+			return res, "", err
+		}
+
+		switch sort {
+		case model.SortName:
+			query += ` and name > ` + arg(cursor.Name)
+		case model.SortFolder:
+			query += ` and (folder, name) > (` + arg(cursor.Folder) + `, ` + arg(cursor.Name) + `)`
+		case model.SortCreated, model.SortUpdated:
+			column := sort + `_timestamp`
+			t := arg(cursor.Time.UTC())
+			query += ` and (` + column + ` < ` + t + ` or (` + column + ` = ` + t + ` and name > ` + arg(cursor.Name) + `))`
+		}
+	}
+
+	switch sort {
+	case model.SortName:
+		query += ` order by name`
+	case model.SortFolder:
+		query += ` order by folder, name`
+	case model.SortCreated, model.SortUpdated:
+		query += ` order by ` + sort + `_timestamp desc, name`
+	}
+
+	// one extra row tells whether there is a next page
+	if opts.Limit > 0 {
+		query += ` limit ` + arg(opts.Limit+1)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return res, "", err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var info model.DataInfo
+
+		err = rows.Scan(&info.Name, &info.Kind, &info.Version, &info.Folder, (*stringList)(&info.Tags), &info.CreatedAt, &info.UpdatedAt)
+		if err != nil {
+			return res, "", err
+		}
+
+		res = append(res, info)
+	}
+
+	if rows.Err() != nil {
+		return res, "", rows.Err()
+	}
+
+	next := ""
+	if opts.Limit > 0 && len(res) > opts.Limit {
+		res = res[:opts.Limit]
+		next = newListCursor(sort, res[len(res)-1])
+	}
+
+	return res, next, nil
+}
+
+func (s *SQLiteStorage) GetDataNames(ctx context.Context, userID int) ([]string, error) {
+	res := []string{}
+
+	rows, err := s.db.QueryContext(ctx, `select name from user_data where user_id = $1 order by name`, userID)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+
+		err = rows.Scan(&name)
+		if err != nil {
+			return res, err
+		}
+
+		res = append(res, name)
+	}
+
+	if rows.Err() != nil {
+		return res, rows.Err()
+	}
+
+	return res, nil
+}
+
+func (s *SQLiteStorage) GetChanges(ctx context.Context, userID int, since int64, limit int, maxBytes int) (*model.ChangeSet, error) {
+	set := &model.ChangeSet{Changes: []model.Change{}}
+
+	row := s.db.QueryRowContext(ctx, `select sync_revision from users where id = $1`, userID)
+	if err := row.Scan(&set.Revision); err != nil {
+		return set, noRows(err)
+	}
+
+	// a deleted record has a journal entry but no row in user_data
+	rows, err := s.db.QueryContext(ctx, `select c.name, c.revision, d.name is null, coalesce(d.type, 0), d.data,
+    coalesce(d.version, 0), coalesce(d.folder, ''), d.tags, d.created_timestamp, d.updated_timestamp
+    from user_data_changes as c
+    left join user_data as d on d.user_id = c.user_id and d.name = c.name
+    where c.user_id = $1 and c.revision > $2 and c.revision <= $3
+    order by c.revision limit $4`, userID, since, set.Revision, limit+1)
+	if err != nil {
+		return set, err
+	}
+	defer rows.Close()
+
+	page := newChangesPage(set, limit, maxBytes)
+	for rows.Next() {
+		var change model.Change
+		var createdAt, updatedAt *time.Time
+
+		err = rows.Scan(&change.Name, &change.Revision, &change.Deleted, &change.Kind, &change.Bytes,
+			&change.Version, &change.Folder, (*stringList)(&change.Tags), &createdAt, &updatedAt)
+		if err != nil {
+			return set, err
+		}
+
+		change.CreatedAt, change.UpdatedAt = time.Unix(0, 0).UTC(), time.Unix(0, 0).UTC()
+		if createdAt != nil {
+			change.CreatedAt = *createdAt
+		}
+		if updatedAt != nil {
+			change.UpdatedAt = *updatedAt
+		}
+
+		if !page.add(change) {
+			break
+		}
+	}
+
+	if rows.Err() != nil {
+		return set, rows.Err()
+	}
+
+	if set.Revision < since {
+		set.Revision = since
+	}
+
+	return set, nil
+}
+
+func (s *SQLiteStorage) RunExclusive(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error) {
+	now := sqliteNow()
+
+	// several servers may share the database file, the lock is a row that expires if its owner died
+	res, err := s.db.ExecContext(ctx, `insert into job_locks (name, owner, expiry_timestamp) values ($1, $2, $3)
+    on conflict (name) do update set owner = excluded.owner, expiry_timestamp = excluded.expiry_timestamp
+    where job_locks.expiry_timestamp < $4`, name, s.owner, now.Add(sqliteLockLease), now)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	fnErr := fn(ctx)
+
+	// ctx may be already canceled, the lock must be released anyway
+	_, err = s.db.ExecContext(context.Background(), `delete from job_locks where name = $1 and owner = $2`, name, s.owner)
+	if err != nil && fnErr == nil {
+		fnErr = err
+	}
+
+	return true, fnErr
+}
+
+// affectedOr возвращает noneErr, если запрос не изменил ни одной строки
+func affectedOr(res sql.Result, noneErr error) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return noneErr
+	}
+
+	return nil
+}
+
+func rowsAffected(res sql.Result) (int, error) {
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,61 @@
+package storage_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/smakimka/pam/internal/server/storage"
+)
+
+type sqliteTestDB struct {
+	db *sql.DB
+}
+
+func (db sqliteTestDB) Exec(ctx context.Context, query string, args ...any) error {
+	_, err := db.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (db sqliteTestDB) QueryInt(ctx context.Context, query string, args ...any) (int, error) {
+	var n int
+	err := db.db.QueryRowContext(ctx, query, args...).Scan(&n)
+	return n, err
+}
+
+// SQLiteStorageTestSuite те же сценарии, что и для Postgres, на файле во временной директории, докер не нужен
+type SQLiteStorageTestSuite struct {
+	sqlStorageTestSuite
+	sqlDB *sql.DB
+}
+
+func (s *SQLiteStorageTestSuite) SetupSuite() {
+	db, err := storage.OpenSQLite("sqlite:" + filepath.Join(s.T().TempDir(), "pam.db"))
+	if err != nil {
+		panic(err)
+	}
+
+	s.Storage, err = storage.NewSQLiteStorage(db)
+	if err != nil {
+		panic(err)
+	}
+	if err = s.Storage.Init(context.Background()); err != nil {
+		panic(err)
+	}
+
+	s.db = sqliteTestDB{db: db}
+	s.sqlDB = db
+}
+
+func (s *SQLiteStorageTestSuite) TearDownSuite() {
+	if err := s.sqlDB.Close(); err != nil {
+		panic(err)
+	}
+}
+
+func TestSQLiteStorageTestSuite(t *testing.T) {
+	suite.Run(t, new(SQLiteStorageTestSuite))
+}
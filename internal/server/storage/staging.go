@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+// stagedChunks содержимое файла, полученное от клиента до начала транзакции. Клиент может передавать файл
+// долго, а транзакция все это время держала бы соединение и блокировки, в SQLite - блокировку записи всей базы
+type stagedChunks struct {
+	f *os.File
+	r *bufio.Reader
+}
+
+// stageChunks читает чанки вызовами next до io.EOF во временный файл, границы чанков сохраняются
+func stageChunks(next func() ([]byte, error)) (*stagedChunks, error) {
+	f, err := os.CreateTemp("", "pam-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	staged := &stagedChunks{f: f}
+
+	if err = staged.write(next); err != nil {
+		staged.Close()
+		return nil, err
+	}
+
+	return staged, nil
+}
+
+func (s *stagedChunks) write(next func() ([]byte, error)) error {
+	w := bufio.NewWriter(s.f)
+
+	// every chunk is stored with its length in front
+	var size [4]byte
+	for {
+		chunk, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		binary.BigEndian.PutUint32(size[:], uint32(len(chunk)))
+		if _, err = w.Write(size[:]); err != nil {
+			return err
+		}
+		if _, err = w.Write(chunk); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	s.r = bufio.NewReader(s.f)
+
+	return nil
+}
+
+// next возвращает чанки по порядку, после последнего - io.EOF
+func (s *stagedChunks) next() ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(s.r, size[:]); err != nil {
+		return nil, err
+	}
+
+	chunk := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(s.r, chunk); err != nil {
+		return nil, err
+	}
+
+	return chunk, nil
+}
+
+// Close удаляет временный файл
+func (s *stagedChunks) Close() error {
+	s.f.Close()
+	return os.Remove(s.f.Name())
+}
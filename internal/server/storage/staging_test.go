@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStageChunks(t *testing.T) {
+	chunks := [][]byte{[]byte("first"), {}, []byte("third")}
+
+	i := 0
+	staged, err := stageChunks(func() ([]byte, error) {
+		if i == len(chunks) {
+			return nil, io.EOF
+		}
+		i++
+		return chunks[i-1], nil
+	})
+	require.NoError(t, err)
+
+	for _, want := range chunks {
+		chunk, err := staged.next()
+		require.NoError(t, err)
+		assert.Equal(t, want, chunk)
+	}
+	_, err = staged.next()
+	assert.ErrorIs(t, err, io.EOF)
+
+	require.NoError(t, staged.Close())
+	_, err = os.Stat(staged.f.Name())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// a broken upload leaves nothing behind
+	broken := errors.New("broken stream")
+	_, err = stageChunks(func() ([]byte, error) {
+		return nil, broken
+	})
+	assert.ErrorIs(t, err, broken)
+}
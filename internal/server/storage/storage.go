@@ -11,13 +11,99 @@ type Storage interface {
 	Init(ctx context.Context) error
 
 	GetUser(ctx context.Context, username string) (*model.UserData, error)
+	GetUserByID(ctx context.Context, userID int) (*model.UserData, error)
 	GetData(ctx context.Context, userID int, name string) (*model.Data, error)
 	GetDataNames(ctx context.Context, userID int) ([]string, error)
+	// ListData возвращает записи пользователя вместе с метаданными, подходящие под фильтры opts, и курсор
+	// следующей страницы, пустой, если страница последняя. Для неверного курсора возвращает ErrInvalidCursor
+	ListData(ctx context.Context, userID int, opts model.ListOptions) ([]model.DataInfo, string, error)
+	// GetDataVersions возвращает текущую версию записи и все версии из истории, от новых к старым
+	GetDataVersions(ctx context.Context, userID int, name string) ([]model.DataVersion, error)
+	GetDataVersion(ctx context.Context, userID int, name string, version int) (*model.Data, error)
+	// GetChanges возвращает не больше limit последних изменений записей с ревизией больше since, всего
+	// не больше maxBytes байт, но хотя бы одно изменение, даже если оно больше maxBytes
+	GetChanges(ctx context.Context, userID int, since int64, limit int, maxBytes int) (*model.ChangeSet, error)
+	// ListSessions возвращает действующие токены пользователя, кроме API токенов, недавно использованные первыми
+	ListSessions(ctx context.Context, userID int, now time.Time) ([]model.Session, error)
+	// GetUserByToken ищет пользователя по действующему токену. Здесь и в остальных методах token - хеш токена
 	GetUserByToken(ctx context.Context, token string, now time.Time) (*model.UserData, error)
+	// ListApiTokens возвращает действующие API токены пользователя в порядке создания
+	ListApiTokens(ctx context.Context, userID int, now time.Time) ([]model.ApiToken, error)
+	GetVaultParams(ctx context.Context, userID int) ([]byte, error)
+	GetTwoFactor(ctx context.Context, userID int) (*model.TwoFactor, error)
+	// GetLoginLock возвращает время, до которого заблокированы попытки входа по ключу (адресу или имени
+	// пользователя), нулевое время, если блокировки нет
+	GetLoginLock(ctx context.Context, key string) (time.Time, error)
 
+	// CreateUser создает пользователя, если имя уже занято, возвращает ErrUserExists
 	CreateUser(ctx context.Context, username string, pwd []byte) (int, error)
+	// CreateAuthToken сохраняет токен, value - хеш токена, сами токены в базе не хранятся
 	CreateAuthToken(ctx context.Context, userID int, value string, expiry time.Time) (int, error)
+	// CreateApiToken сохраняет API токен с правами и сроком из token, value - хеш токена
+	CreateApiToken(ctx context.Context, userID int, value string, token model.ApiToken) (int, error)
+	// MigrateTokens заменяет токены, сохраненные до хеширования, их хешами hash и возвращает их количество
+	MigrateTokens(ctx context.Context, hash func(token string) string) (int, error)
 
+	// UpdateTokenExpiry продлевает сессию, срок API токенов не меняется
 	UpdateTokenExpiry(ctx context.Context, token string, newExpiry time.Time) error
-	UpsertData(ctx context.Context, userID int, name string, kind int, data []byte) (int, error)
+	// AddLoginFailure учитывает неудачную попытку входа и возвращает количество неудачных попыток подряд,
+	// если предыдущая была раньше, чем window назад, счет начинается заново
+	AddLoginFailure(ctx context.Context, key string, now time.Time, window time.Duration) (int, error)
+	// LockLogin блокирует попытки входа по ключу до until
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	// ResetLoginFailures сбрасывает счетчик неудачных попыток и блокировку, например, после успешного входа
+	ResetLoginFailures(ctx context.Context, key string) error
+	// UpdatePassword меняет хеш пароля пользователя и отзывает все его токены, кроме keepToken
+	UpdatePassword(ctx context.Context, userID int, pwd []byte, keepToken string, now time.Time) error
+	// RevokeToken отзывает действующий токен пользователя, если такого токена нет, возвращает ErrNotFound
+	RevokeToken(ctx context.Context, userID int, token string, now time.Time) error
+	// RevokeSession отзывает действующий токен пользователя по его id, если такого токена нет, возвращает ErrNotFound
+	RevokeSession(ctx context.Context, userID int, sessionID int, now time.Time) error
+	UpdateTokenUsage(ctx context.Context, token string, usage model.TokenUsage) error
+	// SetVaultParams сохраняет параметры KDF, только если они еще не были сохранены
+	SetVaultParams(ctx context.Context, userID int, params []byte) error
+	// SetTwoFactorSecret сохраняет новый неподтвержденный секрет TOTP, если 2FA уже включена, возвращает ErrTwoFactorEnabled
+	SetTwoFactorSecret(ctx context.Context, userID int, secret string) error
+	// EnableTwoFactor включает 2FA с сохраненным секретом, counter - период подтвердившего кода,
+	// recoveryCodes - хеши новых кодов восстановления, заменяющих старые
+	EnableTwoFactor(ctx context.Context, userID int, counter int64, recoveryCodes [][]byte) error
+	// DisableTwoFactor выключает 2FA и удаляет секрет и коды восстановления, если 2FA не включена, возвращает ErrTwoFactorDisabled
+	DisableTwoFactor(ctx context.Context, userID int) error
+	// ReplaceRecoveryCodes заменяет коды восстановления новыми, если 2FA не включена, возвращает ErrTwoFactorDisabled
+	ReplaceRecoveryCodes(ctx context.Context, userID int, recoveryCodes [][]byte) error
+	// UseTOTPCounter отмечает период TOTP использованным, если код этого или более позднего периода
+	// уже использовался, возвращает ErrCodeReused
+	UseTOTPCounter(ctx context.Context, userID int, counter int64) error
+	// UseRecoveryCode отмечает код восстановления использованным, если такого неиспользованного кода нет,
+	// возвращает ErrNotFound
+	UseRecoveryCode(ctx context.Context, userID int, codeHash []byte, now time.Time) error
+	// UpsertData сохраняет новую версию записи и возвращает ее номер. Если expectedVersion не AnyVersion,
+	// текущая версия должна с ней совпадать (0 - записи еще нет), иначе возвращается ErrVersionConflict
+	UpsertData(ctx context.Context, userID int, name string, kind int, data []byte, meta model.DataMeta, expectedVersion int) (int, error)
+
+	// RestoreData делает версию из истории текущей как новую версию и возвращает ее номер,
+	// если такой версии нет, возвращает ErrNoSuchVersion
+	RestoreData(ctx context.Context, userID int, name string, version int) (int, error)
+	// DeleteUser удаляет пользователя вместе со всеми его данными, историей и токенами, если пользователя
+	// нет, возвращает ErrNotFound
+	DeleteUser(ctx context.Context, userID int) error
+	// DeleteData удаляет запись, если записи нет, возвращает ErrNotFound. Если expectedVersion не AnyVersion,
+	// текущая версия должна с ней совпадать, иначе возвращается ErrVersionConflict
+	DeleteData(ctx context.Context, userID int, name string, expectedVersion int) error
+	// DeleteExpiredTokens удаляет истекшие и отозванные токены и возвращает их количество
+	DeleteExpiredTokens(ctx context.Context, now time.Time) (int, error)
+	// DeleteStaleLoginAttempts удаляет счетчики неудачных попыток входа, последняя из которых была раньше
+	// before, если блокировка по ним уже закончилась, и возвращает их количество
+	DeleteStaleLoginAttempts(ctx context.Context, before time.Time, now time.Time) (int, error)
+
+	// UpsertFile сохраняет запись с описанием info и содержимым, которое читается вызовами next до io.EOF,
+	// версия проверяется так же, как в UpsertData. Содержимое читается целиком до того, как запись начнет
+	// меняться, поэтому медленная передача не мешает остальным изменениям
+	UpsertFile(ctx context.Context, userID int, name string, kind int, info []byte, meta model.DataMeta, expectedVersion int, next func() ([]byte, error)) (int, error)
+	// GetFileChunks по порядку передает в send все чанки содержимого записи
+	GetFileChunks(ctx context.Context, dataID int, send func([]byte) error) error
+
+	// RunExclusive выполняет fn, только если ни один другой экземпляр сервера сейчас не выполняет задачу
+	// с тем же name, и возвращает, была ли fn выполнена
+	RunExclusive(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error)
 }
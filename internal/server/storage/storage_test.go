@@ -0,0 +1,160 @@
+package storage_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/smakimka/pam/internal/server/model"
+	"github.com/smakimka/pam/internal/server/storage"
+	"github.com/smakimka/pam/internal/server/storage/storagetest"
+)
+
+// testDB выполняет SQL прямо в базе хранилища для проверок, которых нет в интерфейсе Storage
+type testDB interface {
+	Exec(ctx context.Context, query string, args ...any) error
+	QueryInt(ctx context.Context, query string, args ...any) (int, error)
+}
+
+// sqlStorageTestSuite общие сценарии и проверки самих таблиц для хранилищ в SQL базе, хранилище и базу
+// для них готовят наборы конкретных реализаций
+type sqlStorageTestSuite struct {
+	storagetest.Suite
+	db testDB
+}
+
+func (s *sqlStorageTestSuite) TestMigrateTokens() {
+	ctx := context.Background()
+	now := time.Now()
+	hash := func(token string) string { return "hashed " + token }
+
+	userID, err := s.Storage.CreateUser(ctx, "test", []byte("pwd"))
+	if err != nil {
+		panic(err)
+	}
+
+	// a row left from before tokens were hashed
+	err = s.db.Exec(ctx, `insert into auths (user_id, token, expiry_timestamp) values ($1, 'plain', $2)`, userID, now.Add(time.Minute).UTC())
+	if err != nil {
+		panic(err)
+	}
+	if _, err = s.Storage.CreateAuthToken(ctx, userID, "hashed new", now.Add(time.Minute)); err != nil {
+		panic(err)
+	}
+
+	migrated, err := s.Storage.MigrateTokens(ctx, hash)
+	s.Require().NoError(err)
+	s.Equal(1, migrated)
+
+	_, err = s.Storage.GetUserByToken(ctx, "plain", now)
+	s.ErrorIs(err, storage.ErrNoActiveToken)
+	_, err = s.Storage.GetUserByToken(ctx, "hashed plain", now)
+	s.NoError(err)
+	_, err = s.Storage.GetUserByToken(ctx, "hashed new", now)
+	s.NoError(err)
+
+	migrated, err = s.Storage.MigrateTokens(ctx, hash)
+	s.Require().NoError(err)
+	s.Zero(migrated)
+}
+
+func (s *sqlStorageTestSuite) TestDeleteUserRows() {
+	ctx := context.Background()
+
+	userID, err := s.Storage.CreateUser(ctx, "test", []byte("pwd"))
+	if err != nil {
+		panic(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err = s.Storage.UpsertData(ctx, userID, "data", 0, []byte("data"), model.DataMeta{}, storage.AnyVersion); err != nil {
+			panic(err)
+		}
+	}
+	if _, err = s.Storage.CreateAuthToken(ctx, userID, "token", time.Now().Add(time.Minute)); err != nil {
+		panic(err)
+	}
+	if err = s.Storage.SetTwoFactorSecret(ctx, userID, "secret"); err != nil {
+		panic(err)
+	}
+	if err = s.Storage.EnableTwoFactor(ctx, userID, 1, [][]byte{[]byte("code")}); err != nil {
+		panic(err)
+	}
+
+	s.Require().NoError(s.Storage.DeleteUser(ctx, userID))
+
+	for _, table := range []string{"user_data", "user_data_changes", "recovery_codes", "auths"} {
+		count, err := s.db.QueryInt(ctx, fmt.Sprintf("select count(*) from %s where user_id = $1", table), userID)
+		s.Require().NoError(err)
+		s.Zero(count, table)
+	}
+
+	count, err := s.db.QueryInt(ctx, `select count(*) from user_data_history`)
+	s.Require().NoError(err)
+	s.Zero(count)
+}
+
+func (s *sqlStorageTestSuite) TestMigrations() {
+	ctx := context.Background()
+	migrator := s.Storage.(storage.Migrator)
+
+	// the suite has already initialized the storage
+	migrations, err := migrator.Migrations(ctx)
+	s.Require().NoError(err)
+	s.Require().NotEmpty(migrations)
+	for _, m := range migrations {
+		s.False(m.AppliedAt.IsZero(), m.Name)
+	}
+
+	applied, err := migrator.Migrate(ctx)
+	s.Require().NoError(err)
+	s.Zero(applied)
+
+	// a database the server created before versioned migrations is adopted as is
+	if _, err = s.Storage.CreateUser(ctx, "test", []byte("pwd")); err != nil {
+		panic(err)
+	}
+	if err = s.db.Exec(ctx, `drop table schema_version`); err != nil {
+		panic(err)
+	}
+
+	migrations, err = migrator.Migrations(ctx)
+	s.Require().NoError(err)
+	for _, m := range migrations {
+		s.True(m.AppliedAt.IsZero(), m.Name)
+	}
+
+	applied, err = migrator.Migrate(ctx)
+	s.Require().NoError(err)
+	s.Equal(len(migrations), applied)
+
+	_, err = s.Storage.GetUser(ctx, "test")
+	s.NoError(err)
+
+	// a newer server has migrated the database
+	err = s.db.Exec(ctx, `insert into schema_version (version, name, applied_timestamp) values (1000, 'future', $1)`, time.Now().UTC())
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		if err := s.db.Exec(ctx, `delete from schema_version where version = 1000`); err != nil {
+			panic(err)
+		}
+	}()
+
+	_, err = migrator.Migrate(ctx)
+	s.ErrorIs(err, storage.ErrUnknownMigration)
+
+	migrations, err = migrator.Migrations(ctx)
+	s.Require().NoError(err)
+	s.Equal("future", migrations[len(migrations)-1].Name)
+}
+
+func (s *sqlStorageTestSuite) AfterTest(suiteName, testName string) {
+	ctx := context.Background()
+
+	for _, table := range []string{"user_data", "auths", "user_data_changes", "recovery_codes", "login_attempts", "users"} {
+		if err := s.db.Exec(ctx, "delete from "+table); err != nil {
+			panic(err)
+		}
+	}
+}
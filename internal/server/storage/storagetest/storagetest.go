@@ -0,0 +1,1223 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/smakimka/pam/internal/datatypes"
+	"github.com/smakimka/pam/internal/server/model"
+	"github.com/smakimka/pam/internal/server/storage"
+)
+
+// Suite сценарии, которые должна проходить каждая реализация storage.Storage. Набор конкретной реализации
+// встраивает Suite и перед каждым сценарием кладет в Storage пустое хранилище
+type Suite struct {
+	suite.Suite
+	Storage storage.Storage
+}
+
+func (s *Suite) TestGetUser() {
+	tests := []struct {
+		username string
+		wantErr  bool
+	}{
+		{
+			username: "test",
+			wantErr:  false,
+		},
+		{
+			username: "1234",
+			wantErr:  true,
+		},
+		// the name is matched exactly, like wildcards match nobody
+		{
+			username: "tes_",
+			wantErr:  true,
+		},
+		{
+			username: "t%t",
+			wantErr:  true,
+		},
+		{
+			username: "test%",
+			wantErr:  true,
+		},
+		{
+			username: "TEST",
+			wantErr:  true,
+		},
+	}
+
+	_, err := s.Storage.CreateUser(context.Background(), "test", []byte("pwd"))
+	if err != nil {
+		panic(err)
+	}
+
+	for _, test := range tests {
+		user, err := s.Storage.GetUser(context.Background(), test.username)
+
+		if test.wantErr {
+			s.ErrorIs(err, storage.ErrNotFound)
+		} else {
+			s.Equal(test.username, user.Username)
+			s.NoError(err)
+		}
+	}
+}
+
+func (s *Suite) TestGetUserWildcards() {
+	ctx := context.Background()
+
+	// like wildcards in names are plain characters, every user gets only their own row
+	ids := map[string]int{}
+	for _, username := range []string{"a_b", "axb", "a%b", "aab", "a%", "a"} {
+		userID, err := s.Storage.CreateUser(ctx, username, []byte(username))
+		if err != nil {
+			panic(err)
+		}
+		ids[username] = userID
+	}
+
+	for username, userID := range ids {
+		user, err := s.Storage.GetUser(ctx, username)
+		s.Require().NoError(err, username)
+		s.Equal(userID, user.ID, username)
+		s.Equal(username, user.Username)
+		s.Equal([]byte(username), user.Pwd)
+	}
+
+	_, err := s.Storage.GetUser(ctx, "a_")
+	s.ErrorIs(err, storage.ErrNotFound)
+}
+
+func (s *Suite) TestGetUserByID() {
+	ctx := context.Background()
+
+	userID, err := s.Storage.CreateUser(ctx, "test", []byte("pwd"))
+	if err != nil {
+		panic(err)
+	}
+
+	user, err := s.Storage.GetUserByID(ctx, userID)
+	s.Require().NoError(err)
+	s.Equal(userID, user.ID)
+	s.Equal("test", user.Username)
+	s.Equal([]byte("pwd"), user.Pwd)
+
+	_, err = s.Storage.GetUserByID(ctx, userID+1)
+	s.ErrorIs(err, storage.ErrNotFound)
+}
+
+func (s *Suite) TestCreateUser() {
+	ctx := context.Background()
+
+	userID, err := s.Storage.CreateUser(ctx, "test", []byte("pwd"))
+	s.Require().NoError(err)
+
+	_, err = s.Storage.CreateUser(ctx, "test", []byte("other"))
+	s.ErrorIs(err, storage.ErrUserExists)
+
+	user, err := s.Storage.GetUser(ctx, "test")
+	s.Require().NoError(err)
+	s.Equal(userID, user.ID)
+	s.Equal([]byte("pwd"), user.Pwd)
+}
+
+func (s *Suite) TestLoginAttempts() {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	lockedUntil, err := s.Storage.GetLoginLock(ctx, "user:test")
+	s.Require().NoError(err)
+	s.True(lockedUntil.IsZero())
+
+	for want := 1; want <= 3; want++ {
+		failures, err := s.Storage.AddLoginFailure(ctx, "user:test", now, time.Hour)
+		s.Require().NoError(err)
+		s.Equal(want, failures)
+	}
+
+	// the previous failure is older than the window, counting starts over
+	failures, err := s.Storage.AddLoginFailure(ctx, "user:test", now.Add(2*time.Hour), time.Hour)
+	s.Require().NoError(err)
+	s.Equal(1, failures)
+
+	s.Require().NoError(s.Storage.LockLogin(ctx, "user:test", now.Add(time.Minute)))
+	lockedUntil, err = s.Storage.GetLoginLock(ctx, "user:test")
+	s.Require().NoError(err)
+	s.True(now.Add(time.Minute).Equal(lockedUntil))
+
+	lockedUntil, err = s.Storage.GetLoginLock(ctx, "ip:127.0.0.1")
+	s.Require().NoError(err)
+	s.True(lockedUntil.IsZero())
+
+	s.Require().NoError(s.Storage.ResetLoginFailures(ctx, "user:test"))
+	lockedUntil, err = s.Storage.GetLoginLock(ctx, "user:test")
+	s.Require().NoError(err)
+	s.True(lockedUntil.IsZero())
+
+	failures, err = s.Storage.AddLoginFailure(ctx, "user:test", now, time.Hour)
+	s.Require().NoError(err)
+	s.Equal(1, failures)
+}
+
+func (s *Suite) TestDeleteStaleLoginAttempts() {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	for _, key := range []string{"user:old", "user:locked", "user:recent"} {
+		if _, err := s.Storage.AddLoginFailure(ctx, key, now.Add(-2*time.Hour), time.Hour); err != nil {
+			panic(err)
+		}
+	}
+	if _, err := s.Storage.AddLoginFailure(ctx, "user:recent", now, time.Hour); err != nil {
+		panic(err)
+	}
+	if err := s.Storage.LockLogin(ctx, "user:locked", now.Add(time.Minute)); err != nil {
+		panic(err)
+	}
+
+	deleted, err := s.Storage.DeleteStaleLoginAttempts(ctx, now.Add(-time.Hour), now)
+	s.Require().NoError(err)
+	s.Equal(1, deleted)
+
+	// the counter survived: the failure at now started it over, this one continues it
+	failures, err := s.Storage.AddLoginFailure(ctx, "user:recent", now, time.Hour)
+	s.Require().NoError(err)
+	s.Equal(2, failures)
+
+	lockedUntil, err := s.Storage.GetLoginLock(ctx, "user:locked")
+	s.Require().NoError(err)
+	s.False(lockedUntil.IsZero())
+}
+
+func (s *Suite) TestUpdatePassword() {
+	ctx := context.Background()
+	now := time.Now()
+
+	userID, err := s.Storage.CreateUser(ctx, "test", []byte("pwd"))
+	if err != nil {
+		panic(err)
+	}
+	otherID, err := s.Storage.CreateUser(ctx, "other", []byte("pwd"))
+	if err != nil {
+		panic(err)
+	}
+
+	for _, token := range []string{"current", "old"} {
+		if _, err = s.Storage.CreateAuthToken(ctx, userID, token, now.Add(time.Minute)); err != nil {
+			panic(err)
+		}
+	}
+	if _, err = s.Storage.CreateAuthToken(ctx, otherID, "other", now.Add(time.Minute)); err != nil {
+		panic(err)
+	}
+
+	s.Require().NoError(s.Storage.UpdatePassword(ctx, userID, []byte("new"), "current", now))
+
+	user, err := s.Storage.GetUser(ctx, "test")
+	s.Require().NoError(err)
+	s.Equal([]byte("new"), user.Pwd)
+
+	_, err = s.Storage.GetUserByToken(ctx, "current", now)
+	s.NoError(err)
+	_, err = s.Storage.GetUserByToken(ctx, "old", now)
+	s.ErrorIs(err, storage.ErrNoActiveToken)
+	_, err = s.Storage.GetUserByToken(ctx, "other", now)
+	s.NoError(err)
+
+	s.ErrorIs(s.Storage.UpdatePassword(ctx, -1, []byte("new"), "", now), storage.ErrNotFound)
+}
+
+func (s *Suite) TestDeleteUser() {
+	ctx := context.Background()
+	now := time.Now()
+
+	userID, err := s.Storage.CreateUser(ctx, "test", []byte("pwd"))
+	if err != nil {
+		panic(err)
+	}
+	otherID, err := s.Storage.CreateUser(ctx, "other", []byte("pwd"))
+	if err != nil {
+		panic(err)
+	}
+
+	for _, id := range []int{userID, otherID} {
+		for i := 0; i < 2; i++ {
+			if _, err = s.Storage.UpsertData(ctx, id, "data", 0, []byte("data"), model.DataMeta{}, storage.AnyVersion); err != nil {
+				panic(err)
+			}
+		}
+		if _, err = s.Storage.CreateAuthToken(ctx, id, fmt.Sprintf("token_%d", id), now.Add(time.Minute)); err != nil {
+			panic(err)
+		}
+	}
+	if err = s.Storage.SetTwoFactorSecret(ctx, userID, "secret"); err != nil {
+		panic(err)
+	}
+	if err = s.Storage.EnableTwoFactor(ctx, userID, 1, [][]byte{[]byte("code")}); err != nil {
+		panic(err)
+	}
+
+	s.Require().NoError(s.Storage.DeleteUser(ctx, userID))
+	s.ErrorIs(s.Storage.DeleteUser(ctx, userID), storage.ErrNotFound)
+
+	_, err = s.Storage.GetUser(ctx, "test")
+	s.ErrorIs(err, storage.ErrNotFound)
+	_, err = s.Storage.GetUserByToken(ctx, fmt.Sprintf("token_%d", userID), now)
+	s.ErrorIs(err, storage.ErrNoActiveToken)
+
+	names, err := s.Storage.GetDataNames(ctx, userID)
+	s.Require().NoError(err)
+	s.Empty(names)
+	_, err = s.Storage.GetChanges(ctx, userID, 0, 10, 1<<20)
+	s.ErrorIs(err, storage.ErrNotFound)
+	_, err = s.Storage.GetTwoFactor(ctx, userID)
+	s.ErrorIs(err, storage.ErrNotFound)
+
+	// the username is free again
+	_, err = s.Storage.CreateUser(ctx, "test", []byte("pwd"))
+	s.NoError(err)
+
+	data, err := s.Storage.GetData(ctx, otherID, "data")
+	s.Require().NoError(err)
+	s.Equal(2, data.Version)
+	_, err = s.Storage.GetUserByToken(ctx, fmt.Sprintf("token_%d", otherID), now)
+	s.NoError(err)
+}
+
+func (s *Suite) TestTwoFactor() {
+	ctx := context.Background()
+	now := time.Now()
+
+	userID, err := s.Storage.CreateUser(ctx, "test", []byte("pwd"))
+	s.Require().NoError(err)
+
+	s.ErrorIs(s.Storage.ReplaceRecoveryCodes(ctx, userID, [][]byte{[]byte("code")}), storage.ErrTwoFactorDisabled)
+	s.ErrorIs(s.Storage.DisableTwoFactor(ctx, userID), storage.ErrTwoFactorDisabled)
+
+	s.Require().NoError(s.Storage.SetTwoFactorSecret(ctx, userID, "secret"))
+	s.Require().NoError(s.Storage.EnableTwoFactor(ctx, userID, 1, [][]byte{[]byte("old"), []byte("old 2")}))
+	s.ErrorIs(s.Storage.SetTwoFactorSecret(ctx, userID, "other"), storage.ErrTwoFactorEnabled)
+
+	s.NoError(s.Storage.UseRecoveryCode(ctx, userID, []byte("old"), now))
+	s.ErrorIs(s.Storage.UseRecoveryCode(ctx, userID, []byte("old"), now), storage.ErrNotFound)
+
+	// new codes replace all of the old ones, used or not
+	s.Require().NoError(s.Storage.ReplaceRecoveryCodes(ctx, userID, [][]byte{[]byte("new")}))
+	s.ErrorIs(s.Storage.UseRecoveryCode(ctx, userID, []byte("old 2"), now), storage.ErrNotFound)
+	s.NoError(s.Storage.UseRecoveryCode(ctx, userID, []byte("new"), now))
+
+	s.Require().NoError(s.Storage.ReplaceRecoveryCodes(ctx, userID, [][]byte{[]byte("newer")}))
+	s.Require().NoError(s.Storage.DisableTwoFactor(ctx, userID))
+
+	tf, err := s.Storage.GetTwoFactor(ctx, userID)
+	s.Require().NoError(err)
+	s.False(tf.Enabled)
+	s.Empty(tf.Secret)
+	s.ErrorIs(s.Storage.UseRecoveryCode(ctx, userID, []byte("newer"), now), storage.ErrNotFound)
+
+	// 2FA can be enabled again from scratch
+	s.NoError(s.Storage.SetTwoFactorSecret(ctx, userID, "other"))
+	s.NoError(s.Storage.EnableTwoFactor(ctx, userID, 1, nil))
+}
+
+func (s *Suite) TestApiTokens() {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	userID, err := s.Storage.CreateUser(ctx, "test", []byte("pwd"))
+	if err != nil {
+		panic(err)
+	}
+	if _, err = s.Storage.CreateAuthToken(ctx, userID, "session", now.Add(time.Minute)); err != nil {
+		panic(err)
+	}
+
+	ciID, err := s.Storage.CreateApiToken(ctx, userID, "ci", model.ApiToken{
+		Description: "ci",
+		TokenScope:  model.TokenScope{Prefixes: []string{"ci/", "deploy_"}},
+	})
+	s.Require().NoError(err)
+	_, err = s.Storage.CreateApiToken(ctx, userID, "writer", model.ApiToken{
+		TokenScope: model.TokenScope{Write: true},
+		ExpiresAt:  now.Add(time.Hour),
+	})
+	s.Require().NoError(err)
+
+	user, err := s.Storage.GetUserByToken(ctx, "session", now)
+	s.Require().NoError(err)
+	s.Nil(user.Scope)
+
+	user, err = s.Storage.GetUserByToken(ctx, "ci", now.Add(365*24*time.Hour))
+	s.Require().NoError(err)
+	s.Equal(&model.TokenScope{Prefixes: []string{"ci/", "deploy_"}}, user.Scope)
+
+	user, err = s.Storage.GetUserByToken(ctx, "writer", now)
+	s.Require().NoError(err)
+	s.Equal(&model.TokenScope{Write: true, Prefixes: []string{}}, user.Scope)
+	_, err = s.Storage.GetUserByToken(ctx, "writer", now.Add(2*time.Hour))
+	s.ErrorIs(err, storage.ErrNoActiveToken)
+
+	// api tokens are not prolonged
+	s.Require().NoError(s.Storage.UpdateTokenExpiry(ctx, "writer", now.Add(24*time.Hour)))
+	_, err = s.Storage.GetUserByToken(ctx, "writer", now.Add(2*time.Hour))
+	s.ErrorIs(err, storage.ErrNoActiveToken)
+
+	tokens, err := s.Storage.ListApiTokens(ctx, userID, now)
+	s.Require().NoError(err)
+	s.Require().Len(tokens, 2)
+	s.Equal(ciID, tokens[0].ID)
+	s.Equal("ci", tokens[0].Description)
+	s.True(tokens[0].ExpiresAt.IsZero())
+	s.True(tokens[1].Write)
+	s.True(now.Add(time.Hour).Equal(tokens[1].ExpiresAt))
+
+	sessions, err := s.Storage.ListSessions(ctx, userID, now)
+	s.Require().NoError(err)
+	s.Len(sessions, 1)
+
+	s.Require().NoError(s.Storage.RevokeSession(ctx, userID, ciID, now))
+	_, err = s.Storage.GetUserByToken(ctx, "ci", now)
+	s.ErrorIs(err, storage.ErrNoActiveToken)
+}
+
+func (s *Suite) TestListDataPrefixes() {
+	ctx := context.Background()
+
+	userID, err := s.Storage.CreateUser(ctx, "test", []byte("pwd"))
+	if err != nil {
+		panic(err)
+	}
+
+	for _, name := range []string{"ci/key", "ci_key", "deploy_key", "other"} {
+		if _, err = s.Storage.UpsertData(ctx, userID, name, 0, []byte("data"), model.DataMeta{}, storage.AnyVersion); err != nil {
+			panic(err)
+		}
+	}
+
+	data, _, err := s.Storage.ListData(ctx, userID, model.ListOptions{Sort: model.SortName, Prefixes: []string{"ci/", "deploy"}})
+	s.Require().NoError(err)
+	names := []string{}
+	for _, info := range data {
+		names = append(names, info.Name)
+	}
+	s.Equal([]string{"ci/key", "deploy_key"}, names)
+
+	data, _, err = s.Storage.ListData(ctx, userID, model.ListOptions{Prefix: "dep", Prefixes: []string{"ci/", "deploy"}})
+	s.Require().NoError(err)
+	s.Require().Len(data, 1)
+	s.Equal("deploy_key", data[0].Name)
+}
+
+func (s *Suite) TestDeleteExpiredTokens() {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	userID, err := s.Storage.CreateUser(ctx, "test", []byte("pwd"))
+	if err != nil {
+		panic(err)
+	}
+
+	if _, err = s.Storage.CreateAuthToken(ctx, userID, "active", now.Add(time.Minute)); err != nil {
+		panic(err)
+	}
+	if _, err = s.Storage.CreateAuthToken(ctx, userID, "expired", now.Add(-time.Minute)); err != nil {
+		panic(err)
+	}
+	if _, err = s.Storage.CreateAuthToken(ctx, userID, "revoked", now.Add(time.Minute)); err != nil {
+		panic(err)
+	}
+	if err = s.Storage.RevokeToken(ctx, userID, "revoked", now); err != nil {
+		panic(err)
+	}
+	if _, err = s.Storage.CreateApiToken(ctx, userID, "api", model.ApiToken{}); err != nil {
+		panic(err)
+	}
+
+	deleted, err := s.Storage.DeleteExpiredTokens(ctx, now)
+	s.Require().NoError(err)
+	s.Equal(2, deleted)
+
+	for _, token := range []string{"active", "api"} {
+		_, err = s.Storage.GetUserByToken(ctx, token, now)
+		s.NoError(err)
+	}
+
+	deleted, err = s.Storage.DeleteExpiredTokens(ctx, now)
+	s.Require().NoError(err)
+	s.Equal(0, deleted)
+}
+
+func (s *Suite) TestConcurrentWrites() {
+	ctx := context.Background()
+	const n = 10
+
+	var wg sync.WaitGroup
+	userErrs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, userErrs[i] = s.Storage.CreateUser(ctx, "test", []byte("pwd"))
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range userErrs {
+		if err == nil {
+			created++
+			continue
+		}
+		s.ErrorIs(err, storage.ErrUserExists)
+	}
+	s.Equal(1, created)
+
+	user, err := s.Storage.GetUser(ctx, "test")
+	s.Require().NoError(err)
+
+	// only one of the writers expecting a new record gets to create it, different records don't interfere
+	dataErrs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			_, dataErrs[i] = s.Storage.UpsertData(ctx, user.ID, "shared", datatypes.Text, []byte("data"), model.DataMeta{}, 0)
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			_, err := s.Storage.UpsertData(ctx, user.ID, fmt.Sprintf("data_%d", i), datatypes.Text, []byte("data"), model.DataMeta{}, 0)
+			s.NoError(err)
+		}(i)
+	}
+	wg.Wait()
+
+	created = 0
+	for _, err := range dataErrs {
+		if err == nil {
+			created++
+			continue
+		}
+		s.ErrorIs(err, storage.ErrVersionConflict)
+	}
+	s.Equal(1, created)
+
+	set, err := s.Storage.GetChanges(ctx, user.ID, 0, 2*n, 1<<20)
+	s.Require().NoError(err)
+	s.Len(set.Changes, n+1)
+	s.Equal(int64(n+1), set.Revision)
+}
+
+func (s *Suite) TestConcurrentUpserts() {
+	ctx := context.Background()
+	const n = 10
+
+	userID, err := s.Storage.CreateUser(ctx, "test", []byte("pwd"))
+	s.Require().NoError(err)
+
+	_, err = s.Storage.UpsertData(ctx, userID, "data", datatypes.Text, []byte("first"), model.DataMeta{}, 0)
+	s.Require().NoError(err)
+
+	// writers that don't check the version all succeed, each one archives the version it replaced
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = s.Storage.UpsertData(ctx, userID, "data", datatypes.Text, []byte(fmt.Sprintf("data_%d", i)), model.DataMeta{}, storage.AnyVersion)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		s.NoError(err)
+	}
+
+	versions, err := s.Storage.GetDataVersions(ctx, userID, "data")
+	s.Require().NoError(err)
+	s.Require().Len(versions, n+1)
+	for i, version := range versions {
+		s.Equal(n+1-i, version.Version)
+	}
+
+	data, err := s.Storage.GetDataVersion(ctx, userID, "data", 1)
+	s.NoError(err)
+	s.Equal([]byte("first"), data.Bytes)
+}
+
+func (s *Suite) TestRunExclusive() {
+	ctx := context.Background()
+
+	var inner bool
+	ran, err := s.Storage.RunExclusive(ctx, "job", func(ctx context.Context) error {
+		// another server trying the same job while it runs
+		var err error
+		inner, err = s.Storage.RunExclusive(ctx, "job", func(ctx context.Context) error { return nil })
+		if err != nil {
+			return err
+		}
+
+		otherRan, err := s.Storage.RunExclusive(ctx, "other job", func(ctx context.Context) error { return nil })
+		s.True(otherRan)
+		return err
+	})
+	s.Require().NoError(err)
+	s.True(ran)
+	s.False(inner)
+
+	// the lock is released afterwards, errors from fn are passed through
+	ran, err = s.Storage.RunExclusive(ctx, "job", func(ctx context.Context) error { return errors.New("failed") })
+	s.True(ran)
+	s.EqualError(err, "failed")
+}
+
+func (s *Suite) TestRevokeToken() {
+	ctx := context.Background()
+	now := time.Now()
+
+	userID, err := s.Storage.CreateUser(ctx, "test", []byte("pwd"))
+	if err != nil {
+		panic(err)
+	}
+
+	otherID, err := s.Storage.CreateUser(ctx, "other", []byte("pwd"))
+	if err != nil {
+		panic(err)
+	}
+
+	for _, token := range []string{"first", "second"} {
+		if _, err = s.Storage.CreateAuthToken(ctx, userID, token, now.Add(time.Minute)); err != nil {
+			panic(err)
+		}
+	}
+	if _, err = s.Storage.CreateAuthToken(ctx, otherID, "other", now.Add(time.Minute)); err != nil {
+		panic(err)
+	}
+
+	tests := []struct {
+		userID  int
+		token   string
+		wantErr error
+	}{
+		{userID: userID, token: "first", wantErr: nil},
+		{userID: userID, token: "first", wantErr: storage.ErrNotFound},
+		{userID: userID, token: "other", wantErr: storage.ErrNotFound},
+		{userID: userID, token: "unknown", wantErr: storage.ErrNotFound},
+	}
+
+	for _, test := range tests {
+		err = s.Storage.RevokeToken(ctx, test.userID, test.token, now)
+		if test.wantErr != nil {
+			s.ErrorIs(err, test.wantErr)
+			continue
+		}
+		s.NoError(err)
+	}
+
+	_, err = s.Storage.GetUserByToken(ctx, "first", now)
+	s.ErrorIs(err, storage.ErrNoActiveToken)
+
+	// prolonging a revoked token doesn't bring it back
+	s.NoError(s.Storage.UpdateTokenExpiry(ctx, "first", now.Add(time.Hour)))
+	_, err = s.Storage.GetUserByToken(ctx, "first", now)
+	s.ErrorIs(err, storage.ErrNoActiveToken)
+
+	user, err := s.Storage.GetUserByToken(ctx, "second", now)
+	s.NoError(err)
+	s.Equal(userID, user.ID)
+
+	_, err = s.Storage.GetUserByToken(ctx, "other", now)
+	s.NoError(err)
+}
+
+func (s *Suite) TestSessions() {
+	ctx := context.Background()
+	now := time.Now()
+
+	userID, err := s.Storage.CreateUser(ctx, "test", []byte("pwd"))
+	if err != nil {
+		panic(err)
+	}
+
+	otherID, err := s.Storage.CreateUser(ctx, "other", []byte("pwd"))
+	if err != nil {
+		panic(err)
+	}
+
+	laptopID, err := s.Storage.CreateAuthToken(ctx, userID, "laptop", now.Add(time.Minute))
+	if err != nil {
+		panic(err)
+	}
+	phoneID, err := s.Storage.CreateAuthToken(ctx, userID, "phone", now.Add(time.Minute))
+	if err != nil {
+		panic(err)
+	}
+	if _, err = s.Storage.CreateAuthToken(ctx, userID, "expired", now.Add(-time.Minute)); err != nil {
+		panic(err)
+	}
+	otherSessionID, err := s.Storage.CreateAuthToken(ctx, otherID, "other", now.Add(time.Minute))
+	if err != nil {
+		panic(err)
+	}
+
+	usage := model.TokenUsage{UsedAt: now.UTC().Add(time.Second).Truncate(time.Microsecond), IP: "10.0.0.1", UserAgent: "pam-cli linux"}
+	s.NoError(s.Storage.UpdateTokenUsage(ctx, "laptop", usage))
+
+	sessions, err := s.Storage.ListSessions(ctx, userID, now)
+	s.NoError(err)
+	s.Len(sessions, 2)
+	s.Equal(laptopID, sessions[0].ID)
+	s.Equal("laptop", sessions[0].Token)
+	s.Equal(usage.IP, sessions[0].IP)
+	s.Equal(usage.UserAgent, sessions[0].UserAgent)
+	s.True(usage.UsedAt.Equal(sessions[0].UsedAt))
+	s.Equal(phoneID, sessions[1].ID)
+	s.Equal("", sessions[1].IP)
+
+	s.ErrorIs(s.Storage.RevokeSession(ctx, userID, otherSessionID, now), storage.ErrNotFound)
+	s.NoError(s.Storage.RevokeSession(ctx, userID, laptopID, now))
+	s.ErrorIs(s.Storage.RevokeSession(ctx, userID, laptopID, now), storage.ErrNotFound)
+
+	sessions, err = s.Storage.ListSessions(ctx, userID, now)
+	s.NoError(err)
+	s.Len(sessions, 1)
+	s.Equal(phoneID, sessions[0].ID)
+
+	_, err = s.Storage.GetUserByToken(ctx, "laptop", now)
+	s.ErrorIs(err, storage.ErrNoActiveToken)
+}
+
+func (s *Suite) TestUpsertFile() {
+	tests := []struct {
+		name       string
+		info       []byte
+		chunks     [][]byte
+		wantChunks [][]byte
+	}{
+		{
+			name:       "file",
+			info:       []byte("info"),
+			chunks:     [][]byte{[]byte("first"), []byte("second")},
+			wantChunks: [][]byte{[]byte("first"), []byte("second")},
+		},
+		{
+			name:       "file",
+			info:       []byte("new info"),
+			chunks:     [][]byte{[]byte("only")},
+			wantChunks: [][]byte{[]byte("only")},
+		},
+		{
+			name:       "empty",
+			info:       []byte("info"),
+			chunks:     [][]byte{},
+			wantChunks: nil,
+		},
+	}
+	ctx := context.Background()
+
+	userID, err := s.Storage.CreateUser(ctx, "test", []byte("pwd"))
+	if err != nil {
+		panic(err)
+	}
+
+	for _, test := range tests {
+		i := 0
+		next := func() ([]byte, error) {
+			if i == len(test.chunks) {
+				return nil, io.EOF
+			}
+			i++
+			return test.chunks[i-1], nil
+		}
+
+		_, err := s.Storage.UpsertFile(ctx, userID, test.name, datatypes.File, test.info, model.DataMeta{}, storage.AnyVersion, next)
+		s.NoError(err)
+
+		data, err := s.Storage.GetData(ctx, userID, test.name)
+		s.NoError(err)
+		s.Equal(test.info, data.Bytes)
+
+		var chunks [][]byte
+		err = s.Storage.GetFileChunks(ctx, data.ID, func(chunk []byte) error {
+			chunks = append(chunks, chunk)
+			return nil
+		})
+		s.NoError(err)
+		s.Equal(test.wantChunks, chunks)
+	}
+}
+
+func (s *Suite) TestUpsertFileSlowUpload() {
+	ctx := context.Background()
+
+	userID, err := s.Storage.CreateUser(ctx, "test", []byte("pwd"))
+	if err != nil {
+		panic(err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	sent := 0
+	next := func() ([]byte, error) {
+		sent++
+		switch sent {
+		case 1:
+			close(started)
+			return []byte("first"), nil
+		case 2:
+			// the rest of the file is still on its way
+			<-release
+			return []byte("second"), nil
+		default:
+			return nil, io.EOF
+		}
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := s.Storage.UpsertFile(ctx, userID, "file", datatypes.File, []byte("info"), model.DataMeta{}, 0, next)
+		done <- err
+	}()
+	<-started
+
+	// other writes are not held up by the upload
+	writeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err = s.Storage.UpsertData(writeCtx, userID, "text", datatypes.Text, []byte("text"), model.DataMeta{}, storage.AnyVersion)
+	s.NoError(err)
+	_, err = s.Storage.CreateAuthToken(writeCtx, userID, "token", time.Now().Add(time.Minute))
+	s.NoError(err)
+
+	close(release)
+	s.Require().NoError(<-done)
+
+	data, err := s.Storage.GetData(ctx, userID, "file")
+	s.Require().NoError(err)
+
+	var content []byte
+	err = s.Storage.GetFileChunks(ctx, data.ID, func(chunk []byte) error {
+		content = append(content, chunk...)
+		return nil
+	})
+	s.NoError(err)
+	s.Equal("firstsecond", string(content))
+}
+
+func (s *Suite) TestDeleteData() {
+	ctx := context.Background()
+
+	userID, err := s.Storage.CreateUser(ctx, "test", []byte("pwd"))
+	if err != nil {
+		panic(err)
+	}
+
+	sent := false
+	_, err = s.Storage.UpsertFile(ctx, userID, "file", datatypes.File, []byte("info"), model.DataMeta{}, storage.AnyVersion, func() ([]byte, error) {
+		if sent {
+			return nil, io.EOF
+		}
+		sent = true
+		return []byte("chunk"), nil
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	data, err := s.Storage.GetData(ctx, userID, "file")
+	if err != nil {
+		panic(err)
+	}
+
+	// the file was changed since version 0 was seen
+	s.ErrorIs(s.Storage.DeleteData(ctx, userID, "file", 0), storage.ErrVersionConflict)
+	s.ErrorIs(s.Storage.DeleteData(ctx, userID, "file", 2), storage.ErrVersionConflict)
+	s.NoError(s.Storage.DeleteData(ctx, userID, "file", 1))
+	s.ErrorIs(s.Storage.DeleteData(ctx, userID, "file", storage.AnyVersion), storage.ErrNotFound)
+	s.ErrorIs(s.Storage.DeleteData(ctx, userID, "file", 1), storage.ErrNotFound)
+
+	_, err = s.Storage.GetData(ctx, userID, "file")
+	s.ErrorIs(err, storage.ErrNotFound)
+
+	var chunks [][]byte
+	err = s.Storage.GetFileChunks(ctx, data.ID, func(chunk []byte) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	s.NoError(err)
+	s.Empty(chunks)
+}
+
+func (s *Suite) TestHistory() {
+	ctx := context.Background()
+
+	userID, err := s.Storage.CreateUser(ctx, "test", []byte("pwd"))
+	if err != nil {
+		panic(err)
+	}
+
+	for _, value := range []string{"first", "second", "third"} {
+		_, err = s.Storage.UpsertData(ctx, userID, "data", datatypes.Text, []byte(value), model.DataMeta{}, storage.AnyVersion)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	versions, err := s.Storage.GetDataVersions(ctx, userID, "data")
+	s.NoError(err)
+	s.Len(versions, 3)
+	s.Equal(3, versions[0].Version)
+	s.True(versions[0].Current)
+	s.Equal(2, versions[1].Version)
+	s.False(versions[1].Current)
+	s.Equal(1, versions[2].Version)
+
+	data, err := s.Storage.GetDataVersion(ctx, userID, "data", 1)
+	s.NoError(err)
+	s.Equal([]byte("first"), data.Bytes)
+
+	data, err = s.Storage.GetDataVersion(ctx, userID, "data", 3)
+	s.NoError(err)
+	s.Equal([]byte("third"), data.Bytes)
+
+	_, err = s.Storage.GetDataVersion(ctx, userID, "data", 4)
+	s.ErrorIs(err, storage.ErrNotFound)
+
+	version, err := s.Storage.RestoreData(ctx, userID, "data", 1)
+	s.NoError(err)
+	s.Equal(4, version)
+
+	data, err = s.Storage.GetData(ctx, userID, "data")
+	s.NoError(err)
+	s.Equal([]byte("first"), data.Bytes)
+	s.Equal(4, data.Version)
+
+	data, err = s.Storage.GetDataVersion(ctx, userID, "data", 3)
+	s.NoError(err)
+	s.Equal([]byte("third"), data.Bytes)
+
+	_, err = s.Storage.RestoreData(ctx, userID, "data", 10)
+	s.ErrorIs(err, storage.ErrNoSuchVersion)
+
+	_, err = s.Storage.RestoreData(ctx, userID, "not_data", 1)
+	s.ErrorIs(err, storage.ErrNotFound)
+}
+
+func (s *Suite) TestUpsertDataVersionCheck() {
+	tests := []struct {
+		value           string
+		expectedVersion int
+		wantVersion     int
+		wantErr         error
+	}{
+		{value: "first", expectedVersion: 0, wantVersion: 1, wantErr: nil},
+		{value: "again", expectedVersion: 0, wantVersion: 1, wantErr: storage.ErrVersionConflict},
+		{value: "second", expectedVersion: 1, wantVersion: 2, wantErr: nil},
+		{value: "stale", expectedVersion: 1, wantVersion: 2, wantErr: storage.ErrVersionConflict},
+		{value: "third", expectedVersion: storage.AnyVersion, wantVersion: 3, wantErr: nil},
+	}
+	ctx := context.Background()
+
+	userID, err := s.Storage.CreateUser(ctx, "test", []byte("pwd"))
+	if err != nil {
+		panic(err)
+	}
+
+	for _, test := range tests {
+		version, err := s.Storage.UpsertData(ctx, userID, "data", datatypes.Text, []byte(test.value), model.DataMeta{}, test.expectedVersion)
+		if test.wantErr != nil {
+			s.ErrorIs(err, test.wantErr)
+		} else {
+			s.NoError(err)
+			s.Equal(test.wantVersion, version)
+		}
+
+		data, err := s.Storage.GetData(ctx, userID, "data")
+		s.NoError(err)
+		s.Equal(test.wantVersion, data.Version)
+	}
+}
+
+func (s *Suite) TestListData() {
+	ctx := context.Background()
+
+	userID, err := s.Storage.CreateUser(ctx, "test", []byte("pwd"))
+	if err != nil {
+		panic(err)
+	}
+
+	records := []struct {
+		name string
+		meta model.DataMeta
+	}{
+		{name: "b", meta: model.DataMeta{Folder: "work", Tags: []string{"aws", "prod"}}},
+		{name: "c", meta: model.DataMeta{}},
+		{name: "a", meta: model.DataMeta{Folder: "work"}},
+	}
+	for _, record := range records {
+		_, err = s.Storage.UpsertData(ctx, userID, record.name, datatypes.Text, []byte("data"), record.meta, storage.AnyVersion)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	infos, next, err := s.Storage.ListData(ctx, userID, model.ListOptions{})
+	s.NoError(err)
+	s.Len(infos, 3)
+	s.Equal("", next)
+
+	s.Equal("c", infos[0].Name)
+	s.Equal("", infos[0].Folder)
+	s.Equal([]string{}, infos[0].Tags)
+	s.Equal("a", infos[1].Name)
+	s.Equal("b", infos[2].Name)
+	s.Equal("work", infos[2].Folder)
+	s.Equal([]string{"aws", "prod"}, infos[2].Tags)
+	s.False(infos[2].CreatedAt.IsZero())
+
+	_, err = s.Storage.UpsertData(ctx, userID, "b", datatypes.Text, []byte("new data"), model.DataMeta{Folder: "home"}, storage.AnyVersion)
+	s.NoError(err)
+
+	data, err := s.Storage.GetData(ctx, userID, "b")
+	s.NoError(err)
+	s.Equal("home", data.Folder)
+	s.Equal([]string{}, data.Tags)
+	s.Equal(infos[2].CreatedAt, data.CreatedAt)
+	s.False(data.UpdatedAt.Before(data.CreatedAt))
+}
+
+func (s *Suite) TestListDataFilters() {
+	ctx := context.Background()
+
+	userID, err := s.Storage.CreateUser(ctx, "test", []byte("pwd"))
+	if err != nil {
+		panic(err)
+	}
+
+	records := []struct {
+		name string
+		kind int
+		meta model.DataMeta
+	}{
+		{name: "github", kind: datatypes.Login, meta: model.DataMeta{Folder: "work", Tags: []string{"dev"}}},
+		{name: "gitlab", kind: datatypes.Login, meta: model.DataMeta{Tags: []string{"dev"}}},
+		{name: "git_notes", kind: datatypes.Text, meta: model.DataMeta{Folder: "work"}},
+		{name: "bank", kind: datatypes.Card, meta: model.DataMeta{Tags: []string{"money"}}},
+		{name: "gitXnotes", kind: datatypes.Text, meta: model.DataMeta{}},
+	}
+	for _, record := range records {
+		_, err = s.Storage.UpsertData(ctx, userID, record.name, record.kind, []byte("data"), record.meta, storage.AnyVersion)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	login := datatypes.Login
+
+	tests := []struct {
+		opts      model.ListOptions
+		wantNames []string
+	}{
+		{
+			opts:      model.ListOptions{},
+			wantNames: []string{"bank", "gitXnotes", "gitlab", "git_notes", "github"},
+		},
+		{
+			opts:      model.ListOptions{Sort: model.SortName},
+			wantNames: []string{"bank", "gitXnotes", "git_notes", "github", "gitlab"},
+		},
+		{
+			opts:      model.ListOptions{Prefix: "git_", Sort: model.SortName},
+			wantNames: []string{"git_notes"},
+		},
+		{
+			opts:      model.ListOptions{Prefix: "git", Kind: &login, Sort: model.SortName},
+			wantNames: []string{"github", "gitlab"},
+		},
+		{
+			opts:      model.ListOptions{Tag: "dev", Sort: model.SortName},
+			wantNames: []string{"github", "gitlab"},
+		},
+		{
+			opts:      model.ListOptions{Sort: model.SortUpdated},
+			wantNames: []string{"gitXnotes", "bank", "git_notes", "gitlab", "github"},
+		},
+	}
+
+	for _, test := range tests {
+		infos, next, err := s.Storage.ListData(ctx, userID, test.opts)
+		s.NoError(err)
+		s.Equal("", next)
+
+		names := []string{}
+		for _, info := range infos {
+			names = append(names, info.Name)
+		}
+		s.Equal(test.wantNames, names)
+	}
+
+	for _, sort := range []string{model.SortFolder, model.SortName, model.SortCreated, model.SortUpdated} {
+		all, _, err := s.Storage.ListData(ctx, userID, model.ListOptions{Sort: sort})
+		s.NoError(err)
+
+		paged := []model.DataInfo{}
+		opts := model.ListOptions{Sort: sort, Limit: 2}
+		for {
+			infos, next, err := s.Storage.ListData(ctx, userID, opts)
+			s.NoError(err)
+			s.LessOrEqual(len(infos), 2)
+
+			paged = append(paged, infos...)
+			if next == "" {
+				break
+			}
+			opts.Cursor = next
+		}
+		s.Equal(all, paged)
+	}
+
+	_, _, err = s.Storage.ListData(ctx, userID, model.ListOptions{Sort: "size"})
+	s.ErrorIs(err, storage.ErrInvalidSort)
+
+	_, _, err = s.Storage.ListData(ctx, userID, model.ListOptions{Cursor: "garbage"})
+	s.ErrorIs(err, storage.ErrInvalidCursor)
+
+	_, next, err := s.Storage.ListData(ctx, userID, model.ListOptions{Sort: model.SortName, Limit: 1})
+	s.NoError(err)
+	_, _, err = s.Storage.ListData(ctx, userID, model.ListOptions{Sort: model.SortUpdated, Cursor: next})
+	s.ErrorIs(err, storage.ErrInvalidCursor)
+}
+
+func (s *Suite) TestGetChanges() {
+	ctx := context.Background()
+
+	userID, err := s.Storage.CreateUser(ctx, "test", []byte("pwd"))
+	if err != nil {
+		panic(err)
+	}
+
+	otherID, err := s.Storage.CreateUser(ctx, "other", []byte("pwd"))
+	if err != nil {
+		panic(err)
+	}
+
+	set, err := s.Storage.GetChanges(ctx, userID, 0, 10, 1<<20)
+	s.NoError(err)
+	s.Empty(set.Changes)
+	s.Equal(int64(0), set.Revision)
+
+	for _, name := range []string{"a", "b", "c"} {
+		_, err = s.Storage.UpsertData(ctx, userID, name, datatypes.Text, []byte(name), model.DataMeta{Folder: "f"}, storage.AnyVersion)
+		if err != nil {
+			panic(err)
+		}
+	}
+	_, err = s.Storage.UpsertData(ctx, otherID, "a", datatypes.Text, []byte("other"), model.DataMeta{}, storage.AnyVersion)
+	if err != nil {
+		panic(err)
+	}
+
+	set, err = s.Storage.GetChanges(ctx, userID, 0, 10, 1<<20)
+	s.NoError(err)
+	s.False(set.More)
+	s.Equal(int64(3), set.Revision)
+	s.Len(set.Changes, 3)
+	s.Equal("a", set.Changes[0].Name)
+	s.Equal([]byte("a"), set.Changes[0].Bytes)
+	s.Equal("f", set.Changes[0].Folder)
+	s.Equal(1, set.Changes[0].Version)
+
+	set, err = s.Storage.GetChanges(ctx, userID, 0, 2, 1<<20)
+	s.NoError(err)
+	s.True(set.More)
+	s.Len(set.Changes, 2)
+	s.Equal(int64(2), set.Revision)
+
+	// every change takes 3 bytes: name, data and folder, a page holds at least one change, even a large one
+	for maxBytes, want := range map[int]int{0: 1, 5: 1, 6: 2} {
+		set, err = s.Storage.GetChanges(ctx, userID, 0, 10, maxBytes)
+		s.NoError(err)
+		s.True(set.More, maxBytes)
+		s.Len(set.Changes, want, maxBytes)
+		s.Equal(int64(want), set.Revision, maxBytes)
+	}
+
+	set, err = s.Storage.GetChanges(ctx, userID, 0, 10, 9)
+	s.NoError(err)
+	s.False(set.More)
+	s.Len(set.Changes, 3)
+
+	// only the latest change of a record is kept
+	_, err = s.Storage.UpsertData(ctx, userID, "a", datatypes.Text, []byte("new a"), model.DataMeta{}, storage.AnyVersion)
+	s.NoError(err)
+	s.NoError(s.Storage.DeleteData(ctx, userID, "b", storage.AnyVersion))
+
+	set, err = s.Storage.GetChanges(ctx, userID, 3, 10, 1<<20)
+	s.NoError(err)
+	s.Equal(int64(5), set.Revision)
+	s.Len(set.Changes, 2)
+	s.Equal("a", set.Changes[0].Name)
+	s.False(set.Changes[0].Deleted)
+	s.Equal([]byte("new a"), set.Changes[0].Bytes)
+	s.Equal(2, set.Changes[0].Version)
+	s.Equal("b", set.Changes[1].Name)
+	s.True(set.Changes[1].Deleted)
+
+	_, err = s.Storage.RestoreData(ctx, userID, "a", 1)
+	s.NoError(err)
+
+	set, err = s.Storage.GetChanges(ctx, userID, 5, 10, 1<<20)
+	s.NoError(err)
+	s.Len(set.Changes, 1)
+	s.Equal([]byte("a"), set.Changes[0].Bytes)
+
+	set, err = s.Storage.GetChanges(ctx, userID, set.Revision, 10, 1<<20)
+	s.NoError(err)
+	s.Empty(set.Changes)
+	s.Equal(int64(6), set.Revision)
+}
+
+func (s *Suite) TestRestoreFile() {
+	ctx := context.Background()
+
+	userID, err := s.Storage.CreateUser(ctx, "test", []byte("pwd"))
+	if err != nil {
+		panic(err)
+	}
+
+	for _, value := range []string{"old", "new"} {
+		sent := false
+		_, err = s.Storage.UpsertFile(ctx, userID, "file", datatypes.File, []byte(value+" info"), model.DataMeta{}, storage.AnyVersion, func() ([]byte, error) {
+			if sent {
+				return nil, io.EOF
+			}
+			sent = true
+			return []byte(value), nil
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	_, err = s.Storage.RestoreData(ctx, userID, "file", 1)
+	s.NoError(err)
+
+	data, err := s.Storage.GetData(ctx, userID, "file")
+	s.NoError(err)
+	s.Equal([]byte("old info"), data.Bytes)
+
+	var chunks [][]byte
+	err = s.Storage.GetFileChunks(ctx, data.ID, func(chunk []byte) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	s.NoError(err)
+	s.Equal([][]byte{[]byte("old")}, chunks)
+}
@@ -0,0 +1,30 @@
+// Пакет tokenhash считает хеши токенов авторизации. В базе хранятся только хеши, поэтому утечка базы
+// не дает действующих сессий
+package tokenhash
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Hasher считает HMAC-SHA256 токенов с ключом сервера. Если ключ поменять, все выданные токены перестанут
+// действовать
+type Hasher struct {
+	key []byte
+}
+
+func New(key []byte) *Hasher {
+	return &Hasher{key: key}
+}
+
+// Hash возвращает хеш токена в hex, для пустого токена - пустую строку
+func (h *Hasher) Hash(token string) string {
+	if token == "" {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,19 @@
+package tokenhash
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHash(t *testing.T) {
+	h := New([]byte("key"))
+
+	hash := h.Hash("token")
+	assert.Len(t, hash, 64)
+	assert.NotContains(t, hash, "token")
+	assert.Equal(t, hash, h.Hash("token"))
+	assert.NotEqual(t, hash, h.Hash("other"))
+	assert.NotEqual(t, hash, New([]byte("other key")).Hash("token"))
+	assert.Equal(t, "", h.Hash(""))
+}